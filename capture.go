@@ -0,0 +1,133 @@
+package gomesh
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// CaptureDirection tells which way a captured chunk of bytes travelled
+type CaptureDirection string
+
+const (
+	CaptureFromRadio CaptureDirection = "from_radio" // Bytes read from the radio
+	CaptureToRadio   CaptureDirection = "to_radio"   // Bytes written to the radio
+)
+
+// CaptureRecord is one read from or write to the radio's transport
+type CaptureRecord struct {
+	Time      time.Time        `json:"time"`
+	Direction CaptureDirection `json:"dir"`
+	Data      []byte           `json:"data"`
+}
+
+// CaptureWriter records the raw bytes exchanged with a radio, one JSON object per line with the
+// data base64 encoded. Set it as Radio.Capture before Init. It is safe for concurrent use
+type CaptureWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewCaptureWriter returns a CaptureWriter that writes records to w
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{enc: json.NewEncoder(w)}
+}
+
+// Record appends a chunk of bytes with the current time. After the first failed write every
+// later record is dropped and the error is returned again
+func (c *CaptureWriter) Record(direction CaptureDirection, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+
+	c.err = c.enc.Encode(CaptureRecord{Time: time.Now(), Direction: direction, Data: data})
+	if c.err != nil {
+		defaultLogger().Warn("capture stopped", "err", c.err)
+	}
+
+	return c.err
+}
+
+// Err returns the error that stopped the capture, if any
+func (c *CaptureWriter) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// ReadCapture parses the records written by a CaptureWriter
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	var records []CaptureRecord
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record CaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("capture line %d: %w", line, err)
+		}
+		if record.Direction != CaptureFromRadio && record.Direction != CaptureToRadio {
+			return nil, fmt.Errorf("capture line %d: unknown direction %q", line, record.Direction)
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// LoadCapture reads a capture file
+func LoadCapture(path string) ([]CaptureRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadCapture(file)
+}
+
+// captureTransport records every byte passing through a transport
+type captureTransport struct {
+	Transport
+	capture *CaptureWriter
+}
+
+func (c *captureTransport) Read(p []byte) (int, error) {
+	n, err := c.Transport.Read(p)
+	if n > 0 {
+		c.capture.Record(CaptureFromRadio, p[:n])
+	}
+	return n, err
+}
+
+func (c *captureTransport) Write(p []byte) (int, error) {
+	n, err := c.Transport.Write(p)
+	if n > 0 {
+		c.capture.Record(CaptureToRadio, p[:n])
+	}
+	return n, err
+}
+
+// captured wraps transport for recording when the radio has a capture configured
+func (r *Radio) captured(transport Transport) Transport {
+	if r.Capture == nil {
+		return transport
+	}
+	return &captureTransport{Transport: transport, capture: r.Capture}
+}
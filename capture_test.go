@@ -0,0 +1,163 @@
+package gomesh
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+func TestCaptureAndReplay(t *testing.T) {
+	device := newFakeDevice(t, 0x42)
+	device.setDump([]*pb.FromRadio{
+		{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: 0x42, User: &pb.User{LongName: "Field radio"}}}},
+	})
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Error creating capture: %v", err)
+	}
+	defer file.Close()
+
+	// Record a session in which a text message arrives
+	recorded := Radio{Capture: NewCaptureWriter(file)}
+	if err := recorded.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	sub := recorded.Subscribe(PacketFilter{PortNums: []pb.PortNum{pb.PortNum_TEXT_MESSAGE_APP}})
+	device.push(textPacket(0x99, 0x42, "hello from the field"))
+	select {
+	case <-sub.C:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the live packet")
+	}
+	recorded.Close()
+
+	records, err := LoadCapture(path)
+	if err != nil {
+		t.Fatalf("Error loading capture: %v", err)
+	}
+	if len(records) == 0 || records[0].Direction != CaptureToRadio {
+		t.Fatalf("Expected the capture to start with the config request, got %d records", len(records))
+	}
+
+	// A serial session starts with the console writes that switch the radio to API mode, which
+	// a replaying radio never sends
+	var serial []CaptureRecord
+	for _, command := range []string{"exit\n", "set debug_log_api false\n", "exit\n"} {
+		serial = append(serial,
+			CaptureRecord{Time: records[0].Time, Direction: CaptureToRadio, Data: []byte(command)},
+			CaptureRecord{Time: records[0].Time, Direction: CaptureFromRadio, Data: []byte("INFO | ok\r\n")},
+		)
+	}
+	serial = append(serial, records...)
+
+	tests := []struct {
+		name    string
+		records []CaptureRecord
+	}{
+		{"tcp", records},
+		{"serial", serial},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Replay it into a fresh radio as fast as possible
+			radio := Radio{}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := radio.InitWithTransportContext(ctx, NewReplayTransport(tt.records, ReplayOptions{Speed: -1})); err != nil {
+				t.Fatalf("Error initializing from replay: %v", err)
+			}
+			defer radio.Close()
+
+			if radio.GetNodeID() != 0x42 {
+				t.Errorf("Expected node number 0x42 from replay, got 0x%x", radio.GetNodeID())
+			}
+
+			// Everything the replay delivered after the handshake is still queued for the read helpers
+			responses, err := radio.ReadResponseWithTypes(true)
+			if err != nil {
+				t.Fatalf("Error reading replayed responses: %v", err)
+			}
+
+			found := false
+			for _, fromRadio := range responses.ProtobufPackets {
+				if string(fromRadio.GetPacket().GetDecoded().GetPayload()) == "hello from the field" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Replayed text message not among %d packets", len(responses.ProtobufPackets))
+			}
+		})
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []CaptureRecord{
+		{Time: start, Direction: CaptureFromRadio, Data: []byte("first")},
+		{Time: start.Add(2 * time.Second), Direction: CaptureFromRadio, Data: []byte("second")},
+	}
+
+	tests := []struct {
+		name     string
+		speed    float64
+		min, max time.Duration
+	}{
+		{"Accelerated", 10, 150 * time.Millisecond, time.Second},
+		{"No pauses", -1, 0, 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewReplayTransport(records, ReplayOptions{Speed: tt.speed})
+			defer transport.Close()
+
+			buf := make([]byte, 16)
+			began := time.Now()
+			var got []byte
+			for len(got) < len("firstsecond") {
+				n, err := transport.Read(buf)
+				if err != nil {
+					t.Fatalf("Error reading replay: %v", err)
+				}
+				got = append(got, buf[:n]...)
+			}
+			elapsed := time.Since(began)
+
+			if string(got) != "firstsecond" {
+				t.Errorf("Expected the recorded bytes, got %q", got)
+			}
+			if elapsed < tt.min || elapsed > tt.max {
+				t.Errorf("Replay took %v, expected between %v and %v", elapsed, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestReadCapture(t *testing.T) {
+	var buf bytes.Buffer
+	capture := NewCaptureWriter(&buf)
+	capture.Record(CaptureToRadio, []byte{start1, start2, 0, 0})
+	capture.Record(CaptureFromRadio, []byte("INFO | boot\n"))
+
+	records, err := ReadCapture(&buf)
+	if err != nil {
+		t.Fatalf("Error reading capture: %v", err)
+	}
+	if len(records) != 2 || records[1].Direction != CaptureFromRadio || string(records[1].Data) != "INFO | boot\n" {
+		t.Errorf("Unexpected records: %+v", records)
+	}
+
+	if _, err := ReadCapture(strings.NewReader(`{"dir":"sideways","data":""}`)); err == nil {
+		t.Error("Expected an error for an unknown direction")
+	}
+}
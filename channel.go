@@ -1,8 +1,10 @@
 package gomesh
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
@@ -15,11 +17,16 @@ import (
 
 // GetChannelInfo returns the current chanels settings for the radio
 func (r *Radio) GetChannels() (channels []*pb.Channel, err error) {
+	return r.GetChannelsContext(context.Background())
+}
+
+// GetChannelsContext is GetChannels with retries bounded by ctx
+func (r *Radio) GetChannelsContext(ctx context.Context) (channels []*pb.Channel, err error) {
 
 	checks := 0
 
 	for checks < 5 && len(channels) == 0 {
-		info, err := r.GetRadioInfo()
+		info, err := r.GetRadioInfoContext(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -31,21 +38,24 @@ func (r *Radio) GetChannels() (channels []*pb.Channel, err error) {
 		}
 
 		// If we didn't get any channels wait and try again
-		time.Sleep(50 * time.Millisecond)
+		if err := sleepContext(ctx, 50*time.Millisecond); err != nil {
+			return nil, err
+		}
 		checks++
 	}
 
-	if len(channels) == 0 {
-		return nil, errors.New("no channels found")
-	}
-
 	return channels, nil
 }
 
 // GetChannelInfo returns the current chanels settings for the radio
 func (r *Radio) GetChannelInfo(index int) (channelSettings *pb.Channel, err error) {
+	return r.GetChannelInfoContext(context.Background(), index)
+}
+
+// GetChannelInfoContext returns the settings for one channel, giving up when ctx is done
+func (r *Radio) GetChannelInfoContext(ctx context.Context, index int) (channelSettings *pb.Channel, err error) {
 
-	info, err := r.GetChannels()
+	info, err := r.GetChannelsContext(ctx)
 	if err != nil {
 		return &pb.Channel{}, err
 	}
@@ -56,12 +66,17 @@ func (r *Radio) GetChannelInfo(index int) (channelSettings *pb.Channel, err erro
 		}
 	}
 
-	return &pb.Channel{}, errors.New("channel not found")
+	return &pb.Channel{}, fmt.Errorf("%w: no channel at index %d", ErrChannelNotFound, index)
 }
 
 // SetChannelURL sets the channel for the radio. The incoming channel should match the meshtastic URL format
 // of a URL ending with /#{base_64_encoded_radio_params}
 func (r *Radio) SetChannelURL(url string) error {
+	return r.SetChannelURLContext(context.Background(), url)
+}
+
+// SetChannelURLContext applies a channel URL, giving up when ctx is done
+func (r *Radio) SetChannelURLContext(ctx context.Context, url string) error {
 
 	// Split and unmarshel incoming base64 encoded protobuf packet
 	split := strings.Split(url, "/#")
@@ -110,14 +125,14 @@ func (r *Radio) SetChannelURL(url string) error {
 			return err
 		}
 
-		nodeNum := r.nodeNum
+		nodeNum := r.GetNodeID()
 
 		packet, err := r.createAdminPacket(nodeNum, out)
 		if err != nil {
 			return err
 		}
 
-		if err := r.sendPacket(packet); err != nil {
+		if err := r.sendPacket(ctx, packet); err != nil {
 			return err
 		}
 	}
@@ -127,6 +142,11 @@ func (r *Radio) SetChannelURL(url string) error {
 
 // AddChannel adds a new channel to the radio
 func (r *Radio) AddChannel(name string, cIndex int) error {
+	return r.AddChannelContext(context.Background(), name, cIndex)
+}
+
+// AddChannelContext adds a new channel, giving up when ctx is done
+func (r *Radio) AddChannelContext(ctx context.Context, name string, cIndex int) error {
 
 	var role pb.Channel_Role
 	if cIndex == 0 {
@@ -136,9 +156,9 @@ func (r *Radio) AddChannel(name string, cIndex int) error {
 	}
 
 	// Grab the channel and check if it's disabled, if not return an error
-	curChannel, err := r.GetChannelInfo(cIndex)
+	curChannel, err := r.GetChannelInfoContext(ctx, cIndex)
 	if err != nil {
-		return errors.New("error getting channel info")
+		return fmt.Errorf("getting channel info: %w", err)
 	}
 
 	if curChannel.Role != pb.Channel_DISABLED {
@@ -164,14 +184,14 @@ func (r *Radio) AddChannel(name string, cIndex int) error {
 		return err
 	}
 
-	nodeNum := r.nodeNum
+	nodeNum := r.GetNodeID()
 
 	packet, err := r.createAdminPacket(nodeNum, out)
 	if err != nil {
 		return err
 	}
 
-	if err := r.sendPacket(packet); err != nil {
+	if err := r.sendPacket(ctx, packet); err != nil {
 		return err
 	}
 
@@ -181,14 +201,19 @@ func (r *Radio) AddChannel(name string, cIndex int) error {
 
 // SetChannel sets a channel value
 func (r *Radio) SetChannel(chIndex int, key string, value string) error {
+	return r.SetChannelContext(context.Background(), chIndex, key, value)
+}
+
+// SetChannelContext sets a channel value, giving up when ctx is done
+func (r *Radio) SetChannelContext(ctx context.Context, chIndex int, key string, value string) error {
 
-	channel, err := r.GetChannelInfo(chIndex)
+	channel, err := r.GetChannelInfoContext(ctx, chIndex)
 	if err != nil {
 		return err
 	}
 
 	if channel.Role == pb.Channel_DISABLED {
-		return errors.New("no channel for provided index")
+		return fmt.Errorf("%w: channel %d is disabled", ErrChannelNotFound, chIndex)
 	}
 
 	channelSettings := channel.GetSettings()
@@ -259,14 +284,14 @@ func (r *Radio) SetChannel(chIndex int, key string, value string) error {
 		return err
 	}
 
-	nodeNum := r.nodeNum
+	nodeNum := r.GetNodeID()
 
 	packet, err := r.createAdminPacket(nodeNum, out)
 	if err != nil {
 		return err
 	}
 
-	if err := r.sendPacket(packet); err != nil {
+	if err := r.sendPacket(ctx, packet); err != nil {
 		return err
 	}
 
@@ -276,8 +301,13 @@ func (r *Radio) SetChannel(chIndex int, key string, value string) error {
 
 // Delete a channel from the radio
 func (r *Radio) DeleteChannel(cIndex int) error {
+	return r.DeleteChannelContext(context.Background(), cIndex)
+}
+
+// DeleteChannelContext disables a channel, giving up when ctx is done
+func (r *Radio) DeleteChannelContext(ctx context.Context, cIndex int) error {
 
-	channelInfo, err := r.GetChannelInfo(cIndex)
+	channelInfo, err := r.GetChannelInfoContext(ctx, cIndex)
 	if err != nil {
 		return err
 	}
@@ -302,14 +332,14 @@ func (r *Radio) DeleteChannel(cIndex int) error {
 		return err
 	}
 
-	nodeNum := r.nodeNum
+	nodeNum := r.GetNodeID()
 
 	packet, err := r.createAdminPacket(nodeNum, out)
 	if err != nil {
 		return err
 	}
 
-	if err := r.sendPacket(packet); err != nil {
+	if err := r.sendPacket(ctx, packet); err != nil {
 		return err
 	}
 
@@ -0,0 +1,494 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// ChunkPort carries the ChunkedPayload packets of a chunked transfer. It is the port the
+// firmware leaves to private applications
+const ChunkPort = pb.PortNum_PRIVATE_APP
+
+// ChunkControlPort carries the ChunkedPayloadResponse messages that start a chunked transfer,
+// ask for missing chunks and confirm delivery. The two messages cannot share a port because
+// their field numbers overlap; 257 is taken by ATAK_FORWARDER, so this is the next private port
+const ChunkControlPort = pb.PortNum(258)
+
+// DefaultChunkTimeout is used when Radio.ChunkTimeout is zero
+const DefaultChunkTimeout = time.Minute
+
+// MaxChunkedPayload is the largest payload SendPayload sends and a receiver reassembles
+const MaxChunkedPayload = 64 * 1024
+
+// chunkSize is the number of payload bytes sent in each chunk, leaving room in a mesh packet
+// for the ChunkedPayload fields
+const chunkSize = 200
+
+// maxChunks is the most chunks a payload of MaxChunkedPayload bytes is split into
+const maxChunks = (MaxChunkedPayload + chunkSize - 1) / chunkSize
+
+// maxIncomingTransfers caps the chunked payloads being received at once
+const maxIncomingTransfers = 16
+
+// Payload is a payload another node sent in chunks with SendPayload
+type Payload struct {
+	ID      uint32 // The payload id chosen by the sender
+	From    uint32
+	To      uint32
+	Channel uint32
+	Data    []byte
+	Time    time.Time // When the last missing chunk arrived
+}
+
+// outgoingTransfer routes the receiver's answers to a SendPayload call
+type outgoingTransfer struct {
+	to      uint32
+	replies chan *pb.ChunkedPayloadResponse
+}
+
+// incomingTransfer is a payload being reassembled
+type incomingTransfer struct {
+	from     uint32
+	to       uint32
+	channel  uint32
+	count    uint32 // Zero until the first chunk arrives
+	chunks   map[uint32][]byte
+	progress time.Time // When the transfer was accepted or a new chunk last arrived
+	asked    time.Time // When missing chunks were last requested
+	done     bool      // Delivered; kept until it expires to confirm again if the sender asks
+}
+
+// chunkTransfers is the state of the chunked transfers in progress
+type chunkTransfers struct {
+	mu       sync.Mutex
+	outgoing map[uint32]*outgoingTransfer
+	incoming map[packetKey]*incomingTransfer
+	payloads broadcaster[Payload]
+}
+
+// chunkTimeout returns how long a transfer may go without progress before it is abandoned
+func (r *Radio) chunkTimeout() time.Duration {
+	if r.ChunkTimeout <= 0 {
+		return DefaultChunkTimeout
+	}
+	return r.ChunkTimeout
+}
+
+// chunkRepairInterval returns how long either side of a transfer waits for the other before
+// prompting it again
+func (r *Radio) chunkRepairInterval() time.Duration {
+	return r.chunkTimeout() / 6
+}
+
+// Payloads returns a channel of the payloads other nodes sent to this radio with SendPayload.
+// Each call returns a new channel, closed when the radio is closed
+func (r *Radio) Payloads() <-chan Payload {
+	return r.chunks.payloads.subscribe()
+}
+
+// SendPayload sends data of up to MaxChunkedPayload bytes to another goMesh node, split into as
+// many packets as it needs. It returns once the destination has confirmed the whole payload
+func (r *Radio) SendPayload(data []byte, to int64, channel int64) error {
+	return r.SendPayloadContext(context.Background(), data, to, channel)
+}
+
+// SendPayloadContext sends a payload in chunks, giving up when ctx is done. The destination is
+// asked to accept the transfer, then receives every chunk and asks again for the ones it
+// missed. Without an answer for Radio.ChunkTimeout the transfer fails with ErrTimeout
+func (r *Radio) SendPayloadContext(ctx context.Context, data []byte, to int64, channel int64) error {
+	if to == 0 || uint32(to) == broadcastNum {
+		return errors.New("chunked payloads need a destination node")
+	}
+	if len(data) > MaxChunkedPayload {
+		return fmt.Errorf("%w: payload is %d bytes, the limit is %d", ErrPayloadTooLarge, len(data), MaxChunkedPayload)
+	}
+
+	id := newPacketID()
+	dest := uint32(to)
+	replies, err := r.addTransfer(id, dest)
+	if err != nil {
+		return err
+	}
+	defer r.removeTransfer(id)
+
+	chunks := splitPayload(id, data)
+	request := &pb.ChunkedPayloadResponse{
+		PayloadId:      id,
+		PayloadVariant: &pb.ChunkedPayloadResponse_RequestTransfer{RequestTransfer: true},
+	}
+	r.log().Debug("sending chunked payload", "payload_id", id, "to", dest, "bytes", len(data), "chunks", len(chunks))
+	if err := r.sendChunkMessage(ctx, ChunkControlPort, request, dest, uint32(channel)); err != nil {
+		return err
+	}
+
+	accepted := false
+	progress := time.Now()
+
+	for {
+		var send []*pb.ChunkedPayload
+
+		select {
+		case reply, ok := <-replies:
+			if !ok {
+				return errRadioClosed
+			}
+			progress = time.Now()
+
+			switch variant := reply.GetPayloadVariant().(type) {
+			case *pb.ChunkedPayloadResponse_AcceptTransfer:
+				if !variant.AcceptTransfer {
+					return fmt.Errorf("node %d refused chunked payload %d", dest, id)
+				}
+				if !accepted {
+					accepted = true
+					send = chunks
+				}
+			case *pb.ChunkedPayloadResponse_ResendChunks:
+				missing := variant.ResendChunks.GetChunks()
+				if len(missing) == 0 {
+					r.log().Debug("chunked payload delivered", "payload_id", id, "to", dest)
+					return nil
+				}
+				accepted = true
+				for _, index := range missing {
+					if index < uint32(len(chunks)) {
+						send = append(send, chunks[index])
+					}
+				}
+			}
+		case <-time.After(r.chunkRepairInterval()):
+			if time.Since(progress) > r.chunkTimeout() {
+				return fmt.Errorf("%w: node %d did not answer chunked payload %d", ErrTimeout, dest, id)
+			}
+
+			// Prompt the receiver: ask again to start, or send the last chunk so it reports
+			// what it is missing
+			if !accepted {
+				if err := r.sendChunkMessage(ctx, ChunkControlPort, request, dest, uint32(channel)); err != nil {
+					return err
+				}
+				continue
+			}
+			send = chunks[len(chunks)-1:]
+		case <-ctx.Done():
+			return contextError(ctx)
+		}
+
+		for _, chunk := range send {
+			if err := r.sendChunkMessage(ctx, ChunkPort, chunk, dest, uint32(channel)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// splitPayload cuts data into the chunks of payload id. Empty data is sent as one empty chunk
+func splitPayload(id uint32, data []byte) []*pb.ChunkedPayload {
+	count := (len(data) + chunkSize - 1) / chunkSize
+	if count == 0 {
+		count = 1
+	}
+
+	chunks := make([]*pb.ChunkedPayload, count)
+	for i := range chunks {
+		end := min((i+1)*chunkSize, len(data))
+		chunks[i] = &pb.ChunkedPayload{
+			PayloadId:    id,
+			ChunkCount:   uint32(count),
+			ChunkIndex:   uint32(i),
+			PayloadChunk: data[i*chunkSize : end],
+		}
+	}
+
+	return chunks
+}
+
+// sendChunkMessage sends one message of a chunked transfer
+func (r *Radio) sendChunkMessage(ctx context.Context, port pb.PortNum, message proto.Message, to uint32, channel uint32) error {
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	out, err := proto.Marshal(&pb.ToRadio{PayloadVariant: &pb.ToRadio_Packet{Packet: &pb.MeshPacket{
+		Id:      newPacketID(),
+		To:      to,
+		Channel: channel,
+		PayloadVariant: &pb.MeshPacket_Decoded{Decoded: &pb.Data{
+			Portnum: port,
+			Payload: payload,
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	return r.sendPacket(ctx, out)
+}
+
+// addTransfer registers a SendPayload call for the answers from node to about payload id
+func (r *Radio) addTransfer(id uint32, to uint32) (chan *pb.ChunkedPayloadResponse, error) {
+	r.chunks.mu.Lock()
+	defer r.chunks.mu.Unlock()
+
+	if r.chunks.outgoing == nil {
+		return nil, ErrNotConnected
+	}
+
+	replies := make(chan *pb.ChunkedPayloadResponse, pendingBuffer)
+	r.chunks.outgoing[id] = &outgoingTransfer{to: to, replies: replies}
+
+	return replies, nil
+}
+
+func (r *Radio) removeTransfer(id uint32) {
+	r.chunks.mu.Lock()
+	defer r.chunks.mu.Unlock()
+
+	delete(r.chunks.outgoing, id)
+}
+
+// startChunks starts receiving chunked transfers. It needs the reader running
+func (r *Radio) startChunks() {
+	r.chunks.mu.Lock()
+	r.chunks.outgoing = make(map[uint32]*outgoingTransfer)
+	r.chunks.incoming = make(map[packetKey]*incomingTransfer)
+	r.chunks.mu.Unlock()
+
+	sub := r.Subscribe(PacketFilter{PortNums: []pb.PortNum{ChunkPort, ChunkControlPort}})
+	go r.chunkLoop(sub)
+}
+
+// chunkLoop handles chunked transfer packets until the radio is closed, and asks for missing
+// chunks or abandons transfers that have stalled
+func (r *Radio) chunkLoop(sub *Subscription) {
+	defer r.stopChunks()
+
+	ticker := time.NewTicker(r.chunkRepairInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case fromRadio, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			packet := fromRadio.GetPacket()
+			if packet.GetDecoded().GetPortnum() == ChunkPort {
+				r.receiveChunk(packet, time.Now())
+			} else {
+				r.receiveChunkControl(packet, time.Now())
+			}
+		case now := <-ticker.C:
+			r.repairChunks(now)
+		}
+	}
+}
+
+// stopChunks ends every transfer once the radio is closed
+func (r *Radio) stopChunks() {
+	r.chunks.mu.Lock()
+	defer r.chunks.mu.Unlock()
+
+	for _, transfer := range r.chunks.outgoing {
+		close(transfer.replies)
+	}
+	r.chunks.outgoing = nil
+	r.chunks.incoming = nil
+}
+
+// receiveChunk stores a chunk of an incoming payload. The payload is delivered once every chunk
+// has arrived; when the last chunk arrives with others missing, they are asked for again
+func (r *Radio) receiveChunk(packet *pb.MeshPacket, now time.Time) {
+	chunk := &pb.ChunkedPayload{}
+	if err := proto.Unmarshal(packet.GetDecoded().GetPayload(), chunk); err != nil {
+		r.log().Debug("could not decode chunk", packetAttrs(packet, "err", err)...)
+		return
+	}
+
+	count, index := chunk.GetChunkCount(), chunk.GetChunkIndex()
+	if count == 0 || count > maxChunks || index >= count {
+		r.log().Debug("invalid chunk", packetAttrs(packet, "chunk_index", index, "chunk_count", count)...)
+		return
+	}
+
+	key := packetKey{from: packet.GetFrom(), id: chunk.GetPayloadId()}
+
+	r.chunks.mu.Lock()
+	transfer := r.incomingTransfer(key, packet, now)
+	if transfer == nil {
+		r.chunks.mu.Unlock()
+		return
+	}
+	if transfer.count == 0 {
+		transfer.count = count
+	}
+	if count != transfer.count {
+		r.chunks.mu.Unlock()
+		r.log().Debug("chunk count changed mid transfer", packetAttrs(packet, "payload_id", key.id)...)
+		return
+	}
+
+	var reply *pb.ResendChunks
+	var payload *Payload
+
+	if _, ok := transfer.chunks[index]; !ok && !transfer.done {
+		transfer.chunks[index] = chunk.GetPayloadChunk()
+		transfer.progress = now
+	}
+	switch {
+	case transfer.done:
+		// The sender missed the confirmation and is prompting for it
+		if index == count-1 {
+			reply = &pb.ResendChunks{}
+		}
+	case uint32(len(transfer.chunks)) == count:
+		payload = transfer.assemble(key.id, now)
+		transfer.done = true
+		transfer.chunks = nil
+		reply = &pb.ResendChunks{}
+	case index == count-1:
+		reply = &pb.ResendChunks{Chunks: transfer.missing()}
+		transfer.asked = now
+	}
+	r.chunks.mu.Unlock()
+
+	if payload != nil {
+		r.log().Info("received chunked payload", "from", payload.From, "payload_id", payload.ID, "bytes", len(payload.Data))
+		r.chunks.payloads.publish(*payload)
+	}
+	if reply != nil {
+		r.sendResendChunks(key, transfer, reply)
+	}
+}
+
+// incomingTransfer returns the transfer for key, starting one if there is room. The caller
+// holds chunks.mu
+func (r *Radio) incomingTransfer(key packetKey, packet *pb.MeshPacket, now time.Time) *incomingTransfer {
+	if r.chunks.incoming == nil {
+		return nil
+	}
+	if transfer, ok := r.chunks.incoming[key]; ok {
+		return transfer
+	}
+	if len(r.chunks.incoming) >= maxIncomingTransfers {
+		r.log().Warn("too many chunked transfers, refusing another", packetAttrs(packet, "payload_id", key.id)...)
+		return nil
+	}
+
+	transfer := &incomingTransfer{
+		from:     packet.GetFrom(),
+		to:       packet.GetTo(),
+		channel:  packet.GetChannel(),
+		chunks:   make(map[uint32][]byte),
+		progress: now,
+	}
+	r.chunks.incoming[key] = transfer
+
+	return transfer
+}
+
+// missing returns the indexes of the chunks not received yet
+func (t *incomingTransfer) missing() []uint32 {
+	var missing []uint32
+	for i := uint32(0); i < t.count; i++ {
+		if _, ok := t.chunks[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// assemble joins the chunks of a complete transfer
+func (t *incomingTransfer) assemble(id uint32, now time.Time) *Payload {
+	var data []byte
+	for i := uint32(0); i < t.count; i++ {
+		data = append(data, t.chunks[i]...)
+	}
+
+	return &Payload{ID: id, From: t.from, To: t.to, Channel: t.channel, Data: data, Time: now}
+}
+
+// receiveChunkControl accepts transfers other nodes start and passes their answers about our
+// own transfers to the SendPayload call waiting on them
+func (r *Radio) receiveChunkControl(packet *pb.MeshPacket, now time.Time) {
+	response := &pb.ChunkedPayloadResponse{}
+	if err := proto.Unmarshal(packet.GetDecoded().GetPayload(), response); err != nil {
+		r.log().Debug("could not decode chunk control message", packetAttrs(packet, "err", err)...)
+		return
+	}
+
+	if response.GetRequestTransfer() {
+		key := packetKey{from: packet.GetFrom(), id: response.GetPayloadId()}
+
+		r.chunks.mu.Lock()
+		accept := r.incomingTransfer(key, packet, now) != nil
+		r.chunks.mu.Unlock()
+
+		answer := &pb.ChunkedPayloadResponse{
+			PayloadId:      key.id,
+			PayloadVariant: &pb.ChunkedPayloadResponse_AcceptTransfer{AcceptTransfer: accept},
+		}
+		if err := r.sendChunkMessage(r.closeCtx, ChunkControlPort, answer, packet.GetFrom(), packet.GetChannel()); err != nil {
+			r.log().Debug("could not answer chunked transfer", packetAttrs(packet, "err", err)...)
+		}
+		return
+	}
+
+	r.chunks.mu.Lock()
+	defer r.chunks.mu.Unlock()
+
+	if transfer, ok := r.chunks.outgoing[response.GetPayloadId()]; ok && transfer.to == packet.GetFrom() {
+		offer(transfer.replies, response)
+	}
+}
+
+// repairChunks asks for the missing chunks of transfers that have gone quiet and forgets
+// transfers that have made no progress for the chunk timeout
+func (r *Radio) repairChunks(now time.Time) {
+	timeout, interval := r.chunkTimeout(), r.chunkRepairInterval()
+
+	type ask struct {
+		key      packetKey
+		transfer *incomingTransfer
+		reply    *pb.ResendChunks
+	}
+	var asks []ask
+
+	r.chunks.mu.Lock()
+	for key, transfer := range r.chunks.incoming {
+		idle := now.Sub(transfer.progress)
+		switch {
+		case idle > timeout:
+			delete(r.chunks.incoming, key)
+			if !transfer.done {
+				r.log().Info("dropped partial chunked payload", "from", key.from, "payload_id", key.id, "chunks", len(transfer.chunks), "chunk_count", transfer.count)
+			}
+		case !transfer.done && transfer.count > 0 && idle > interval && now.Sub(transfer.asked) > interval:
+			transfer.asked = now
+			asks = append(asks, ask{key, transfer, &pb.ResendChunks{Chunks: transfer.missing()}})
+		}
+	}
+	r.chunks.mu.Unlock()
+
+	for _, a := range asks {
+		r.sendResendChunks(a.key, a.transfer, a.reply)
+	}
+}
+
+// sendResendChunks asks the sender of a transfer for missing chunks, or confirms it with none
+func (r *Radio) sendResendChunks(key packetKey, transfer *incomingTransfer, reply *pb.ResendChunks) {
+	answer := &pb.ChunkedPayloadResponse{
+		PayloadId:      key.id,
+		PayloadVariant: &pb.ChunkedPayloadResponse_ResendChunks{ResendChunks: reply},
+	}
+	if err := r.sendChunkMessage(r.closeCtx, ChunkControlPort, answer, key.from, transfer.channel); err != nil {
+		r.log().Debug("could not answer chunked transfer", "from", key.from, "payload_id", key.id, "err", err)
+	}
+}
@@ -0,0 +1,233 @@
+package gomesh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// chunkRadio returns a radio on a fresh fake device with a short chunk timeout
+func chunkRadio(t *testing.T, nodeNum uint32) (*Radio, *fakeDevice) {
+	t.Helper()
+
+	device := newFakeDevice(t, nodeNum)
+	radio := &Radio{HeartbeatInterval: -1, ChunkTimeout: 600 * time.Millisecond}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	t.Cleanup(radio.Close)
+
+	return radio, device
+}
+
+// linkDevices forwards the chunked transfer packets radio a sends to radio b's device, as if
+// they had crossed the mesh from node from. Packets for which drop returns true are lost
+func linkDevices(t *testing.T, a *fakeDevice, b *fakeDevice, from uint32, drop func(*pb.MeshPacket) bool) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	go func() {
+		for {
+			select {
+			case toRadio := <-a.received:
+				packet := toRadio.GetPacket()
+				port := packet.GetDecoded().GetPortnum()
+				if port != ChunkPort && port != ChunkControlPort {
+					continue
+				}
+				if drop != nil && drop(packet) {
+					continue
+				}
+				packet.From = from
+				b.push(&pb.FromRadio{PayloadVariant: &pb.FromRadio_Packet{Packet: packet}})
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// chunkIndex returns the index of the chunk a packet carries, or -1 for other packets
+func chunkIndex(packet *pb.MeshPacket) int {
+	if packet.GetDecoded().GetPortnum() != ChunkPort {
+		return -1
+	}
+	chunk := &pb.ChunkedPayload{}
+	if err := proto.Unmarshal(packet.GetDecoded().GetPayload(), chunk); err != nil {
+		return -1
+	}
+	return int(chunk.GetChunkIndex())
+}
+
+func TestSplitPayload(t *testing.T) {
+	tests := []struct {
+		size  int
+		count int
+		last  int
+	}{
+		{0, 1, 0},
+		{1, 1, 1},
+		{chunkSize, 1, chunkSize},
+		{chunkSize + 1, 2, 1},
+		{MaxChunkedPayload, maxChunks, MaxChunkedPayload - (maxChunks-1)*chunkSize},
+	}
+
+	for _, tt := range tests {
+		chunks := splitPayload(7, make([]byte, tt.size))
+		if len(chunks) != tt.count {
+			t.Errorf("%d bytes: %d chunks, want %d", tt.size, len(chunks), tt.count)
+			continue
+		}
+		last := chunks[len(chunks)-1]
+		if len(last.PayloadChunk) != tt.last || last.ChunkCount != uint32(tt.count) || last.ChunkIndex != uint32(tt.count-1) {
+			t.Errorf("%d bytes: last chunk %d of %d has %d bytes, want %d", tt.size, last.ChunkIndex, last.ChunkCount, len(last.PayloadChunk), tt.last)
+		}
+
+		// A chunk must fit in a mesh packet
+		if size := proto.Size(chunks[0]); size > int(pb.Constants_DATA_PAYLOAD_LEN) {
+			t.Errorf("%d bytes: encoded chunk is %d bytes", tt.size, size)
+		}
+	}
+}
+
+func TestSendPayload(t *testing.T) {
+	const nodeA, nodeB = 0xa, 0xb
+
+	radioA, deviceA := chunkRadio(t, nodeA)
+	radioB, deviceB := chunkRadio(t, nodeB)
+
+	// Lose the first copy of chunk 3 and of the last chunk, so the receiver has to ask for
+	// chunk 3 once its repair interval passes
+	data := make([]byte, 2500)
+	rand.Read(data)
+	last := len(splitPayload(0, data)) - 1
+
+	var mu sync.Mutex
+	lost := map[int]bool{}
+	linkDevices(t, deviceA, deviceB, nodeA, func(packet *pb.MeshPacket) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		index := chunkIndex(packet)
+		if (index == 3 || index == last) && !lost[index] {
+			lost[index] = true
+			return true
+		}
+		return false
+	})
+	linkDevices(t, deviceB, deviceA, nodeB, nil)
+
+	payloads := radioB.Payloads()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := radioA.SendPayloadContext(ctx, data, nodeB, 2); err != nil {
+		t.Fatalf("SendPayload: %v", err)
+	}
+
+	select {
+	case payload := <-payloads:
+		if payload.From != nodeA || payload.Channel != 2 || !bytes.Equal(payload.Data, data) {
+			t.Errorf("Payload from %x on channel %d with %d bytes, want %d bytes from %x on channel 2", payload.From, payload.Channel, len(payload.Data), len(data), nodeA)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the payload")
+	}
+	select {
+	case payload := <-payloads:
+		t.Errorf("Payload delivered twice: %d", payload.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSendPayloadErrors(t *testing.T) {
+	radio, _ := chunkRadio(t, 0xa)
+
+	tests := []struct {
+		name string
+		size int
+		to   int64
+		want error
+	}{
+		{"too large", MaxChunkedPayload + 1, 0xb, ErrPayloadTooLarge},
+		{"no answer", 10, 0xb, ErrTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := radio.SendPayload(make([]byte, tt.size), tt.to, 0); !errors.Is(err, tt.want) {
+				t.Errorf("SendPayload = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if err := radio.SendPayload([]byte("everyone"), 0, 0); err == nil {
+		t.Error("SendPayload to a broadcast succeeded")
+	}
+}
+
+func TestPartialPayloadTimeout(t *testing.T) {
+	const sender = 0x42
+
+	radio, device := chunkRadio(t, 0xb)
+	payloads := radio.Payloads()
+
+	// The sender disappears after chunks 0 and 2 of 3
+	for _, chunk := range splitPayload(9, make([]byte, 2*chunkSize+1)) {
+		if chunk.ChunkIndex == 1 {
+			continue
+		}
+		payload, err := proto.Marshal(chunk)
+		if err != nil {
+			t.Fatalf("Error marshalling chunk: %v", err)
+		}
+		device.push(&pb.FromRadio{PayloadVariant: &pb.FromRadio_Packet{Packet: &pb.MeshPacket{
+			Id:             newPacketID(),
+			From:           sender,
+			To:             0xb,
+			PayloadVariant: &pb.MeshPacket_Decoded{Decoded: &pb.Data{Portnum: ChunkPort, Payload: payload}},
+		}}})
+	}
+
+	// The last chunk makes the receiver ask for the one it missed
+	waitForToRadio(t, device, func(toRadio *pb.ToRadio) bool {
+		response := &pb.ChunkedPayloadResponse{}
+		packet := toRadio.GetPacket()
+		if packet.GetDecoded().GetPortnum() != ChunkControlPort || packet.GetTo() != sender {
+			return false
+		}
+		if err := proto.Unmarshal(packet.GetDecoded().GetPayload(), response); err != nil {
+			return false
+		}
+		missing := response.GetResendChunks().GetChunks()
+		return response.GetPayloadId() == 9 && len(missing) == 1 && missing[0] == 1
+	})
+
+	// Without an answer the transfer is dropped and nothing is delivered
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		radio.chunks.mu.Lock()
+		remaining := len(radio.chunks.incoming)
+		radio.chunks.mu.Unlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the partial transfer to be dropped")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	select {
+	case payload := <-payloads:
+		t.Errorf("Partial payload delivered: %+v", payload)
+	default:
+	}
+}
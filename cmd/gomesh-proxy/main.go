@@ -0,0 +1,55 @@
+// Command gomesh-proxy shares one radio with many stream API clients over TCP.
+//
+//	gomesh-proxy -port /dev/ttyUSB0 -listen :4403 -metrics :9464
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+
+	gomesh "github.com/b7r-dev/goMesh"
+)
+
+func main() {
+	port := flag.String("port", "", "radio address: serial port, IP address or connection URI")
+	listen := flag.String("listen", ":4403", "address to accept clients on")
+	metrics := flag.String("metrics", "", "address to serve Prometheus metrics on at /metrics, off if empty")
+	flag.Parse()
+
+	if *port == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	radio := gomesh.Radio{Reconnect: &gomesh.ReconnectPolicy{}}
+	if err := radio.Init(*port); err != nil {
+		log.Fatalf("Error connecting to radio: %v", err)
+	}
+	defer radio.Close()
+
+	proxy := gomesh.NewProxyServer(&radio)
+
+	if *metrics != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", gomesh.MetricsHandler(&radio))
+		go func() {
+			if err := http.ListenAndServe(*metrics, mux); err != nil {
+				log.Fatalf("Error serving metrics: %v", err)
+			}
+		}()
+	}
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		<-signals
+		proxy.Close()
+	}()
+
+	if err := proxy.ListenAndServe(*listen); err != nil {
+		log.Fatalf("Error serving: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package gomesh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// frameReadSize is the number of bytes requested from the underlying reader per read
+const frameReadSize = 1024
+
+// maxTextChunk is the amount of console text buffered before it is returned without a newline
+const maxTextChunk = 4096
+
+// FrameKind identifies what a Frame read from the stream carries
+type FrameKind int
+
+const (
+	FrameProtobuf FrameKind = iota // An encoded FromRadio or ToRadio protobuf
+	FrameText                      // Console output interleaved with the protobuf stream
+)
+
+// Frame is one unit read from a Meshtastic stream
+type Frame struct {
+	Kind FrameKind
+
+	// Payload holds the protobuf bytes without the four byte header, or the raw console text
+	// including any line ending
+	Payload []byte
+}
+
+// Raw returns the frame as it appeared on the wire
+func (f Frame) Raw() []byte {
+	if f.Kind != FrameProtobuf {
+		return f.Payload
+	}
+	raw, _ := EncodeFrame(f.Payload)
+	return raw
+}
+
+// FrameStats counts what a FrameReader has seen on the stream
+type FrameStats struct {
+	Bytes        int // Bytes read from the underlying reader
+	Frames       int // Protobuf frames returned
+	TextChunks   int // Console text chunks returned
+	Resyncs      int // Times a bad header forced a search for the next start byte
+	DroppedBytes int // Bytes discarded while resyncing
+}
+
+// sub returns the counts added since earlier
+func (s FrameStats) sub(earlier FrameStats) FrameStats {
+	return FrameStats{
+		Bytes:        s.Bytes - earlier.Bytes,
+		Frames:       s.Frames - earlier.Frames,
+		TextChunks:   s.TextChunks - earlier.TextChunks,
+		Resyncs:      s.Resyncs - earlier.Resyncs,
+		DroppedBytes: s.DroppedBytes - earlier.DroppedBytes,
+	}
+}
+
+// FrameReader splits a Meshtastic stream into protobuf frames and console text. Each frame is
+// START1 (0x94), START2 (0xc3), a 16 bit big endian payload length and the payload. Bytes
+// outside of frames are returned as text, split at newlines. A header announcing more than
+// 512 bytes is treated as garbage and skipped. A FrameReader is not safe for concurrent use.
+type FrameReader struct {
+	r     io.Reader
+	buf   []byte
+	text  []byte
+	err   error
+	stats FrameStats
+}
+
+// NewFrameReader returns a FrameReader reading from r
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{r: r}
+}
+
+// Stats returns the counters collected so far
+func (fr *FrameReader) Stats() FrameStats {
+	return fr.stats
+}
+
+// ReadFrame returns the next frame from the stream. When the underlying reader returns no
+// data, pending console text is returned before the read's error, if any. Errors such as
+// os.ErrDeadlineExceeded leave the reader usable, so the caller can simply call again.
+func (fr *FrameReader) ReadFrame() (Frame, error) {
+	for {
+		if frame, ok := fr.next(); ok {
+			return frame, nil
+		}
+
+		if fr.err != nil {
+			err := fr.err
+			fr.err = nil
+			if frame, ok := fr.flushText(); ok {
+				fr.err = err
+				return frame, nil
+			}
+			return Frame{}, err
+		}
+
+		chunk := make([]byte, frameReadSize)
+		n, err := fr.r.Read(chunk)
+		fr.buf = append(fr.buf, chunk[:n]...)
+		fr.stats.Bytes += n
+		fr.err = err
+
+		if n == 0 && err == nil {
+			// The line is idle, so any console output collected so far is complete
+			if frame, ok := fr.flushText(); ok {
+				return frame, nil
+			}
+		}
+	}
+}
+
+// next parses buffered bytes, returning a frame once one is complete
+func (fr *FrameReader) next() (Frame, bool) {
+	if frame, ok := fr.textLine(); ok {
+		return frame, true
+	}
+
+	for len(fr.buf) > 0 {
+		if fr.buf[0] != start1 {
+			// Console text runs up to the next possible header
+			end := bytes.IndexByte(fr.buf, start1)
+			if end < 0 {
+				end = len(fr.buf)
+			}
+			fr.text = append(fr.text, fr.buf[:end]...)
+			fr.buf = fr.buf[end:]
+
+			if frame, ok := fr.textLine(); ok {
+				return frame, true
+			}
+			continue
+		}
+
+		if len(fr.buf) < 2 {
+			return Frame{}, false
+		}
+		if fr.buf[1] != start2 {
+			// A lone START1 is just a text byte
+			fr.text = append(fr.text, fr.buf[0])
+			fr.buf = fr.buf[1:]
+			continue
+		}
+
+		// Text that came before the header is returned first
+		if frame, ok := fr.flushText(); ok {
+			return frame, true
+		}
+
+		if len(fr.buf) < headerLen {
+			return Frame{}, false
+		}
+
+		length := int(fr.buf[2])<<8 | int(fr.buf[3])
+		if length > maxToFromRadioSzie {
+			defaultLogger().Debug("frame header announces oversized payload, resyncing", "bytes", length)
+			fr.stats.Resyncs++
+			fr.stats.DroppedBytes++
+			fr.buf = fr.buf[1:]
+			continue
+		}
+
+		if len(fr.buf) < headerLen+length {
+			return Frame{}, false
+		}
+
+		payload := make([]byte, length)
+		copy(payload, fr.buf[headerLen:])
+		fr.buf = fr.buf[headerLen+length:]
+		fr.stats.Frames++
+
+		return Frame{Kind: FrameProtobuf, Payload: payload}, true
+	}
+
+	// Keep the buffer from growing once it has been consumed
+	fr.buf = nil
+
+	return Frame{}, false
+}
+
+// textLine returns the first complete line of console text, or a chunk if the text has grown too long
+func (fr *FrameReader) textLine() (Frame, bool) {
+	end := bytes.IndexByte(fr.text, '\n')
+	if end < 0 {
+		if len(fr.text) < maxTextChunk {
+			return Frame{}, false
+		}
+		return fr.flushText()
+	}
+
+	line := make([]byte, end+1)
+	copy(line, fr.text)
+	fr.text = fr.text[end+1:]
+	fr.stats.TextChunks++
+
+	return Frame{Kind: FrameText, Payload: line}, true
+}
+
+// flushText returns all pending console text
+func (fr *FrameReader) flushText() (Frame, bool) {
+	if len(fr.text) == 0 {
+		return Frame{}, false
+	}
+
+	text := fr.text
+	fr.text = nil
+	fr.stats.TextChunks++
+
+	return Frame{Kind: FrameText, Payload: text}, true
+}
+
+// EncodeFrame prefixes a protobuf payload with the stream header
+func EncodeFrame(payload []byte) ([]byte, error) {
+	if len(payload) > maxToFromRadioSzie {
+		return nil, fmt.Errorf("%w: %d > %d bytes", ErrPayloadTooLarge, len(payload), maxToFromRadioSzie)
+	}
+
+	frame := make([]byte, headerLen, headerLen+len(payload))
+	frame[0] = start1
+	frame[1] = start2
+	frame[2] = byte(len(payload) >> 8)
+	frame[3] = byte(len(payload))
+
+	return append(frame, payload...), nil
+}
+
+// FrameWriter writes protobuf payloads to a Meshtastic stream, one frame per write
+type FrameWriter struct {
+	w io.Writer
+}
+
+// NewFrameWriter returns a FrameWriter writing to w
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: w}
+}
+
+// WriteFrame writes payload as a single frame
+func (fw *FrameWriter) WriteFrame(payload []byte) error {
+	frame, err := EncodeFrame(payload)
+	if err != nil {
+		return err
+	}
+
+	n, err := fw.w.Write(frame)
+	if err == nil && n < len(frame) {
+		err = io.ErrShortWrite
+	}
+
+	return err
+}
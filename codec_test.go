@@ -0,0 +1,169 @@
+package gomesh
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// encodeTestFrame marshals fromRadio into a framed byte slice
+func encodeTestFrame(t *testing.T, fromRadio *pb.FromRadio) []byte {
+	t.Helper()
+
+	out, err := proto.Marshal(fromRadio)
+	if err != nil {
+		t.Fatalf("Error marshaling: %v", err)
+	}
+	frame, err := EncodeFrame(out)
+	if err != nil {
+		t.Fatalf("Error encoding frame: %v", err)
+	}
+
+	return frame
+}
+
+// readAllFrames reads frames until the reader returns an error
+func readAllFrames(t *testing.T, fr *FrameReader) []Frame {
+	t.Helper()
+
+	var frames []Frame
+	for {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			return frames
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func TestFrameReader(t *testing.T) {
+	long := encodeTestFrame(t, textPacket(1, 0, strings.Repeat("x", 300)))
+	short := encodeTestFrame(t, textPacket(1, 0, "hi"))
+
+	tests := []struct {
+		name     string
+		stream   []byte
+		kinds    []FrameKind
+		resyncs  int
+		lastText string
+	}{
+		{
+			name:   "Frame longer than 255 bytes",
+			stream: long,
+			kinds:  []FrameKind{FrameProtobuf},
+		},
+		{
+			name:     "Text between frames",
+			stream:   bytes.Join([][]byte{[]byte("DEBUG | 12:23:47 boot\r\n"), short, []byte("INFO | done\n"), short}, nil),
+			kinds:    []FrameKind{FrameText, FrameProtobuf, FrameText, FrameProtobuf},
+			lastText: "INFO | done\n",
+		},
+		{
+			name:    "Oversized header resyncs",
+			stream:  append([]byte{start1, start2, 0xff, 0xff}, short...),
+			kinds:   []FrameKind{FrameText, FrameProtobuf},
+			resyncs: 1,
+		},
+		{
+			name:     "Lone start byte is text",
+			stream:   append([]byte{start1, 'o', 'k', '\n'}, short...),
+			kinds:    []FrameKind{FrameText, FrameProtobuf},
+			lastText: "\x94ok\n",
+		},
+		{
+			name:     "Trailing text without newline",
+			stream:   append(short, []byte("partial")...),
+			kinds:    []FrameKind{FrameProtobuf, FrameText},
+			lastText: "partial",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One byte at a time exercises headers and payloads split across reads
+			fr := NewFrameReader(iotest.OneByteReader(bytes.NewReader(tt.stream)))
+			frames := readAllFrames(t, fr)
+
+			if len(frames) != len(tt.kinds) {
+				t.Fatalf("Expected %d frames, got %d: %q", len(tt.kinds), len(frames), frames)
+			}
+
+			lastText := ""
+			for i, frame := range frames {
+				if frame.Kind != tt.kinds[i] {
+					t.Errorf("Frame %d: expected kind %v, got %v", i, tt.kinds[i], frame.Kind)
+				}
+				if frame.Kind == FrameText {
+					lastText = string(frame.Payload)
+					continue
+				}
+				fromRadio := &pb.FromRadio{}
+				if err := proto.Unmarshal(frame.Payload, fromRadio); err != nil {
+					t.Errorf("Frame %d: error decoding: %v", i, err)
+				}
+				if !bytes.Contains(tt.stream, frame.Raw()) {
+					t.Errorf("Frame %d: raw bytes not found in stream", i)
+				}
+			}
+
+			if tt.lastText != "" && lastText != tt.lastText {
+				t.Errorf("Expected last text %q, got %q", tt.lastText, lastText)
+			}
+			if stats := fr.Stats(); stats.Resyncs != tt.resyncs {
+				t.Errorf("Expected %d resyncs, got %d", tt.resyncs, stats.Resyncs)
+			}
+		})
+	}
+}
+
+func TestFrameWriterRoundTrip(t *testing.T) {
+	var stream bytes.Buffer
+	fw := NewFrameWriter(&stream)
+
+	payloads := [][]byte{[]byte("a"), bytes.Repeat([]byte{0x42}, maxToFromRadioSzie)}
+	for _, payload := range payloads {
+		if err := fw.WriteFrame(payload); err != nil {
+			t.Fatalf("Error writing frame: %v", err)
+		}
+	}
+
+	if err := fw.WriteFrame(make([]byte, maxToFromRadioSzie+1)); err == nil {
+		t.Errorf("Expected error for oversized payload")
+	}
+
+	frames := readAllFrames(t, NewFrameReader(&stream))
+	if len(frames) != len(payloads) {
+		t.Fatalf("Expected %d frames, got %d", len(payloads), len(frames))
+	}
+	for i, frame := range frames {
+		if !bytes.Equal(frame.Payload, payloads[i]) {
+			t.Errorf("Frame %d: payload mismatch", i)
+		}
+	}
+}
+
+func TestDecodeResponses(t *testing.T) {
+	frame := Frame{Kind: FrameProtobuf, Payload: encodeTestFrame(t, textPacket(1, 0, "hi"))[headerLen:]}
+
+	responses := decodeResponses(defaultLogger(), frame)
+	if len(responses) != 1 || responses[0].Type != ResponseTypeProtobuf {
+		t.Fatalf("Expected one protobuf response, got %+v", responses)
+	}
+	if string(responses[0].ProtobufMsg.GetPacket().GetDecoded().GetPayload()) != "hi" {
+		t.Errorf("Unexpected payload: %v", responses[0].ProtobufMsg)
+	}
+
+	responses = decodeResponses(defaultLogger(), Frame{Kind: FrameText, Payload: []byte("DEBUG | 12:23:47 67 [Router] Received packet\r\n")})
+	if len(responses) != 1 || responses[0].TextData != "DEBUG | 12:23:47 67 [Router] Received packet" {
+		t.Errorf("Unexpected text responses: %+v", responses)
+	}
+}
@@ -0,0 +1,138 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+func TestConcurrentUse(t *testing.T) {
+	const workers = 8
+	const textsPerWorker = 5
+	const adminPerWorker = 3
+
+	device := newFakeDevice(t, 0x11)
+
+	radio := Radio{}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	// Every frame the device managed to parse is counted, so an interleaved write shows up as
+	// a missing message
+	var texts int
+	adminIDs := make(map[string]bool)
+	stop := make(chan struct{})
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for {
+			select {
+			case toRadio := <-device.received:
+				decoded := toRadio.GetPacket().GetDecoded()
+				switch decoded.GetPortnum() {
+				case pb.PortNum_TEXT_MESSAGE_APP:
+					texts++
+				case pb.PortNum_ADMIN_APP:
+					adminIDs[fmt.Sprintf("owner-%d", toRadio.GetPacket().Id)] = true
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	owners := make(map[string]bool)
+	errs := make(chan error, workers*(textsPerWorker+adminPerWorker+1))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < textsPerWorker; i++ {
+				if _, err := radio.SendTextMessage(fmt.Sprintf("worker %d message %d", w, i), 0, 0); err != nil {
+					errs <- err
+				}
+			}
+
+			if _, err := radio.Handshake(HandshakeOptions{}); err != nil {
+				errs <- fmt.Errorf("handshake: %w", err)
+			}
+
+			for i := 0; i < adminPerWorker; i++ {
+				answer, err := radio.AdminRequest(&pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetOwnerRequest{GetOwnerRequest: true}})
+				if err != nil {
+					errs <- fmt.Errorf("admin request: %w", err)
+					continue
+				}
+				name := answer.GetGetOwnerResponse().GetLongName()
+				mu.Lock()
+				if owners[name] {
+					errs <- fmt.Errorf("answer %s delivered twice", name)
+				}
+				owners[name] = true
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Give the device time to read the last frames
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	<-drained
+
+	if texts != workers*textsPerWorker {
+		t.Errorf("Expected the device to parse %d text messages, got %d", workers*textsPerWorker, texts)
+	}
+	if len(owners) != workers*adminPerWorker {
+		t.Errorf("Expected %d distinct admin answers, got %d", workers*adminPerWorker, len(owners))
+	}
+	for name := range owners {
+		if !adminIDs[name] {
+			t.Errorf("Answer %s does not match any request the device received", name)
+		}
+	}
+}
+
+func TestAdminRequestTimeout(t *testing.T) {
+	device := newFakeDevice(t, 0x11)
+
+	radio := Radio{}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	// The fake device only answers GetOwnerRequest
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err := radio.AdminRequestContext(ctx, &pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetChannelRequest{GetChannelRequest: 1}})
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected a timeout wrapping deadline exceeded, got %v", err)
+	}
+
+	// A late or unrelated answer must not reach the next request
+	answer, err := radio.AdminRequest(&pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetOwnerRequest{GetOwnerRequest: true}})
+	if err != nil {
+		t.Fatalf("Error in admin request: %v", err)
+	}
+	if answer.GetGetOwnerResponse() == nil {
+		t.Errorf("Expected an owner response, got %v", answer)
+	}
+}
@@ -1,6 +1,7 @@
 package gomesh
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"strconv"
@@ -11,8 +12,13 @@ import (
 
 // GetRadioConfig returns a filtered list of raiod and module config settings
 func (r *Radio) GetRadioConfig() (configPackets []*pb.FromRadio_Config, modulePackets []*pb.FromRadio_ModuleConfig, err error) {
+	return r.GetRadioConfigContext(context.Background())
+}
+
+// GetRadioConfigContext returns the radio and module config, giving up when ctx is done
+func (r *Radio) GetRadioConfigContext(ctx context.Context) (configPackets []*pb.FromRadio_Config, modulePackets []*pb.FromRadio_ModuleConfig, err error) {
 
-	configResponses, err := r.GetRadioInfo()
+	configResponses, err := r.GetRadioInfoContext(ctx)
 	if err != nil {
 		return
 	}
@@ -36,10 +42,15 @@ func (r *Radio) GetRadioConfig() (configPackets []*pb.FromRadio_Config, modulePa
 
 // SetRadioConfig allows an freeform setting of values in the RadioConfig_UserPreferences struct
 func (r *Radio) SetRadioConfig(key string, value string) error {
+	return r.SetRadioConfigContext(context.Background(), key, value)
+}
+
+// SetRadioConfigContext sets a config or module config value, giving up when ctx is done
+func (r *Radio) SetRadioConfigContext(ctx context.Context, key string, value string) error {
 
 	keyFound := false
 
-	configSettings, moduleSettings, err := r.GetRadioConfig()
+	configSettings, moduleSettings, err := r.GetRadioConfigContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -64,7 +75,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -85,7 +96,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -106,7 +117,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -127,7 +138,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -148,7 +159,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -169,7 +180,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -190,7 +201,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -220,7 +231,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -242,7 +253,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -264,7 +275,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -286,7 +297,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -308,7 +319,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -330,7 +341,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -352,7 +363,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -374,7 +385,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -396,7 +407,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -418,7 +429,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -440,7 +451,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -462,7 +473,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -484,7 +495,7 @@ func (r *Radio) SetRadioConfig(key string, value string) error {
 						},
 					},
 				}
-				err = sendAdminMessage(adminMessage, r)
+				err = sendAdminMessage(ctx, &adminMessage, r)
 				if err != nil {
 					return err
 				}
@@ -552,20 +563,20 @@ func setProtoValue(t interface{}, key string, value string) error {
 	return nil
 }
 
-func sendAdminMessage(adminPacket pb.AdminMessage, r *Radio) error {
-	out, err := proto.Marshal(&adminPacket)
+func sendAdminMessage(ctx context.Context, adminPacket *pb.AdminMessage, r *Radio) error {
+	out, err := proto.Marshal(adminPacket)
 	if err != nil {
 		return err
 	}
 
-	nodeNum := r.nodeNum
+	nodeNum := r.GetNodeID()
 
 	packet, err := r.createAdminPacket(nodeNum, out)
 	if err != nil {
 		return err
 	}
 
-	if err := r.sendPacket(packet); err != nil {
+	if err := r.sendPacket(ctx, packet); err != nil {
 		return err
 	}
 
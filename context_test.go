@@ -0,0 +1,86 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// silentTransport returns a transport to a listener that accepts the connection but never answers
+func silentTransport(t *testing.T) Transport {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	transport, err := NewTCPTransport(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+
+	return transport
+}
+
+func TestInitWithTransportContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	radio := Radio{}
+	started := time.Now()
+	err := radio.InitWithTransportContext(ctx, silentTransport(t))
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("Init took %v, expected it to stop at the context deadline", elapsed)
+	}
+}
+
+func TestGetRadioInfoContextCancel(t *testing.T) {
+	device := newFakeDevice(t, 0x77)
+
+	radio := Radio{}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := radio.GetRadioInfoContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if _, err := radio.SendTextMessageContext(ctx, "hello", 0, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled from send, got %v", err)
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	if err := sleepContext(context.Background(), time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sleepContext(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package gomesh
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// ackTimeout is how long a sent packet waits for its ack before it stops being tracked
+const ackTimeout = 5 * time.Minute
+
+// DeliveryState is how far a sent packet has got towards its destination
+type DeliveryState int
+
+const (
+	DeliveryPending     DeliveryState = iota // Handed to the radio, no answer from the mesh yet
+	DeliveryAcked                            // The destination acknowledged the packet
+	DeliveryImplicitAck                      // A neighbour was heard relaying the packet; final for a broadcast, a direct message still waits for its destination
+	DeliveryFailed                           // The mesh rejected the packet, or it never got an answer
+	DeliveryRetrying                         // An attempt failed and the Retry policy will send the packet again
+)
+
+func (s DeliveryState) String() string {
+	switch s {
+	case DeliveryPending:
+		return "pending"
+	case DeliveryAcked:
+		return "acked"
+	case DeliveryImplicitAck:
+		return "implicit ack"
+	case DeliveryFailed:
+		return "failed"
+	case DeliveryRetrying:
+		return "retrying"
+	}
+	return fmt.Sprintf("DeliveryState(%d)", int(s))
+}
+
+// DeliveryEvent reports a change in the delivery state of a sent packet
+type DeliveryEvent struct {
+	PacketID  uint32 // The SentPacket's ID
+	AttemptID uint32 // The id of the packet sent for the current attempt
+	Attempt   int    // The attempt number, starting at 1
+	To        uint32
+	State     DeliveryState
+	Err       error // Why the attempt failed, a *RoutingError when the mesh rejected it
+	Time      time.Time
+}
+
+// SentPacket tracks a packet sent with an ack requested until the mesh answers it
+type SentPacket struct {
+	ID uint32 // The id of the first packet sent. Retries go out under new ids
+	To uint32 // The destination node number, broadcastNum for broadcasts
+
+	mu      sync.Mutex
+	state   DeliveryState
+	err     error
+	attempt int
+	done    chan struct{}
+
+	// Guarded by the radio's subsMu
+	packet    *pb.MeshPacket
+	attemptID uint32
+	timer     *time.Timer
+}
+
+// Done returns a channel closed once the packet has been acked or has failed
+func (p *SentPacket) Done() <-chan struct{} {
+	return p.done
+}
+
+// State returns the current delivery state without waiting
+func (p *SentPacket) State() DeliveryState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.state
+}
+
+// Attempts returns the number of times the packet has been sent
+func (p *SentPacket) Attempts() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.attempt
+}
+
+// Wait waits until the packet is acked or has failed, including any retries. A broadcast is
+// done once it is implicitly acked; a direct message waits for its destination. A failed packet
+// returns DeliveryFailed and the reason, a *RoutingError when the mesh rejected it. When ctx is
+// done first Wait returns DeliveryPending and the context's error; the packet is still tracked
+func (p *SentPacket) Wait(ctx context.Context) (DeliveryState, error) {
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return DeliveryPending, contextError(ctx)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.state, p.err
+}
+
+// DeliveryEvents returns a channel of delivery state changes for every packet sent with a
+// SentPacket handle. Each call returns a new channel, closed when the radio is closed
+func (r *Radio) DeliveryEvents() <-chan DeliveryEvent {
+	return r.deliveries.subscribe()
+}
+
+// sendTracked sends a packet wanting an ack and returns the handle tracking its delivery
+func (r *Radio) sendTracked(ctx context.Context, packet *pb.MeshPacket) (*SentPacket, error) {
+	out, err := proto.Marshal(&pb.ToRadio{PayloadVariant: &pb.ToRadio_Packet{Packet: packet}})
+	if err != nil {
+		return nil, err
+	}
+
+	sent, err := r.trackDelivery(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.sendPacket(ctx, out); err != nil {
+		r.failDelivery(sent, err)
+		return nil, err
+	}
+
+	return sent, nil
+}
+
+// trackDelivery starts tracking a packet before it is sent, so an ack cannot arrive first
+func (r *Radio) trackDelivery(packet *pb.MeshPacket) (*SentPacket, error) {
+	sent := &SentPacket{ID: packet.Id, To: packet.To, done: make(chan struct{}), packet: packet}
+
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	if r.sent == nil {
+		return nil, ErrNotConnected
+	}
+	r.startAttempt(sent, packet.Id)
+
+	return sent, nil
+}
+
+// startAttempt tracks sent under the id of its next attempt. The caller holds subsMu
+func (r *Radio) startAttempt(sent *SentPacket, id uint32) {
+	sent.attemptID = id
+	r.sent[id] = sent
+
+	sent.mu.Lock()
+	sent.attempt++
+	attempt := sent.attempt
+	sent.mu.Unlock()
+
+	// The firmware gives up on a packet well within ackTimeout, this only stops a lost answer
+	// from leaking the handle
+	sent.timer = time.AfterFunc(ackTimeout, func() {
+		r.subsMu.Lock()
+		defer r.subsMu.Unlock()
+
+		if r.sent[id] == sent {
+			r.finishDelivery(sent, DeliveryFailed, fmt.Errorf("%w: %w", ErrNoAck, ErrTimeout))
+		}
+	})
+
+	r.publishDelivery(sent, attempt, DeliveryPending, nil)
+}
+
+// publishDelivery reports a delivery state change. The caller holds subsMu
+func (r *Radio) publishDelivery(sent *SentPacket, attempt int, state DeliveryState, err error) {
+	r.deliveries.publish(DeliveryEvent{
+		PacketID:  sent.ID,
+		AttemptID: sent.attemptID,
+		Attempt:   attempt,
+		To:        sent.To,
+		State:     state,
+		Err:       err,
+		Time:      time.Now(),
+	})
+}
+
+// failDelivery marks a tracked packet that could not be sent as failed
+func (r *Radio) failDelivery(sent *SentPacket, err error) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	if r.sent[sent.attemptID] == sent {
+		r.finishDelivery(sent, DeliveryFailed, err)
+	}
+}
+
+// finishDelivery stops tracking a packet and records how it ended. The caller holds subsMu
+func (r *Radio) finishDelivery(sent *SentPacket, state DeliveryState, err error) {
+	delete(r.sent, sent.attemptID)
+	sent.timer.Stop()
+
+	sent.mu.Lock()
+	sent.state = state
+	sent.err = err
+	attempt := sent.attempt
+	sent.mu.Unlock()
+	close(sent.done)
+
+	r.publishDelivery(sent, attempt, state, err)
+	r.log().Debug("packet delivery finished", "packet_id", sent.ID, "to", sent.To, "attempt", attempt, "state", state.String(), "err", err)
+}
+
+// deliverAck resolves the tracked packet a routing packet answers, if any. An answer from the
+// destination is an ack; one from any other node, normally our own radio hearing the packet
+// relayed, is an implicit ack. That ends a broadcast, but a direct message stays tracked until
+// its destination acks it, the mesh gives up on it or ackTimeout passes. The caller holds subsMu
+func (r *Radio) deliverAck(packet *pb.MeshPacket) {
+	decoded := packet.GetDecoded()
+	if decoded.GetPortnum() != pb.PortNum_ROUTING_APP || decoded.GetRequestId() == 0 {
+		return
+	}
+
+	sent, ok := r.sent[decoded.GetRequestId()]
+	if !ok {
+		return
+	}
+
+	routing := &pb.Routing{}
+	if err := proto.Unmarshal(decoded.GetPayload(), routing); err != nil {
+		r.log().Debug("could not decode routing answer", packetAttrs(packet, "err", err)...)
+		return
+	}
+
+	switch err := routingError(sent.attemptID, routing); {
+	case err != nil:
+		if !r.retryDelivery(sent, err) {
+			r.finishDelivery(sent, DeliveryFailed, err)
+		}
+	case packet.GetFrom() == sent.To:
+		r.finishDelivery(sent, DeliveryAcked, nil)
+	case sent.To == broadcastNum:
+		r.finishDelivery(sent, DeliveryImplicitAck, nil)
+	default:
+		sent.mu.Lock()
+		sent.state = DeliveryImplicitAck
+		attempt := sent.attempt
+		sent.mu.Unlock()
+
+		r.publishDelivery(sent, attempt, DeliveryImplicitAck, nil)
+	}
+}
+
+// failDeliveries fails every packet still waiting for an answer when the radio stops reading.
+// The caller holds subsMu
+func (r *Radio) failDeliveries() {
+	for _, sent := range r.sent {
+		r.finishDelivery(sent, DeliveryFailed, errRadioClosed)
+	}
+}
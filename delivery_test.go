@@ -0,0 +1,143 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// waitForDeliveryState polls until sent reaches state
+func waitForDeliveryState(t *testing.T, sent *SentPacket, state DeliveryState) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sent.State() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s, have %s", state, sent.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSentPacketWait(t *testing.T) {
+	const self, other = 0x1234, 0x5678
+
+	device := newFakeDevice(t, self)
+	radio := &Radio{HeartbeatInterval: -1}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	events := radio.DeliveryEvents()
+
+	type answer struct {
+		from   uint32
+		reason pb.Routing_Error
+	}
+	relayed := answer{self, pb.Routing_NONE}
+
+	tests := []struct {
+		name    string
+		to      int64
+		answers []answer
+		events  []DeliveryState // After pending
+		err     error
+	}{
+		{"acked by destination", other, []answer{{other, pb.Routing_NONE}}, []DeliveryState{DeliveryAcked}, nil},
+		{"relayed broadcast", 0, []answer{relayed}, []DeliveryState{DeliveryImplicitAck}, nil},
+		{"relayed then acked", other, []answer{relayed, {other, pb.Routing_NONE}}, []DeliveryState{DeliveryImplicitAck, DeliveryAcked}, nil},
+		{"relayed then lost", other, []answer{relayed, {self, pb.Routing_MAX_RETRANSMIT}}, []DeliveryState{DeliveryImplicitAck, DeliveryFailed}, ErrNoAck},
+		{"no route", other, []answer{{self, pb.Routing_NO_ROUTE}}, []DeliveryState{DeliveryFailed}, &RoutingError{Reason: pb.Routing_NO_ROUTE}},
+		{"never acked", other, []answer{{self, pb.Routing_MAX_RETRANSMIT}}, []DeliveryState{DeliveryFailed}, ErrNoAck},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent, err := radio.SendTextMessage("hello", tt.to, 0)
+			if err != nil {
+				t.Fatalf("Error sending: %v", err)
+			}
+			if sent.State() != DeliveryPending {
+				t.Errorf("State before the answer = %s, want pending", sent.State())
+			}
+
+			for i, a := range tt.answers {
+				reply := routingAnswer(t, sent.ID, a.reason)
+				reply.GetPacket().From = a.from
+				device.push(reply)
+
+				// A relayed direct message is not done until its destination answers
+				if i < len(tt.answers)-1 {
+					waitForDeliveryState(t, sent, tt.events[i])
+					select {
+					case <-sent.Done():
+						t.Fatalf("Delivery finished after answer %d with %s", i+1, sent.State())
+					case <-time.After(50 * time.Millisecond):
+					}
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			state, err := sent.Wait(ctx)
+			if want := tt.events[len(tt.events)-1]; state != want {
+				t.Errorf("Wait state = %s, want %s", state, want)
+			}
+			switch want := tt.err.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("Wait error = %v, want none", err)
+				}
+			case *RoutingError:
+				var routingErr *RoutingError
+				if !errors.As(err, &routingErr) || routingErr.Reason != want.Reason || routingErr.PacketID != sent.ID {
+					t.Errorf("Wait error = %v, want a %s routing error for packet %d", err, want.Reason, sent.ID)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Errorf("Wait error = %v, want %v", err, want)
+				}
+			}
+
+			// Every packet reports pending, then each change
+			for _, want := range append([]DeliveryState{DeliveryPending}, tt.events...) {
+				select {
+				case event := <-events:
+					if event.PacketID != sent.ID || event.State != want {
+						t.Errorf("Event = %+v, want packet %d %s", event, sent.ID, want)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatalf("Timed out waiting for the %s event", want)
+				}
+			}
+		})
+	}
+
+	t.Run("wait timeout", func(t *testing.T) {
+		sent, err := radio.SendTextMessage("hello", other, 0)
+		if err != nil {
+			t.Fatalf("Error sending: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if state, err := sent.Wait(ctx); state != DeliveryPending || !errors.Is(err, ErrTimeout) {
+			t.Errorf("Wait = %s, %v, want pending and ErrTimeout", state, err)
+		}
+
+		// Closing the radio gives up on packets still waiting
+		radio.Close()
+		select {
+		case <-sent.Done():
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for the packet to fail on close")
+		}
+		if state, err := sent.Wait(context.Background()); state != DeliveryFailed || !errors.Is(err, ErrNotConnected) {
+			t.Errorf("Wait after Close = %s, %v, want failed and ErrNotConnected", state, err)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// DeviceLogEntry is one line of the radio's own log, taken either from a LogRecord frame or
+// from console text such as "DEBUG | 12:34:56 67 [Router] Received routing from 0x1234"
+type DeviceLogEntry struct {
+	Level   pb.LogRecord_Level
+	Time    time.Time // Zero when the radio does not know the time
+	Source  string    // The firmware module or thread, e.g. "Router", if given
+	Message string
+	Raw     string // The console line as received, empty for LogRecord frames
+}
+
+// consoleLinePattern matches the firmware's console log format: level, time of day (or
+// ??:??:?? before the clock is set), optional uptime in seconds, optional [Source] and message
+var consoleLinePattern = regexp.MustCompile(`^(CRIT(?:ICAL)?|ERROR|WARN(?:ING)?|INFO|DEBUG|TRACE)\s*\|\s*(\d{1,2}:\d{2}:\d{2}|\?\?:\?\?:\?\?)?\s*(\d+)?\s*(?:\[([^\]]*)\]\s*)?(.*)$`)
+
+// consoleLevels maps the level names printed on the console to LogRecord levels
+var consoleLevels = map[string]pb.LogRecord_Level{
+	"CRIT":     pb.LogRecord_CRITICAL,
+	"CRITICAL": pb.LogRecord_CRITICAL,
+	"ERROR":    pb.LogRecord_ERROR,
+	"WARN":     pb.LogRecord_WARNING,
+	"WARNING":  pb.LogRecord_WARNING,
+	"INFO":     pb.LogRecord_INFO,
+	"DEBUG":    pb.LogRecord_DEBUG,
+	"TRACE":    pb.LogRecord_TRACE,
+}
+
+// Logs returns a channel of the radio's log output. Each call returns a new channel, closed when
+// the radio is closed. Serial radios print their log on the console; over other links, and to
+// get structured records on serial too, enable it with SetDebugLogAPI
+func (r *Radio) Logs() <-chan DeviceLogEntry {
+	return r.logs.subscribe()
+}
+
+// publishLog hands a response that carries log output to the Logs listeners
+func (r *Radio) publishLog(response *RadioResponse) {
+	switch response.Type {
+	case ResponseTypeText:
+		// Other text the radio prints, such as a boot banner, is not a log line
+		if isConsoleLine(response.TextData) {
+			r.logs.publish(parseConsoleLine(response.TextData, time.Now()))
+		}
+	case ResponseTypeProtobuf:
+		if record := response.ProtobufMsg.GetLogRecord(); record != nil {
+			r.logs.publish(logEntryFromRecord(record))
+		}
+	}
+}
+
+// logEntryFromRecord converts a LogRecord frame
+func logEntryFromRecord(record *pb.LogRecord) DeviceLogEntry {
+	entry := DeviceLogEntry{
+		Level:   record.GetLevel(),
+		Source:  record.GetSource(),
+		Message: strings.TrimRight(record.GetMessage(), "\r\n"),
+	}
+	if record.GetTime() != 0 {
+		entry.Time = time.Unix(int64(record.GetTime()), 0)
+	}
+
+	return entry
+}
+
+// parseConsoleLine parses a line of console output received at now. The console only shows the
+// time of day, in UTC, so it is placed on the most recent matching day. Lines in an unknown
+// format are returned whole as the message with an unset level
+func parseConsoleLine(line string, now time.Time) DeviceLogEntry {
+	line = strings.TrimSpace(line)
+	entry := DeviceLogEntry{Message: line, Raw: line}
+
+	match := consoleLinePattern.FindStringSubmatch(line)
+	if match == nil {
+		return entry
+	}
+
+	entry.Level = consoleLevels[match[1]]
+	entry.Source = match[4]
+	entry.Message = match[5]
+
+	if clock, err := time.Parse("15:04:05", match[2]); err == nil {
+		now = now.UTC()
+		logged := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.UTC)
+		// A line logged just before midnight and read just after belongs to yesterday
+		if logged.After(now.Add(time.Hour)) {
+			logged = logged.AddDate(0, 0, -1)
+		}
+		entry.Time = logged
+	}
+
+	return entry
+}
+
+// SetDebugLogAPI turns the firmware's debug_log_api_enabled setting on or off
+func (r *Radio) SetDebugLogAPI(enabled bool) error {
+	return r.SetDebugLogAPIContext(context.Background(), enabled)
+}
+
+// SetDebugLogAPIContext turns the firmware's debug_log_api_enabled setting on or off. While it is
+// on the radio sends its log as LogRecord frames, which show up on Logs, instead of printing it
+// on the serial console. The current security config is read first so the other security
+// settings are written back unchanged
+func (r *Radio) SetDebugLogAPIContext(ctx context.Context, enabled bool) error {
+	answer, err := r.AdminRequestContext(ctx, &pb.AdminMessage{
+		PayloadVariant: &pb.AdminMessage_GetConfigRequest{GetConfigRequest: pb.AdminMessage_SECURITY_CONFIG},
+	})
+	if err != nil {
+		return err
+	}
+
+	security := answer.GetGetConfigResponse().GetSecurity()
+	if security == nil {
+		return errors.New("radio did not return its security config")
+	}
+	security.DebugLogApiEnabled = enabled
+
+	r.log().Info("setting debug log API", "enabled", enabled)
+	adminMessage := pb.AdminMessage{
+		PayloadVariant: &pb.AdminMessage_SetConfig{
+			SetConfig: &pb.Config{
+				PayloadVariant: &pb.Config_Security{
+					Security: security,
+				},
+			},
+		},
+	}
+
+	return sendAdminMessage(ctx, &adminMessage, r)
+}
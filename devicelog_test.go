@@ -0,0 +1,100 @@
+package gomesh
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+func TestParseConsoleLine(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 40, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		line     string
+		expected DeviceLogEntry
+	}{
+		{
+			"Full line",
+			"DEBUG | 12:34:56 67 [Router] Received routing from 0x1234",
+			DeviceLogEntry{Level: pb.LogRecord_DEBUG, Time: time.Date(2024, 5, 1, 12, 34, 56, 0, time.UTC), Source: "Router", Message: "Received routing from 0x1234"},
+		},
+		{
+			"Without uptime",
+			"WARN  | 12:00:01 [SerialConsole] Buffer full",
+			DeviceLogEntry{Level: pb.LogRecord_WARNING, Time: time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC), Source: "SerialConsole", Message: "Buffer full"},
+		},
+		{
+			"Clock not set",
+			"INFO  | ??:??:?? 3 Booting",
+			DeviceLogEntry{Level: pb.LogRecord_INFO, Message: "Booting"},
+		},
+		{
+			"Logged before midnight",
+			"ERROR | 23:59:59 100 [Power] Battery low",
+			DeviceLogEntry{Level: pb.LogRecord_ERROR, Time: time.Date(2024, 4, 30, 23, 59, 59, 0, time.UTC), Source: "Power", Message: "Battery low"},
+		},
+		{
+			"Unknown format",
+			"Send known nodes",
+			DeviceLogEntry{Message: "Send known nodes"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := parseConsoleLine(tt.line, now)
+			tt.expected.Raw = tt.line
+			if entry != tt.expected {
+				t.Errorf("parseConsoleLine(%q) = %+v, expected %+v", tt.line, entry, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLogs(t *testing.T) {
+	device := newFakeDevice(t, 0x11)
+
+	radio := Radio{}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+
+	logs := radio.Logs()
+
+	device.push(&pb.FromRadio{PayloadVariant: &pb.FromRadio_LogRecord{LogRecord: &pb.LogRecord{
+		Message: "Sending packet\n",
+		Time:    1700000000,
+		Source:  "Router",
+		Level:   pb.LogRecord_INFO,
+	}}})
+
+	var entry DeviceLogEntry
+	select {
+	case entry = <-logs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the log record")
+	}
+	if entry.Level != pb.LogRecord_INFO || entry.Source != "Router" || entry.Message != "Sending packet" || entry.Time.Unix() != 1700000000 {
+		t.Errorf("Unexpected entry from LogRecord: %+v", entry)
+	}
+
+	// Text that is not log output is skipped, so the next entry is the console line
+	radio.publishLog(&RadioResponse{Type: ResponseTypeText, TextData: "Booting firmware"})
+	device.pushText("\x1b[34mDEBUG\x1b[0m | 12:23:47 67 [SerialConsole] Send known nodes\r\n")
+
+	select {
+	case entry = <-logs:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the console line")
+	}
+	if entry.Level != pb.LogRecord_DEBUG || entry.Source != "SerialConsole" || entry.Message != "Send known nodes" {
+		t.Errorf("Unexpected entry from console text: %+v", entry)
+	}
+
+	radio.Close()
+	if _, ok := <-logs; ok {
+		t.Error("Expected the log channel to be closed with the radio")
+	}
+}
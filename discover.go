@@ -0,0 +1,155 @@
+package gomesh
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// defaultProbeTimeout bounds the handshake with each candidate port when probing
+const defaultProbeTimeout = 15 * time.Second
+
+// usbID identifies a USB device by vendor and product
+type usbID struct {
+	vendor  uint16
+	product uint16
+}
+
+// knownRadioChips maps the USB IDs used by Meshtastic boards to a description of the chip
+var knownRadioChips = map[usbID]string{
+	{0x10c4, 0xea60}: "Silicon Labs CP210x",
+	{0x1a86, 0x7523}: "WCH CH340",
+	{0x1a86, 0x5523}: "WCH CH341",
+	{0x1a86, 0x55d4}: "WCH CH9102",
+	{0x303a, 0x1001}: "Espressif ESP32-S3 USB JTAG/serial",
+	{0x303a, 0x0002}: "Espressif ESP32-S2/S3 USB CDC",
+	{0x239a, 0x8029}: "nRF52840 (RAK4631)",
+	{0x239a, 0x0029}: "nRF52840 bootloader",
+	{0x239a, 0x4405}: "nRF52840 (T-Echo)",
+	{0x1915, 0x520f}: "Nordic nRF52",
+}
+
+// DiscoveredRadio describes a serial port that looks like a Meshtastic radio
+type DiscoveredRadio struct {
+	Port        string // Device path to pass to Radio.Init, e.g. /dev/ttyUSB0
+	ByID        string // Stable /dev/serial/by-id link to the port, if there is one
+	VendorID    uint16
+	ProductID   uint16
+	Description string // The USB serial chip, when the IDs are known
+
+	// The fields below are only filled in when the port was probed successfully
+	Probed    bool
+	NodeNum   uint32
+	LongName  string
+	ShortName string
+	HwModel   pb.HardwareModel
+}
+
+// DiscoverOptions controls DiscoverRadiosContext
+type DiscoverOptions struct {
+	// Probe opens every candidate and runs the config handshake to read the node number,
+	// owner and hardware model. Ports that do not answer are left out of the results
+	Probe bool
+
+	// ProbeTimeout bounds the handshake with each port. Defaults to fifteen seconds
+	ProbeTimeout time.Duration
+
+	// IncludeUnknown also returns USB serial ports whose vendor and product IDs are not in the
+	// list of chips used by Meshtastic boards. Useful together with Probe
+	IncludeUnknown bool
+
+	// SysfsRoot and DevRoot override /sys and /dev, mainly for tests
+	SysfsRoot string
+	DevRoot   string
+}
+
+// DiscoverRadios lists the serial ports with a USB chip known to be used by Meshtastic radios
+func DiscoverRadios() ([]DiscoveredRadio, error) {
+	return DiscoverRadiosContext(context.Background(), DiscoverOptions{})
+}
+
+// DiscoverRadiosContext lists candidate serial ports and, if requested, probes each one.
+// Serial enumeration is currently supported on Linux only
+func DiscoverRadiosContext(ctx context.Context, opts DiscoverOptions) ([]DiscoveredRadio, error) {
+	if opts.SysfsRoot == "" {
+		opts.SysfsRoot = "/sys"
+	}
+	if opts.DevRoot == "" {
+		opts.DevRoot = "/dev"
+	}
+	if opts.ProbeTimeout <= 0 {
+		opts.ProbeTimeout = defaultProbeTimeout
+	}
+
+	candidates, err := listSerialPorts(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	radios := make([]DiscoveredRadio, 0, len(candidates))
+	for _, candidate := range candidates {
+		description, known := knownRadioChips[usbID{candidate.VendorID, candidate.ProductID}]
+		if !known && !opts.IncludeUnknown {
+			defaultLogger().Debug("discovery skipping port", "port", candidate.Port,
+				"vendor_id", fmt.Sprintf("%04x", candidate.VendorID), "product_id", fmt.Sprintf("%04x", candidate.ProductID))
+			continue
+		}
+		candidate.Description = description
+
+		if opts.Probe {
+			if err := ctx.Err(); err != nil {
+				return radios, err
+			}
+			if err := probeRadio(ctx, &candidate, opts.ProbeTimeout); err != nil {
+				defaultLogger().Info("discovery probe got no answer", "port", candidate.Port, "err", err)
+				continue
+			}
+		}
+
+		radios = append(radios, candidate)
+	}
+
+	return radios, nil
+}
+
+// probeRadio connects to the candidate's port and records who answered the config handshake
+// Init runs, which already carries the radio's own node
+func probeRadio(ctx context.Context, candidate *DiscoveredRadio, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	radio := Radio{}
+	if err := radio.InitContext(ctx, candidate.Port); err != nil {
+		return err
+	}
+	defer radio.Close()
+
+	radio.connMu.Lock()
+	snapshot := radio.ownConfig
+	radio.connMu.Unlock()
+
+	applyIdentity(candidate, snapshot.MyInfo.GetMyNodeNum(), snapshot.Frames)
+	if candidate.NodeNum == 0 {
+		return fmt.Errorf("no node info from %s", candidate.Port)
+	}
+
+	return nil
+}
+
+// applyIdentity fills in the node details of a probed candidate from a config dump
+func applyIdentity(candidate *DiscoveredRadio, nodeNum uint32, responses []*pb.FromRadio) {
+	candidate.Probed = true
+	candidate.NodeNum = nodeNum
+
+	for _, response := range responses {
+		nodeInfo := response.GetNodeInfo()
+		if nodeInfo == nil || nodeInfo.Num != nodeNum {
+			continue
+		}
+		candidate.LongName = nodeInfo.GetUser().GetLongName()
+		candidate.ShortName = nodeInfo.GetUser().GetShortName()
+		candidate.HwModel = nodeInfo.GetUser().GetHwModel()
+	}
+}
@@ -0,0 +1,101 @@
+package gomesh
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// usbAncestorDepth is how far above a tty's device the USB device directory is searched for
+const usbAncestorDepth = 4
+
+// listSerialPorts enumerates USB serial ports from sysfs. Ports without a USB parent, such as
+// the built-in UARTs and virtual consoles, are skipped
+func listSerialPorts(opts DiscoverOptions) ([]DiscoveredRadio, error) {
+	classDir := filepath.Join(opts.SysfsRoot, "class", "tty")
+
+	entries, err := os.ReadDir(classDir)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := serialLinksByID(opts.DevRoot)
+
+	var ports []DiscoveredRadio
+	for _, entry := range entries {
+		name := entry.Name()
+
+		device, err := filepath.EvalSymlinks(filepath.Join(classDir, name, "device"))
+		if err != nil {
+			continue
+		}
+
+		vendor, product, ok := findUSBIDs(device)
+		if !ok {
+			continue
+		}
+
+		ports = append(ports, DiscoveredRadio{
+			Port:      filepath.Join(opts.DevRoot, name),
+			ByID:      byID[name],
+			VendorID:  vendor,
+			ProductID: product,
+		})
+	}
+
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+
+	return ports, nil
+}
+
+// findUSBIDs walks up from a tty's device directory to the USB device that owns it
+func findUSBIDs(dir string) (vendor uint16, product uint16, ok bool) {
+	for i := 0; i < usbAncestorDepth; i++ {
+		vendor, vendorErr := readHexID(filepath.Join(dir, "idVendor"))
+		product, productErr := readHexID(filepath.Join(dir, "idProduct"))
+		if vendorErr == nil && productErr == nil {
+			return vendor, product, true
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	return 0, 0, false
+}
+
+func readHexID(path string) (uint16, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 16)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint16(id), nil
+}
+
+// serialLinksByID maps tty names to their stable links in /dev/serial/by-id
+func serialLinksByID(devRoot string) map[string]string {
+	links := make(map[string]string)
+
+	byIDDir := filepath.Join(devRoot, "serial", "by-id")
+	entries, err := os.ReadDir(byIDDir)
+	if err != nil {
+		return links
+	}
+
+	for _, entry := range entries {
+		link := filepath.Join(byIDDir, entry.Name())
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue
+		}
+		links[filepath.Base(target)] = link
+	}
+
+	return links
+}
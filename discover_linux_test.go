@@ -0,0 +1,157 @@
+package gomesh
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// fakeSysfs builds a sysfs and dev tree. Each tty maps to {parent directory under devices,
+// "vid:pid" written to the parent, the tty's device directory below the parent}. An empty
+// vid:pid makes a port with no USB parent and an empty device directory a virtual tty
+func fakeSysfs(t *testing.T, ttys map[string][3]string) (sysfs string, dev string) {
+	t.Helper()
+
+	root := t.TempDir()
+	sysfs = filepath.Join(root, "sys")
+	dev = filepath.Join(root, "dev")
+
+	mustMkdir := func(path string) {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatalf("Error creating %s: %v", path, err)
+		}
+	}
+	mustWrite := func(path, data string) {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("Error writing %s: %v", path, err)
+		}
+	}
+
+	mustMkdir(filepath.Join(dev, "serial", "by-id"))
+
+	for name, spec := range ttys {
+		usbDevice, vidpid, device := spec[0], spec[1], spec[2]
+
+		classDir := filepath.Join(sysfs, "class", "tty", name)
+		mustMkdir(classDir)
+		mustWrite(filepath.Join(dev, name), "")
+
+		if device == "" {
+			continue
+		}
+		deviceDir := filepath.Join(sysfs, "devices", usbDevice, device)
+		mustMkdir(deviceDir)
+		if vidpid != "" {
+			mustWrite(filepath.Join(sysfs, "devices", usbDevice, "idVendor"), vidpid[:4]+"\n")
+			mustWrite(filepath.Join(sysfs, "devices", usbDevice, "idProduct"), vidpid[5:]+"\n")
+		}
+		if err := os.Symlink(deviceDir, filepath.Join(classDir, "device")); err != nil {
+			t.Fatalf("Error linking device: %v", err)
+		}
+	}
+
+	return sysfs, dev
+}
+
+func TestDiscoverRadios(t *testing.T) {
+	sysfs, dev := fakeSysfs(t, map[string][3]string{
+		"ttyUSB0": {"usb1/1-1", "10c4:ea60", "1-1:1.0/ttyUSB0"},
+		"ttyACM0": {"usb2/2-1", "303a:1001", "2-1:1.0"},
+		"ttyUSB1": {"usb3/3-1", "0403:6001", "3-1:1.0/ttyUSB1"},
+		"ttyS0":   {"platform/serial8250", "", "tty/ttyS0"},
+		"tty0":    {"", "", ""},
+	})
+	if err := os.Symlink("../../ttyUSB0", filepath.Join(dev, "serial", "by-id", "usb-Silicon_Labs_CP2102-if00-port0")); err != nil {
+		t.Fatalf("Error linking by-id: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     DiscoverOptions
+		expected []string
+	}{
+		{"Known chips only", DiscoverOptions{}, []string{"ttyACM0", "ttyUSB0"}},
+		{"Include unknown chips", DiscoverOptions{IncludeUnknown: true}, []string{"ttyACM0", "ttyUSB0", "ttyUSB1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.SysfsRoot = sysfs
+			tt.opts.DevRoot = dev
+
+			radios, err := DiscoverRadiosContext(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatalf("Error discovering: %v", err)
+			}
+			if len(radios) != len(tt.expected) {
+				t.Fatalf("Expected %d radios, got %+v", len(tt.expected), radios)
+			}
+			for i, radio := range radios {
+				if radio.Port != filepath.Join(dev, tt.expected[i]) {
+					t.Errorf("Radio %d: expected port %s, got %s", i, tt.expected[i], radio.Port)
+				}
+			}
+		})
+	}
+
+	radios, _ := DiscoverRadiosContext(context.Background(), DiscoverOptions{SysfsRoot: sysfs, DevRoot: dev})
+	cp210x := radios[1]
+	if cp210x.VendorID != 0x10c4 || cp210x.ProductID != 0xea60 || cp210x.Description != "Silicon Labs CP210x" {
+		t.Errorf("Unexpected USB details: %+v", cp210x)
+	}
+	if filepath.Base(cp210x.ByID) != "usb-Silicon_Labs_CP2102-if00-port0" {
+		t.Errorf("Expected by-id link, got %q", cp210x.ByID)
+	}
+	if radios[0].ByID != "" {
+		t.Errorf("Expected no by-id link for ttyACM0, got %q", radios[0].ByID)
+	}
+}
+
+func TestApplyIdentity(t *testing.T) {
+	responses := []*pb.FromRadio{
+		{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: 0x99, User: &pb.User{LongName: "Someone else"}}}},
+		{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: 0x42, User: &pb.User{
+			LongName:  "Base Station",
+			ShortName: "BASE",
+			HwModel:   pb.HardwareModel_RAK4631,
+		}}}},
+	}
+
+	candidate := DiscoveredRadio{Port: "/dev/ttyACM0"}
+	applyIdentity(&candidate, 0x42, responses)
+
+	if !candidate.Probed || candidate.NodeNum != 0x42 || candidate.LongName != "Base Station" ||
+		candidate.ShortName != "BASE" || candidate.HwModel != pb.HardwareModel_RAK4631 {
+		t.Errorf("Unexpected identity: %+v", candidate)
+	}
+}
+
+func TestProbeRadio(t *testing.T) {
+	device := newFakeDevice(t, 0x42)
+	device.setDump([]*pb.FromRadio{
+		{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: 0x42, User: &pb.User{LongName: "Base Station"}}}},
+	})
+
+	candidate := DiscoveredRadio{Port: "tcp://" + device.listener.Addr().String()}
+	if err := probeRadio(context.Background(), &candidate, 5*time.Second); err != nil {
+		t.Fatalf("probeRadio: %v", err)
+	}
+	if candidate.NodeNum != 0x42 || candidate.LongName != "Base Station" {
+		t.Errorf("Unexpected identity: %+v", candidate)
+	}
+
+	// The radio is asked for its config once
+	handshakes := 0
+	for len(device.received) > 0 {
+		if (<-device.received).GetWantConfigId() != 0 {
+			handshakes++
+		}
+	}
+	if handshakes != 1 {
+		t.Errorf("Probe ran %d handshakes, want 1", handshakes)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package gomesh
+
+import "errors"
+
+// listSerialPorts is not implemented outside of Linux yet
+func listSerialPorts(opts DiscoverOptions) ([]DiscoveredRadio, error) {
+	return nil, errors.New("serial port discovery is only supported on Linux")
+}
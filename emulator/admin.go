@@ -0,0 +1,289 @@
+package emulator
+
+import (
+	"fmt"
+
+	gomesh "github.com/b7r-dev/goMesh"
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxChannels is the number of channel slots on a device
+const maxChannels = 8
+
+// nodeID formats a node number the way the firmware names nodes
+func nodeID(num uint32) string {
+	return fmt.Sprintf("!%08x", num)
+}
+
+func defaultConfig() *pb.LocalConfig {
+	return &pb.LocalConfig{
+		Device:    &pb.Config_DeviceConfig{Role: pb.Config_DeviceConfig_CLIENT},
+		Position:  &pb.Config_PositionConfig{},
+		Power:     &pb.Config_PowerConfig{},
+		Network:   &pb.Config_NetworkConfig{},
+		Display:   &pb.Config_DisplayConfig{},
+		Lora:      &pb.Config_LoRaConfig{UsePreset: true, ModemPreset: pb.Config_LoRaConfig_LONG_FAST, HopLimit: 3, TxEnabled: true},
+		Bluetooth: &pb.Config_BluetoothConfig{},
+		Security:  &pb.Config_SecurityConfig{},
+	}
+}
+
+func defaultModuleConfig() *pb.LocalModuleConfig {
+	return &pb.LocalModuleConfig{
+		Mqtt:                 &pb.ModuleConfig_MQTTConfig{},
+		Serial:               &pb.ModuleConfig_SerialConfig{},
+		ExternalNotification: &pb.ModuleConfig_ExternalNotificationConfig{},
+		StoreForward:         &pb.ModuleConfig_StoreForwardConfig{},
+		RangeTest:            &pb.ModuleConfig_RangeTestConfig{},
+		Telemetry:            &pb.ModuleConfig_TelemetryConfig{},
+		CannedMessage:        &pb.ModuleConfig_CannedMessageConfig{},
+		Audio:                &pb.ModuleConfig_AudioConfig{},
+		RemoteHardware:       &pb.ModuleConfig_RemoteHardwareConfig{},
+		NeighborInfo:         &pb.ModuleConfig_NeighborInfoConfig{},
+		AmbientLighting:      &pb.ModuleConfig_AmbientLightingConfig{},
+		DetectionSensor:      &pb.ModuleConfig_DetectionSensorConfig{},
+		Paxcounter:           &pb.ModuleConfig_PaxcounterConfig{},
+	}
+}
+
+// configDump builds the answer to WantConfigId. ConfigOnlyNonce leaves out the other nodes and
+// NodesOnlyNonce sends nothing but the node database
+func (d *Device) configDump(nonce uint32) []*pb.FromRadio {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var dump []*pb.FromRadio
+	add := func(fromRadio *pb.FromRadio) {
+		fromRadio.Id = uint32(len(dump) + 1)
+		dump = append(dump, proto.Clone(fromRadio).(*pb.FromRadio))
+	}
+
+	if nonce != gomesh.NodesOnlyNonce {
+		add(&pb.FromRadio{PayloadVariant: &pb.FromRadio_MyInfo{MyInfo: &pb.MyNodeInfo{MyNodeNum: d.nodeNum}}})
+		add(&pb.FromRadio{PayloadVariant: &pb.FromRadio_Metadata{Metadata: d.metadata}})
+	}
+
+	for _, node := range d.sortedNodes() {
+		if nonce == gomesh.ConfigOnlyNonce && node.GetNum() != d.nodeNum {
+			continue
+		}
+		add(&pb.FromRadio{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: node}})
+	}
+
+	if nonce != gomesh.NodesOnlyNonce {
+		for _, channel := range d.channels {
+			add(&pb.FromRadio{PayloadVariant: &pb.FromRadio_Channel{Channel: channel}})
+		}
+		for _, config := range splitOneofs(d.config, func() proto.Message { return &pb.Config{} }) {
+			add(&pb.FromRadio{PayloadVariant: &pb.FromRadio_Config{Config: config.(*pb.Config)}})
+		}
+		for _, config := range splitOneofs(d.moduleConfig, func() proto.Message { return &pb.ModuleConfig{} }) {
+			add(&pb.FromRadio{PayloadVariant: &pb.FromRadio_ModuleConfig{ModuleConfig: config.(*pb.ModuleConfig)}})
+		}
+	}
+
+	add(&pb.FromRadio{PayloadVariant: &pb.FromRadio_ConfigCompleteId{ConfigCompleteId: nonce}})
+
+	return dump
+}
+
+// handleAdmin applies an admin message addressed to this node. It returns the answer for
+// requests that have one and the routing error to report, if any
+func (d *Device) handleAdmin(payload []byte) (*pb.AdminMessage, pb.Routing_Error) {
+	admin := &pb.AdminMessage{}
+	if err := proto.Unmarshal(payload, admin); err != nil {
+		d.logf("bad admin message: %v", err)
+		return nil, pb.Routing_BAD_REQUEST
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch variant := admin.GetPayloadVariant().(type) {
+	case *pb.AdminMessage_SetOwner:
+		user := d.nodes[d.nodeNum].GetUser()
+		user.LongName = variant.SetOwner.GetLongName()
+		user.ShortName = variant.SetOwner.GetShortName()
+		user.IsLicensed = variant.SetOwner.GetIsLicensed()
+	case *pb.AdminMessage_SetChannel:
+		index := variant.SetChannel.GetIndex()
+		if index < 0 || int(index) >= len(d.channels) {
+			return nil, pb.Routing_BAD_REQUEST
+		}
+		channel := proto.Clone(variant.SetChannel).(*pb.Channel)
+		if channel.Settings == nil {
+			channel.Settings = &pb.ChannelSettings{}
+		}
+		d.channels[index] = channel
+	case *pb.AdminMessage_SetConfig:
+		if !mergeOneof(variant.SetConfig, d.config) {
+			return nil, pb.Routing_BAD_REQUEST
+		}
+	case *pb.AdminMessage_SetModuleConfig:
+		if !mergeOneof(variant.SetModuleConfig, d.moduleConfig) {
+			return nil, pb.Routing_BAD_REQUEST
+		}
+	case *pb.AdminMessage_SetFavoriteNode:
+		node, ok := d.nodes[variant.SetFavoriteNode]
+		if !ok {
+			return nil, pb.Routing_BAD_REQUEST
+		}
+		node.IsFavorite = true
+	case *pb.AdminMessage_RemoveFavoriteNode:
+		node, ok := d.nodes[variant.RemoveFavoriteNode]
+		if !ok {
+			return nil, pb.Routing_BAD_REQUEST
+		}
+		node.IsFavorite = false
+	case *pb.AdminMessage_SetIgnoredNode:
+		if node, ok := d.nodes[variant.SetIgnoredNode]; ok {
+			node.IsIgnored = true
+		}
+	case *pb.AdminMessage_RemoveIgnoredNode:
+		if node, ok := d.nodes[variant.RemoveIgnoredNode]; ok {
+			node.IsIgnored = false
+		}
+	case *pb.AdminMessage_RemoveByNodenum:
+		if variant.RemoveByNodenum != d.nodeNum {
+			delete(d.nodes, variant.RemoveByNodenum)
+		}
+	case *pb.AdminMessage_SetFixedPosition:
+		d.nodes[d.nodeNum].Position = proto.Clone(variant.SetFixedPosition).(*pb.Position)
+		d.config.Position.FixedPosition = true
+	case *pb.AdminMessage_RemoveFixedPosition:
+		d.config.Position.FixedPosition = false
+	case *pb.AdminMessage_FactoryResetDevice, *pb.AdminMessage_FactoryResetConfig:
+		d.reset()
+
+	case *pb.AdminMessage_GetOwnerRequest:
+		return &pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetOwnerResponse{
+			GetOwnerResponse: proto.Clone(d.nodes[d.nodeNum].GetUser()).(*pb.User),
+		}}, pb.Routing_NONE
+	case *pb.AdminMessage_GetChannelRequest:
+		// The request carries the index plus one
+		index := int(variant.GetChannelRequest) - 1
+		if index < 0 || index >= len(d.channels) {
+			return nil, pb.Routing_BAD_REQUEST
+		}
+		return &pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetChannelResponse{
+			GetChannelResponse: proto.Clone(d.channels[index]).(*pb.Channel),
+		}}, pb.Routing_NONE
+	case *pb.AdminMessage_GetConfigRequest:
+		config := &pb.Config{}
+		if !selectOneof(d.config, config, int32(variant.GetConfigRequest)) {
+			return nil, pb.Routing_BAD_REQUEST
+		}
+		return &pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetConfigResponse{GetConfigResponse: config}}, pb.Routing_NONE
+	case *pb.AdminMessage_GetModuleConfigRequest:
+		config := &pb.ModuleConfig{}
+		if !selectOneof(d.moduleConfig, config, int32(variant.GetModuleConfigRequest)) {
+			return nil, pb.Routing_BAD_REQUEST
+		}
+		return &pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetModuleConfigResponse{GetModuleConfigResponse: config}}, pb.Routing_NONE
+	case *pb.AdminMessage_GetDeviceMetadataRequest:
+		return &pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetDeviceMetadataResponse{
+			GetDeviceMetadataResponse: proto.Clone(d.metadata).(*pb.DeviceMetadata),
+		}}, pb.Routing_NONE
+
+	default:
+		// Accepted and ignored, like settings the emulator does not model
+		d.logf("ignoring admin message %T", variant)
+	}
+
+	return nil, pb.Routing_NONE
+}
+
+// handlePosition records a position sent to this node as its own
+func (d *Device) handlePosition(payload []byte) pb.Routing_Error {
+	position := &pb.Position{}
+	if err := proto.Unmarshal(payload, position); err != nil {
+		return pb.Routing_BAD_REQUEST
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nodes[d.nodeNum].Position = position
+
+	return pb.Routing_NONE
+}
+
+// mergeOneof stores the variant set in src's oneof in the field of dst with the same name, which
+// is how Config maps onto LocalConfig and ModuleConfig onto LocalModuleConfig
+func mergeOneof(src proto.Message, dst proto.Message) bool {
+	srcMsg := src.ProtoReflect()
+	dstMsg := dst.ProtoReflect()
+
+	oneofs := srcMsg.Descriptor().Oneofs()
+	if oneofs.Len() == 0 {
+		return false
+	}
+
+	field := srcMsg.WhichOneof(oneofs.Get(0))
+	if field == nil {
+		return false
+	}
+
+	dstField := dstMsg.Descriptor().Fields().ByName(field.Name())
+	if !sameMessage(field, dstField) {
+		return false
+	}
+
+	dstMsg.Set(dstField, protoreflect.ValueOfMessage(proto.Clone(srcMsg.Get(field).Message().Interface()).ProtoReflect()))
+
+	return true
+}
+
+// splitOneofs is the reverse of mergeOneof: every set field of src becomes its own message with
+// that field selected in the oneof
+func splitOneofs(src proto.Message, newMessage func() proto.Message) []proto.Message {
+	var messages []proto.Message
+
+	srcMsg := src.ProtoReflect()
+	fields := srcMsg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if !srcMsg.Has(field) {
+			continue
+		}
+
+		message := newMessage()
+		dstMsg := message.ProtoReflect()
+		dstField := dstMsg.Descriptor().Fields().ByName(field.Name())
+		if !sameMessage(field, dstField) {
+			continue
+		}
+
+		dstMsg.Set(dstField, srcMsg.Get(field))
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+// selectOneof copies one field of src into the oneof of dst. The admin ConfigType and
+// ModuleConfigType values are the oneof field numbers minus one
+func selectOneof(src proto.Message, dst proto.Message, configType int32) bool {
+	dstMsg := dst.ProtoReflect()
+	dstField := dstMsg.Descriptor().Fields().ByNumber(protoreflect.FieldNumber(configType + 1))
+	if dstField == nil {
+		return false
+	}
+
+	srcMsg := src.ProtoReflect()
+	srcField := srcMsg.Descriptor().Fields().ByName(dstField.Name())
+	if !sameMessage(srcField, dstField) || !srcMsg.Has(srcField) {
+		return false
+	}
+
+	dstMsg.Set(dstField, protoreflect.ValueOfMessage(proto.Clone(srcMsg.Get(srcField).Message().Interface()).ProtoReflect()))
+
+	return true
+}
+
+func sameMessage(a, b protoreflect.FieldDescriptor) bool {
+	return a != nil && b != nil && a.Message() != nil && b.Message() != nil &&
+		a.Message().FullName() == b.Message().FullName()
+}
@@ -0,0 +1,557 @@
+// Package emulator implements the firmware side of the Meshtastic stream API so that code using
+// gomesh can be tested without a radio. A Device keeps the state a real node would (owner, node
+// database, channels, config and module config), answers config requests, applies admin messages,
+// acknowledges packets and lets tests script packets arriving from the mesh.
+//
+//	device := emulator.New(emulator.Options{})
+//	radio := gomesh.Radio{}
+//	err := radio.InitWithTransport(device.Pipe())
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	gomesh "github.com/b7r-dev/goMesh"
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultNodeNum is the node number of a Device created without one
+const DefaultNodeNum uint32 = 0x0badc0de
+
+// outgoingBuffer is the number of frames queued for a client before the device blocks
+const outgoingBuffer = 256
+
+// txQueueSize is the transmit queue length reported in QueueStatus frames. The emulator sends
+// packets instantly, so the queue is always empty
+const txQueueSize = 16
+
+// Options configures a new Device
+type Options struct {
+	NodeNum         uint32 // Defaults to DefaultNodeNum
+	LongName        string // Defaults to "Emulator"
+	ShortName       string // Defaults to "EMU"
+	HwModel         pb.HardwareModel
+	FirmwareVersion string // Defaults to "2.5.0.emulator"
+
+	// Nodes are added to the node database next to the device's own node
+	Nodes []*pb.NodeInfo
+
+	// Logger receives a line for every frame handled. Nil discards them
+	Logger *log.Logger
+}
+
+// Device is an emulated radio. It is safe for concurrent use and can serve any number of clients
+type Device struct {
+	opts Options
+
+	mu           sync.Mutex
+	nodeNum      uint32
+	metadata     *pb.DeviceMetadata
+	nodes        map[uint32]*pb.NodeInfo
+	channels     []*pb.Channel
+	config       *pb.LocalConfig
+	moduleConfig *pb.LocalModuleConfig
+	received     []*pb.ToRadio
+	clients      map[*client]struct{}
+	listeners    []net.Listener
+	lastID       uint32
+	closed       bool
+	started      time.Time
+}
+
+// client is one connection to the device
+type client struct {
+	conn net.Conn
+	out  chan outgoing
+	done chan struct{}
+	once sync.Once
+}
+
+// outgoing is a frame or, when text is set, console output for a client
+type outgoing struct {
+	frame *pb.FromRadio
+	text  string
+}
+
+// New returns a device in its factory state
+func New(opts Options) *Device {
+	if opts.NodeNum == 0 {
+		opts.NodeNum = DefaultNodeNum
+	}
+	if opts.LongName == "" {
+		opts.LongName = "Emulator"
+	}
+	if opts.ShortName == "" {
+		opts.ShortName = "EMU"
+	}
+	if opts.FirmwareVersion == "" {
+		opts.FirmwareVersion = "2.5.0.emulator"
+	}
+
+	d := &Device{opts: opts, clients: make(map[*client]struct{}), started: time.Now()}
+	d.reset()
+
+	return d
+}
+
+// reset restores the factory state. The caller holds mu or owns d exclusively
+func (d *Device) reset() {
+	d.nodeNum = d.opts.NodeNum
+	d.metadata = &pb.DeviceMetadata{FirmwareVersion: d.opts.FirmwareVersion, HwModel: d.opts.HwModel}
+
+	d.nodes = map[uint32]*pb.NodeInfo{
+		d.nodeNum: {
+			Num: d.nodeNum,
+			User: &pb.User{
+				Id:        nodeID(d.nodeNum),
+				LongName:  d.opts.LongName,
+				ShortName: d.opts.ShortName,
+				HwModel:   d.opts.HwModel,
+			},
+		},
+	}
+	for _, node := range d.opts.Nodes {
+		d.nodes[node.GetNum()] = proto.Clone(node).(*pb.NodeInfo)
+	}
+
+	d.channels = make([]*pb.Channel, maxChannels)
+	d.channels[0] = &pb.Channel{Index: 0, Role: pb.Channel_PRIMARY, Settings: &pb.ChannelSettings{Psk: []byte{1}}}
+	for i := 1; i < maxChannels; i++ {
+		d.channels[i] = &pb.Channel{Index: int32(i), Role: pb.Channel_DISABLED, Settings: &pb.ChannelSettings{}}
+	}
+
+	d.config = defaultConfig()
+	d.moduleConfig = defaultModuleConfig()
+}
+
+// Pipe connects a new in-memory client to the device and returns its end, ready to be passed
+// to Radio.InitWithTransport
+func (d *Device) Pipe() gomesh.Transport {
+	deviceEnd, clientEnd := net.Pipe()
+	d.Serve(deviceEnd)
+	return clientEnd
+}
+
+// Listen accepts TCP clients on addr, such as "127.0.0.1:0", until the device is closed. It
+// returns the address actually listened on
+func (d *Device) Listen(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		listener.Close()
+		return "", errors.New("device closed")
+	}
+	d.listeners = append(d.listeners, listener)
+	d.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			d.Serve(conn)
+		}
+	}()
+
+	return listener.Addr().String(), nil
+}
+
+// Serve speaks the stream API on conn in the background until the client disconnects or the
+// device is closed
+func (d *Device) Serve(conn net.Conn) {
+	c := &client{conn: conn, out: make(chan outgoing, outgoingBuffer), done: make(chan struct{})}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		conn.Close()
+		return
+	}
+	d.clients[c] = struct{}{}
+	d.mu.Unlock()
+
+	go d.writeLoop(c)
+	go d.readLoop(c)
+}
+
+// Close disconnects every client and stops listening
+func (d *Device) Close() error {
+	d.mu.Lock()
+	d.closed = true
+	clients := d.clients
+	d.clients = make(map[*client]struct{})
+	listeners := d.listeners
+	d.listeners = nil
+	d.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	for c := range clients {
+		c.close()
+	}
+
+	return nil
+}
+
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// send queues a frame for the client
+func (c *client) send(fromRadio *pb.FromRadio) {
+	c.queue(outgoing{frame: fromRadio})
+}
+
+// queue hands output to the client's writer, dropping it if the client has gone away
+func (c *client) queue(next outgoing) {
+	select {
+	case c.out <- next:
+	case <-c.done:
+	}
+}
+
+func (d *Device) writeLoop(c *client) {
+	writer := gomesh.NewFrameWriter(c.conn)
+
+	for {
+		select {
+		case next := <-c.out:
+			if next.frame == nil {
+				if _, err := io.WriteString(c.conn, next.text); err != nil {
+					c.close()
+					return
+				}
+				continue
+			}
+			out, err := proto.Marshal(next.frame)
+			if err != nil {
+				d.logf("marshal %T: %v", next.frame.GetPayloadVariant(), err)
+				continue
+			}
+			if err := writer.WriteFrame(out); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (d *Device) readLoop(c *client) {
+	defer func() {
+		c.close()
+		d.mu.Lock()
+		delete(d.clients, c)
+		d.mu.Unlock()
+	}()
+
+	reader := gomesh.NewFrameReader(c.conn)
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			return
+		}
+		if frame.Kind != gomesh.FrameProtobuf {
+			// Console input such as the "exit" sent to serial radios
+			continue
+		}
+
+		toRadio := &pb.ToRadio{}
+		if err := proto.Unmarshal(frame.Payload, toRadio); err != nil {
+			d.logf("bad ToRadio: %v", err)
+			continue
+		}
+
+		if !d.handle(c, toRadio) {
+			return
+		}
+	}
+}
+
+// handle acts on one frame from a client and reports whether the connection stays open
+func (d *Device) handle(c *client, toRadio *pb.ToRadio) bool {
+	d.mu.Lock()
+	d.received = append(d.received, toRadio)
+	d.mu.Unlock()
+
+	switch variant := toRadio.GetPayloadVariant().(type) {
+	case *pb.ToRadio_WantConfigId:
+		d.logf("config request %d", variant.WantConfigId)
+		for _, fromRadio := range d.configDump(variant.WantConfigId) {
+			c.send(fromRadio)
+		}
+	case *pb.ToRadio_Packet:
+		d.handlePacket(c, variant.Packet)
+	case *pb.ToRadio_Disconnect:
+		d.logf("client disconnected")
+		return false
+	case *pb.ToRadio_Heartbeat:
+		// Keeps the connection alive, nothing to answer
+	}
+
+	return true
+}
+
+// handlePacket processes a mesh packet sent by a client: packets for this node are applied,
+// everything asking for an ack gets one, and packets for other nodes are considered delivered:
+// a direct message is acked by its destination and a broadcast implicitly acked by this node
+func (d *Device) handlePacket(c *client, packet *pb.MeshPacket) {
+	decoded := packet.GetDecoded()
+	d.logf("packet %d to %d on %s", packet.GetId(), packet.GetTo(), decoded.GetPortnum())
+
+	// Like the firmware, report the transmit queue for every packet the client hands over
+	c.send(&pb.FromRadio{PayloadVariant: &pb.FromRadio_QueueStatus{QueueStatus: &pb.QueueStatus{
+		Free:         txQueueSize,
+		Maxlen:       txQueueSize,
+		MeshPacketId: packet.GetId(),
+	}}})
+
+	reason := pb.Routing_NONE
+
+	d.mu.Lock()
+	self := d.nodeNum
+	d.mu.Unlock()
+	toSelf := packet.GetTo() == self
+
+	if toSelf {
+		switch decoded.GetPortnum() {
+		case pb.PortNum_ADMIN_APP:
+			var response *pb.AdminMessage
+			response, reason = d.handleAdmin(decoded.GetPayload())
+			if response != nil && decoded.GetWantResponse() {
+				d.reply(c, packet, self, pb.PortNum_ADMIN_APP, response)
+			}
+		case pb.PortNum_POSITION_APP:
+			reason = d.handlePosition(decoded.GetPayload())
+		}
+	}
+
+	if packet.GetWantAck() || reason != pb.Routing_NONE {
+		ackFrom := self
+		if !toSelf && packet.GetTo() != 0xffffffff && reason == pb.Routing_NONE {
+			ackFrom = packet.GetTo()
+		}
+		d.reply(c, packet, ackFrom, pb.PortNum_ROUTING_APP, &pb.Routing{Variant: &pb.Routing_ErrorReason{ErrorReason: reason}})
+	}
+}
+
+// reply sends message to the client as an answer to request, coming from node from
+func (d *Device) reply(c *client, request *pb.MeshPacket, from uint32, port pb.PortNum, message proto.Message) {
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		d.logf("marshal %T: %v", message, err)
+		return
+	}
+
+	d.mu.Lock()
+	self := d.nodeNum
+	d.mu.Unlock()
+
+	c.send(&pb.FromRadio{PayloadVariant: &pb.FromRadio_Packet{Packet: &pb.MeshPacket{
+		Id:      d.nextID(),
+		From:    from,
+		To:      self,
+		Channel: request.GetChannel(),
+		RxTime:  uint32(time.Now().Unix()),
+		PayloadVariant: &pb.MeshPacket_Decoded{Decoded: &pb.Data{
+			Portnum:   port,
+			Payload:   payload,
+			RequestId: request.GetId(),
+		}},
+	}}})
+}
+
+// Inject delivers a packet to every client as if it had been received from the mesh. A zero
+// Id is replaced with a fresh one and a zero RxTime with the current time
+func (d *Device) Inject(packet *pb.MeshPacket) {
+	packet = proto.Clone(packet).(*pb.MeshPacket)
+	if packet.Id == 0 {
+		packet.Id = d.nextID()
+	}
+	if packet.RxTime == 0 {
+		packet.RxTime = uint32(time.Now().Unix())
+	}
+
+	d.broadcast(outgoing{frame: &pb.FromRadio{PayloadVariant: &pb.FromRadio_Packet{Packet: packet}}})
+}
+
+// InjectText delivers a text message from another node. A zero to means a broadcast
+func (d *Device) InjectText(from uint32, to uint32, channel uint32, text string) {
+	if to == 0 {
+		to = 0xffffffff
+	}
+
+	d.Inject(&pb.MeshPacket{
+		From:    from,
+		To:      to,
+		Channel: channel,
+		PayloadVariant: &pb.MeshPacket_Decoded{Decoded: &pb.Data{
+			Portnum: pb.PortNum_TEXT_MESSAGE_APP,
+			Payload: []byte(text),
+		}},
+	})
+}
+
+// Log emits a line of device log. With debug_log_api_enabled set in the security config it is sent
+// as a LogRecord frame, otherwise as console text the way the firmware prints it on serial
+func (d *Device) Log(level pb.LogRecord_Level, source string, message string) {
+	d.mu.Lock()
+	apiEnabled := d.config.GetSecurity().GetDebugLogApiEnabled()
+	d.mu.Unlock()
+
+	now := time.Now().UTC()
+	if apiEnabled {
+		d.broadcast(outgoing{frame: &pb.FromRadio{PayloadVariant: &pb.FromRadio_LogRecord{LogRecord: &pb.LogRecord{
+			Message: message,
+			Time:    uint32(now.Unix()),
+			Source:  source,
+			Level:   level,
+		}}}})
+		return
+	}
+
+	name := level.String()
+	if level == pb.LogRecord_WARNING {
+		name = "WARN"
+	}
+	line := fmt.Sprintf("%-5s | %s %d [%s] %s\r\n", name, now.Format("15:04:05"), int(time.Since(d.started).Seconds()), source, message)
+	d.broadcast(outgoing{text: line})
+}
+
+// InjectFrame sends an arbitrary FromRadio frame to every client
+func (d *Device) InjectFrame(fromRadio *pb.FromRadio) {
+	d.broadcast(outgoing{frame: fromRadio})
+}
+
+func (d *Device) broadcast(next outgoing) {
+	d.mu.Lock()
+	clients := make([]*client, 0, len(d.clients))
+	for c := range d.clients {
+		clients = append(clients, c)
+	}
+	d.mu.Unlock()
+
+	for _, c := range clients {
+		c.queue(next)
+	}
+}
+
+// Received returns every ToRadio frame the device has received so far, in order
+func (d *Device) Received() []*pb.ToRadio {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]*pb.ToRadio(nil), d.received...)
+}
+
+// NodeNum returns the device's own node number
+func (d *Device) NodeNum() uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.nodeNum
+}
+
+// Owner returns a copy of the device's user
+func (d *Device) Owner() *pb.User {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return proto.Clone(d.nodes[d.nodeNum].GetUser()).(*pb.User)
+}
+
+// Node returns a copy of a node in the node database, or nil
+func (d *Device) Node(num uint32) *pb.NodeInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	node, ok := d.nodes[num]
+	if !ok {
+		return nil
+	}
+	return proto.Clone(node).(*pb.NodeInfo)
+}
+
+// AddNode adds or replaces a node in the node database
+func (d *Device) AddNode(node *pb.NodeInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nodes[node.GetNum()] = proto.Clone(node).(*pb.NodeInfo)
+}
+
+// Channel returns a copy of the channel at index, or nil if the index is out of range
+func (d *Device) Channel(index int) *pb.Channel {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if index < 0 || index >= len(d.channels) {
+		return nil
+	}
+	return proto.Clone(d.channels[index]).(*pb.Channel)
+}
+
+// Config returns a copy of the device config
+func (d *Device) Config() *pb.LocalConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return proto.Clone(d.config).(*pb.LocalConfig)
+}
+
+// ModuleConfig returns a copy of the module config
+func (d *Device) ModuleConfig() *pb.LocalModuleConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return proto.Clone(d.moduleConfig).(*pb.LocalModuleConfig)
+}
+
+// sortedNodes returns the node database ordered by node number with the device's own node
+// first, the order the firmware uses. The caller holds mu
+func (d *Device) sortedNodes() []*pb.NodeInfo {
+	nodes := make([]*pb.NodeInfo, 0, len(d.nodes))
+	for _, node := range d.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if (nodes[i].GetNum() == d.nodeNum) != (nodes[j].GetNum() == d.nodeNum) {
+			return nodes[i].GetNum() == d.nodeNum
+		}
+		return nodes[i].GetNum() < nodes[j].GetNum()
+	})
+	return nodes
+}
+
+func (d *Device) nextID() uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lastID++
+	return d.lastID
+}
+
+func (d *Device) logf(format string, args ...interface{}) {
+	if d.opts.Logger != nil {
+		d.opts.Logger.Printf("emulator: "+format, args...)
+	}
+}
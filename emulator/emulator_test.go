@@ -0,0 +1,369 @@
+package emulator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gomesh "github.com/b7r-dev/goMesh"
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+const otherNode uint32 = 0x1234
+
+// connect starts a device and a radio talking to it over a pipe
+func connect(t *testing.T) (*Device, *gomesh.Radio) {
+	t.Helper()
+
+	device := New(Options{
+		LongName: "Base Station",
+		Nodes:    []*pb.NodeInfo{{Num: otherNode, User: &pb.User{LongName: "Hiker"}}},
+	})
+	t.Cleanup(func() { device.Close() })
+
+	radio := &gomesh.Radio{}
+	if err := radio.InitWithTransport(device.Pipe()); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	t.Cleanup(radio.Close)
+
+	return device, radio
+}
+
+// roundTrip waits until the device has handled everything sent before it. The device answers
+// frames in order, so one request and its answer are enough
+func roundTrip(t *testing.T, radio *gomesh.Radio) {
+	t.Helper()
+
+	if _, err := radio.AdminRequest(&pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetOwnerRequest{GetOwnerRequest: true}}); err != nil {
+		t.Fatalf("Error syncing with device: %v", err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	device, radio := connect(t)
+
+	if radio.GetNodeID() != DefaultNodeNum {
+		t.Errorf("Expected node number 0x%x, got 0x%x", DefaultNodeNum, radio.GetNodeID())
+	}
+
+	tests := []struct {
+		name          string
+		nonce         uint32
+		nodes         int
+		channels      int
+		configs       int
+		moduleConfigs int
+	}{
+		{"Full dump", 0, 2, maxChannels, 8, 13},
+		{"Config only", gomesh.ConfigOnlyNonce, 1, maxChannels, 8, 13},
+		{"Nodes only", gomesh.NodesOnlyNonce, 2, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := radio.Handshake(gomesh.HandshakeOptions{Nonce: tt.nonce})
+			if err != nil {
+				t.Fatalf("Error in handshake: %v", err)
+			}
+
+			if len(snapshot.Nodes) != tt.nodes || len(snapshot.Channels) != tt.channels {
+				t.Errorf("Expected %d nodes and %d channels, got %d and %d", tt.nodes, tt.channels, len(snapshot.Nodes), len(snapshot.Channels))
+			}
+
+			var configs, moduleConfigs int
+			for _, fromRadio := range snapshot.Frames {
+				switch fromRadio.GetPayloadVariant().(type) {
+				case *pb.FromRadio_Config:
+					configs++
+				case *pb.FromRadio_ModuleConfig:
+					moduleConfigs++
+				}
+			}
+			if configs != tt.configs || moduleConfigs != tt.moduleConfigs {
+				t.Errorf("Expected %d configs and %d module configs, got %d and %d", tt.configs, tt.moduleConfigs, configs, moduleConfigs)
+			}
+		})
+	}
+
+	snapshot, err := radio.Handshake(gomesh.HandshakeOptions{})
+	if err != nil {
+		t.Fatalf("Error in handshake: %v", err)
+	}
+	if snapshot.Self().GetUser().GetLongName() != "Base Station" || snapshot.Node(otherNode) == nil {
+		t.Errorf("Unexpected nodes in snapshot: %v", snapshot.Nodes)
+	}
+	if !proto.Equal(snapshot.Config, device.Config()) {
+		t.Errorf("Snapshot config %v does not match device %v", snapshot.Config, device.Config())
+	}
+}
+
+func TestSetOwner(t *testing.T) {
+	device, radio := connect(t)
+
+	if err := radio.SetRadioOwner("Test Owner"); err != nil {
+		t.Fatalf("Error setting owner: %v", err)
+	}
+	roundTrip(t, radio)
+
+	if owner := device.Owner(); owner.GetLongName() != "Test Owner" || owner.GetShortName() != "Tes" {
+		t.Errorf("Owner not applied: %v", owner)
+	}
+
+	snapshot, err := radio.Handshake(gomesh.HandshakeOptions{})
+	if err != nil {
+		t.Fatalf("Error in handshake: %v", err)
+	}
+	if snapshot.Self().GetUser().GetLongName() != "Test Owner" {
+		t.Errorf("Owner not in node database: %v", snapshot.Self())
+	}
+}
+
+func TestChannels(t *testing.T) {
+	device, radio := connect(t)
+
+	if err := radio.AddChannel("test", 2); err != nil {
+		t.Fatalf("Error adding channel: %v", err)
+	}
+	channel, err := radio.GetChannelInfo(2)
+	if err != nil {
+		t.Fatalf("Error retrieving channel: %v", err)
+	}
+	if channel.Settings.GetName() != "test" || channel.Role != pb.Channel_SECONDARY {
+		t.Errorf("Channel not added: %v", channel)
+	}
+
+	if err := radio.AddChannel("again", 2); err == nil {
+		t.Error("Expected an error adding an existing channel")
+	}
+
+	if err := radio.SetChannel(2, "Psk", "newPsk"); err != nil {
+		t.Fatalf("Error changing channel: %v", err)
+	}
+	channel, err = radio.GetChannelInfo(2)
+	if err != nil {
+		t.Fatalf("Error retrieving channel: %v", err)
+	}
+	if string(channel.Settings.GetPsk()) != "newPsk" {
+		t.Errorf("Channel PSK not changed: %v", channel)
+	}
+
+	if err := radio.DeleteChannel(2); err != nil {
+		t.Fatalf("Error deleting channel: %v", err)
+	}
+	roundTrip(t, radio)
+	if device.Channel(2).Role != pb.Channel_DISABLED {
+		t.Errorf("Channel not deleted: %v", device.Channel(2))
+	}
+
+	if err := radio.DeleteChannel(0); err == nil {
+		t.Error("Expected an error deleting the primary channel")
+	}
+}
+
+func TestSetChannelURL(t *testing.T) {
+	device, radio := connect(t)
+
+	err := radio.SetChannelURL("https://www.meshtastic.org/c/#CgoSBGFzZGY6AggNCigSIFUuaekdQ2K8pKQihn9HFxxTgY_QPvepwDvv7MDpFQ0EGgR0ZXN0")
+	if err != nil {
+		t.Fatalf("Error setting channel URL: %v", err)
+	}
+
+	channel, err := radio.GetChannelInfo(0)
+	if err != nil {
+		t.Fatalf("Error retrieving channel: %v", err)
+	}
+	if !bytes.Equal(channel.Settings.GetPsk(), []byte("asdf")) {
+		t.Errorf("Channel PSK not set from URL: %v", channel)
+	}
+	if device.Channel(1).Role != pb.Channel_SECONDARY {
+		t.Errorf("Second channel from URL not added: %v", device.Channel(1))
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	device, radio := connect(t)
+
+	if err := radio.SetModemMode("vls"); err != nil {
+		t.Fatalf("Error setting modem mode: %v", err)
+	}
+	roundTrip(t, radio)
+
+	if preset := device.Config().GetLora().GetModemPreset(); preset != pb.Config_LoRaConfig_VERY_LONG_SLOW {
+		t.Errorf("Expected VERY_LONG_SLOW, got %s", preset)
+	}
+
+	configs, _, err := radio.GetRadioConfig()
+	if err != nil {
+		t.Fatalf("Error retrieving config: %v", err)
+	}
+	found := false
+	for _, config := range configs {
+		if config.Config.GetLora().GetModemPreset() == pb.Config_LoRaConfig_VERY_LONG_SLOW {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("New modem preset not in the radio's config")
+	}
+
+	answer, err := radio.AdminRequest(&pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetConfigRequest{GetConfigRequest: pb.AdminMessage_LORA_CONFIG}})
+	if err != nil {
+		t.Fatalf("Error requesting config: %v", err)
+	}
+	if answer.GetGetConfigResponse().GetLora().GetModemPreset() != pb.Config_LoRaConfig_VERY_LONG_SLOW {
+		t.Errorf("Unexpected config response: %v", answer)
+	}
+}
+
+func TestFavorites(t *testing.T) {
+	device, radio := connect(t)
+
+	if err := radio.SetNodeFavorite(otherNode); err != nil {
+		t.Fatalf("Error setting favorite: %v", err)
+	}
+	roundTrip(t, radio)
+	if !device.Node(otherNode).GetIsFavorite() {
+		t.Error("Node not marked as favorite")
+	}
+
+	if err := radio.RemoveNodeFavorite(otherNode); err != nil {
+		t.Fatalf("Error removing favorite: %v", err)
+	}
+	roundTrip(t, radio)
+	if device.Node(otherNode).GetIsFavorite() {
+		t.Error("Node still marked as favorite")
+	}
+}
+
+func TestRoutingAcks(t *testing.T) {
+	device, radio := connect(t)
+
+	acks := radio.Subscribe(gomesh.PacketFilter{PortNums: []pb.PortNum{pb.PortNum_ROUTING_APP}})
+	defer acks.Unsubscribe()
+
+	sent, err := radio.SendTextMessage("hello", int64(otherNode), 0)
+	if err != nil {
+		t.Fatalf("Error sending text: %v", err)
+	}
+
+	select {
+	case fromRadio := <-acks.C:
+		routing := &pb.Routing{}
+		if err := proto.Unmarshal(fromRadio.GetPacket().GetDecoded().GetPayload(), routing); err != nil {
+			t.Fatalf("Error decoding ack: %v", err)
+		}
+		if routing.GetErrorReason() != pb.Routing_NONE {
+			t.Errorf("Expected a clean ack, got %s", routing.GetErrorReason())
+		}
+
+		var sent uint32
+		for _, toRadio := range device.Received() {
+			if toRadio.GetPacket().GetDecoded().GetPortnum() == pb.PortNum_TEXT_MESSAGE_APP {
+				sent = toRadio.GetPacket().GetId()
+			}
+		}
+		if requestID := fromRadio.GetPacket().GetDecoded().GetRequestId(); requestID != sent || sent == 0 {
+			t.Errorf("Ack is for packet %d, expected %d", requestID, sent)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the ack")
+	}
+
+	// A direct message is acked by its destination, a broadcast only implicitly
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if state, err := sent.Wait(ctx); state != gomesh.DeliveryAcked || err != nil {
+		t.Errorf("Direct message delivery = %s, %v, want acked", state, err)
+	}
+	sent, err = radio.SendTextMessage("hello all", 0, 0)
+	if err != nil {
+		t.Fatalf("Error sending broadcast: %v", err)
+	}
+	if state, err := sent.Wait(ctx); state != gomesh.DeliveryImplicitAck || err != nil {
+		t.Errorf("Broadcast delivery = %s, %v, want implicit ack", state, err)
+	}
+
+	// Unknown channels and nodes are reported back as routing errors
+	_, err = radio.AdminRequestContext(ctx, &pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetChannelRequest{GetChannelRequest: 42}})
+	var routingErr *gomesh.RoutingError
+	if !errors.As(err, &routingErr) || routingErr.Reason != pb.Routing_BAD_REQUEST {
+		t.Errorf("Expected a BAD_REQUEST routing error, got %v", err)
+	}
+}
+
+func TestInjectText(t *testing.T) {
+	device, radio := connect(t)
+
+	texts := radio.Subscribe(gomesh.PacketFilter{PortNums: []pb.PortNum{pb.PortNum_TEXT_MESSAGE_APP}})
+	defer texts.Unsubscribe()
+
+	device.InjectText(otherNode, 0, 0, "hello from the mesh")
+
+	select {
+	case fromRadio := <-texts.C:
+		packet := fromRadio.GetPacket()
+		if packet.GetFrom() != otherNode || string(packet.GetDecoded().GetPayload()) != "hello from the mesh" {
+			t.Errorf("Unexpected packet: %v", packet)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the injected packet")
+	}
+}
+
+func TestListen(t *testing.T) {
+	device := New(Options{NodeNum: 0x42})
+	defer device.Close()
+
+	addr, err := device.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+
+	radio := gomesh.Radio{}
+	if err := radio.Init("tcp://" + addr); err != nil {
+		t.Fatalf("Error connecting over TCP: %v", err)
+	}
+	defer radio.Close()
+
+	if radio.GetNodeID() != 0x42 {
+		t.Errorf("Expected node number 0x42, got 0x%x", radio.GetNodeID())
+	}
+}
+
+func TestDebugLogAPI(t *testing.T) {
+	device, radio := connect(t)
+
+	logs := radio.Logs()
+
+	device.Log(pb.LogRecord_INFO, "Router", "on the console")
+	select {
+	case entry := <-logs:
+		if entry.Raw == "" || entry.Source != "Router" || entry.Message != "on the console" {
+			t.Errorf("Expected a console line, got %+v", entry)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the console line")
+	}
+
+	if err := radio.SetDebugLogAPI(true); err != nil {
+		t.Fatalf("Error enabling the debug log API: %v", err)
+	}
+	roundTrip(t, radio)
+	if !device.Config().GetSecurity().GetDebugLogApiEnabled() {
+		t.Fatal("debug_log_api_enabled not set on the device")
+	}
+
+	device.Log(pb.LogRecord_WARNING, "Power", "as a record")
+	select {
+	case entry := <-logs:
+		if entry.Raw != "" || entry.Level != pb.LogRecord_WARNING || entry.Message != "as a record" {
+			t.Errorf("Expected a LogRecord entry, got %+v", entry)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the log record")
+	}
+}
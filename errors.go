@@ -0,0 +1,87 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// Errors returned by Radio methods. Returned errors wrap these, so test for them with errors.Is
+var (
+	// ErrTimeout means the radio or the mesh did not answer in time. A context that ran out
+	// of time also matches context.DeadlineExceeded
+	ErrTimeout = errors.New("timed out")
+
+	// ErrNotConnected means the radio has not been initialized, has been closed or has lost
+	// its link
+	ErrNotConnected = errors.New("radio not connected")
+
+	// ErrPayloadTooLarge means a message does not fit in a single mesh packet or frame
+	ErrPayloadTooLarge = errors.New("payload too large")
+
+	// ErrChannelNotFound means no channel exists at the requested index
+	ErrChannelNotFound = errors.New("channel not found")
+
+	// ErrNoAck means the destination never acknowledged a packet
+	ErrNoAck = errors.New("no ack received")
+)
+
+// RoutingError is returned when the mesh rejects a packet. Reason is the firmware's
+// explanation; errors.Is maps the reasons that have a sentinel onto it, so MAX_RETRANSMIT and
+// NO_RESPONSE match ErrNoAck, TIMEOUT matches ErrNoAck and ErrTimeout, NO_CHANNEL matches
+// ErrChannelNotFound and TOO_LARGE matches ErrPayloadTooLarge
+type RoutingError struct {
+	PacketID uint32
+	Reason   pb.Routing_Error
+}
+
+func (e *RoutingError) Error() string {
+	return fmt.Sprintf("packet %d rejected by the mesh: %s", e.PacketID, e.Reason)
+}
+
+// Is reports whether target is the sentinel error for e's reason
+func (e *RoutingError) Is(target error) bool {
+	switch e.Reason {
+	case pb.Routing_MAX_RETRANSMIT, pb.Routing_NO_RESPONSE:
+		return target == ErrNoAck
+	case pb.Routing_TIMEOUT:
+		return target == ErrNoAck || target == ErrTimeout
+	case pb.Routing_NO_CHANNEL:
+		return target == ErrChannelNotFound
+	case pb.Routing_TOO_LARGE:
+		return target == ErrPayloadTooLarge
+	}
+	return false
+}
+
+// routingError returns the RoutingError carried by a routing packet answering packetID, or nil
+// if the packet reports success
+func routingError(packetID uint32, routing *pb.Routing) error {
+	if routing.GetErrorReason() == pb.Routing_NONE {
+		return nil
+	}
+	return &RoutingError{PacketID: packetID, Reason: routing.GetErrorReason()}
+}
+
+// contextError returns the error for an operation stopped by ctx: ErrTimeout wrapping
+// context.DeadlineExceeded when ctx ran out of time, the cancellation otherwise, and nil if ctx
+// is not done
+func contextError(ctx context.Context) error {
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// linkError marks errors from a transport that has been closed as ErrNotConnected
+func linkError(err error) error {
+	if errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %w", ErrNotConnected, err)
+	}
+	return err
+}
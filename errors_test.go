@@ -0,0 +1,119 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+func TestRoutingErrorIs(t *testing.T) {
+	sentinels := []error{ErrTimeout, ErrNotConnected, ErrPayloadTooLarge, ErrChannelNotFound, ErrNoAck}
+
+	tests := []struct {
+		reason pb.Routing_Error
+		want   []error
+	}{
+		{pb.Routing_MAX_RETRANSMIT, []error{ErrNoAck}},
+		{pb.Routing_NO_RESPONSE, []error{ErrNoAck}},
+		{pb.Routing_TIMEOUT, []error{ErrNoAck, ErrTimeout}},
+		{pb.Routing_NO_CHANNEL, []error{ErrChannelNotFound}},
+		{pb.Routing_TOO_LARGE, []error{ErrPayloadTooLarge}},
+		{pb.Routing_NO_ROUTE, nil},
+		{pb.Routing_DUTY_CYCLE_LIMIT, nil},
+		{pb.Routing_PKI_FAILED, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason.String(), func(t *testing.T) {
+			err := fmt.Errorf("sending: %w", &RoutingError{PacketID: 42, Reason: tt.reason})
+
+			var routingErr *RoutingError
+			if !errors.As(err, &routingErr) || routingErr.Reason != tt.reason || routingErr.PacketID != 42 {
+				t.Fatalf("errors.As did not find the RoutingError in %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.reason.String()) {
+				t.Errorf("Error %q does not name the reason", err)
+			}
+
+			for _, sentinel := range sentinels {
+				want := false
+				for _, w := range tt.want {
+					want = want || w == sentinel
+				}
+				if got := errors.Is(err, sentinel); got != want {
+					t.Errorf("errors.Is(%v, %v) = %t, want %t", err, sentinel, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRoutingErrorFromRouting(t *testing.T) {
+	if err := routingError(1, &pb.Routing{Variant: &pb.Routing_ErrorReason{ErrorReason: pb.Routing_NONE}}); err != nil {
+		t.Errorf("Expected no error for a clean ack, got %v", err)
+	}
+	if err := routingError(1, &pb.Routing{Variant: &pb.Routing_ErrorReason{ErrorReason: pb.Routing_NO_ROUTE}}); err == nil {
+		t.Error("Expected an error for NO_ROUTE")
+	}
+}
+
+func TestContextError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if err := contextError(ctx); !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected ErrTimeout wrapping DeadlineExceeded, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	if err := contextError(ctx); err != nil {
+		t.Errorf("Expected nil for a live context, got %v", err)
+	}
+	cancel()
+	if err := contextError(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	var radio Radio
+	if _, err := radio.SendTextMessage("hello", 0, 0); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Uninitialized send: expected ErrNotConnected, got %v", err)
+	}
+	if _, err := radio.SendTextMessage(strings.Repeat("x", 241), 0, 0); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("Long text: expected ErrPayloadTooLarge, got %v", err)
+	}
+	if _, err := EncodeFrame(make([]byte, maxToFromRadioSzie+1)); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("Large frame: expected ErrPayloadTooLarge, got %v", err)
+	}
+	if err := linkError(fmt.Errorf("write: %w", net.ErrClosed)); !errors.Is(err, ErrNotConnected) || !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Closed link: expected ErrNotConnected wrapping net.ErrClosed, got %v", err)
+	}
+	if err := linkError(io.ErrUnexpectedEOF); errors.Is(err, ErrNotConnected) {
+		t.Errorf("Other errors should pass through, got %v", err)
+	}
+
+	device := newFakeDevice(t, 0x1234)
+	radio = Radio{HeartbeatInterval: -1}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	// The fake device reports no channels, which is not an error until one is asked for
+	if channels, err := radio.GetChannels(); channels != nil || err != nil {
+		t.Errorf("No channels: expected nil, nil, got %v, %v", channels, err)
+	}
+	if _, err := radio.GetChannelInfo(1); !errors.Is(err, ErrChannelNotFound) {
+		t.Errorf("Missing channel: expected ErrChannelNotFound, got %v", err)
+	}
+	radio.Close()
+	if _, err := radio.SendTextMessage("hello", 0, 0); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Send after Close: expected ErrNotConnected, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package gomesh
+
+import "sync"
+
+// eventBuffer is the number of events a listener can fall behind before the oldest are dropped
+const eventBuffer = 64
+
+// broadcaster fans values out to any number of listener channels. Slow listeners lose their
+// oldest values rather than blocking the publisher. The zero value is ready to use.
+type broadcaster[T any] struct {
+	mu     sync.Mutex
+	subs   []chan T
+	closed bool
+}
+
+// subscribe returns a new listener channel. It is closed when the broadcaster is closed
+func (b *broadcaster[T]) subscribe() <-chan T {
+	ch := make(chan T, eventBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subs = append(b.subs, ch)
+
+	return ch
+}
+
+// publish delivers v to every listener without blocking
+func (b *broadcaster[T]) publish(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ch := range b.subs {
+		offer(ch, v)
+	}
+}
+
+// close closes every listener channel; later subscribers receive a closed channel
+func (b *broadcaster[T]) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	for _, ch := range b.subs {
+		close(ch)
+	}
+	b.subs = nil
+	b.closed = true
+}
@@ -0,0 +1,220 @@
+package gomesh
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// configDumpBuffer is room for a whole config dump: the firmware's node database holds a few
+// hundred nodes at most, and the config, module config and channel frames add a few dozen
+const configDumpBuffer = 2048
+
+// configDumpVariants are the FromRadio frames of a config dump
+var configDumpVariants = []interface{}{
+	&pb.FromRadio_MyInfo{}, &pb.FromRadio_Metadata{}, &pb.FromRadio_NodeInfo{}, &pb.FromRadio_Channel{},
+	&pb.FromRadio_Config{}, &pb.FromRadio_ModuleConfig{}, &pb.FromRadio_FileInfo{},
+	&pb.FromRadio_DeviceuiConfig{}, &pb.FromRadio_ConfigCompleteId{},
+}
+
+// Special WantConfigId nonces understood by the firmware
+const (
+	ConfigOnlyNonce uint32 = 69420 // Send the config, channels and own node but skip the node database
+	NodesOnlyNonce  uint32 = 69421 // Send only the node database
+)
+
+// HandshakeOptions controls a config request
+type HandshakeOptions struct {
+	// Nonce identifies the request. Zero picks a random nonce; ConfigOnlyNonce and
+	// NodesOnlyNonce ask the firmware for a partial dump
+	Nonce uint32
+
+	// Progress, if set, is called after every config frame received. It runs on the
+	// handshake's goroutine and should return quickly
+	Progress func(HandshakeProgress)
+}
+
+// HandshakeProgress counts the config frames received so far
+type HandshakeProgress struct {
+	MyInfo        bool
+	Nodes         int
+	Channels      int
+	Configs       int
+	ModuleConfigs int
+}
+
+// DeviceSnapshot is the radio's state as sent in answer to a config request
+type DeviceSnapshot struct {
+	Nonce        uint32
+	MyInfo       *pb.MyNodeInfo
+	Metadata     *pb.DeviceMetadata
+	Nodes        []*pb.NodeInfo
+	Channels     []*pb.Channel
+	Config       *pb.LocalConfig
+	ModuleConfig *pb.LocalModuleConfig
+
+	// Frames holds every config frame in the order received, ending with the ConfigCompleteId
+	Frames []*pb.FromRadio
+}
+
+// Node returns the node with the given number, or nil if it was not in the snapshot
+func (s *DeviceSnapshot) Node(num uint32) *pb.NodeInfo {
+	for _, node := range s.Nodes {
+		if node.GetNum() == num {
+			return node
+		}
+	}
+	return nil
+}
+
+// Self returns the connected radio's own node, or nil if it was not in the snapshot
+func (s *DeviceSnapshot) Self() *pb.NodeInfo {
+	return s.Node(s.MyInfo.GetMyNodeNum())
+}
+
+// Handshake requests the radio's config and node database
+func (r *Radio) Handshake(opts HandshakeOptions) (*DeviceSnapshot, error) {
+	return r.HandshakeContext(context.Background(), opts)
+}
+
+// HandshakeContext sends WantConfigId and collects the dump until the firmware answers with the
+// matching ConfigCompleteId. Without a deadline on ctx it gives up after thirty seconds
+func (r *Radio) HandshakeContext(ctx context.Context, opts HandshakeOptions) (*DeviceSnapshot, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, handshakeTimeout)
+		defer cancel()
+	}
+
+	nonce := opts.Nonce
+	if nonce == 0 {
+		nonce = randomNonce()
+	}
+
+	// The firmware restarts its dump when a new request arrives, so only one runs at a time
+	r.configMu.Lock()
+	defer r.configMu.Unlock()
+
+	// Subscribe before asking so none of the answer can be missed
+	sub := r.subscribe(PacketFilter{Variants: configDumpVariants}, configDumpBuffer)
+	defer sub.Unsubscribe()
+
+	out, err := proto.Marshal(&pb.ToRadio{PayloadVariant: &pb.ToRadio_WantConfigId{WantConfigId: nonce}})
+	if err != nil {
+		return nil, err
+	}
+
+	r.log().Info("requesting config", "nonce", nonce)
+	if err := r.sendPacket(ctx, out); err != nil {
+		return nil, err
+	}
+
+	snapshot := &DeviceSnapshot{Nonce: nonce, Config: &pb.LocalConfig{}, ModuleConfig: &pb.LocalModuleConfig{}}
+	progress := HandshakeProgress{}
+
+	for {
+		var fromRadio *pb.FromRadio
+		var ok bool
+
+		select {
+		case fromRadio, ok = <-sub.C:
+			if !ok {
+				r.subsMu.Lock()
+				err := r.readErr
+				r.subsMu.Unlock()
+				if err == nil {
+					err = ErrNotConnected
+				}
+				return nil, err
+			}
+		case <-ctx.Done():
+			r.log().Warn("gave up waiting for config", "nonce", nonce, "err", ctx.Err())
+			return nil, contextError(ctx)
+		}
+
+		switch variant := fromRadio.GetPayloadVariant().(type) {
+		case *pb.FromRadio_ConfigCompleteId:
+			if variant.ConfigCompleteId != nonce {
+				// The end of somebody else's request
+				continue
+			}
+			r.subsMu.Lock()
+			dropped := sub.dropped
+			r.subsMu.Unlock()
+			if dropped {
+				r.log().Warn("handshake lost config frames", "nonce", nonce)
+				return nil, fmt.Errorf("config dump %d incomplete: frames were dropped while reading it", nonce)
+			}
+			snapshot.Frames = append(snapshot.Frames, fromRadio)
+			r.log().Info("handshake complete", "nonce", nonce, "nodes", progress.Nodes, "channels", progress.Channels,
+				"configs", progress.Configs, "module_configs", progress.ModuleConfigs)
+			return snapshot, nil
+		case *pb.FromRadio_MyInfo:
+			snapshot.MyInfo = variant.MyInfo
+			progress.MyInfo = true
+		case *pb.FromRadio_Metadata:
+			snapshot.Metadata = variant.Metadata
+		case *pb.FromRadio_NodeInfo:
+			snapshot.Nodes = append(snapshot.Nodes, variant.NodeInfo)
+			progress.Nodes++
+		case *pb.FromRadio_Channel:
+			snapshot.Channels = append(snapshot.Channels, variant.Channel)
+			progress.Channels++
+		case *pb.FromRadio_Config:
+			mergeOneof(r.log(), variant.Config, snapshot.Config)
+			progress.Configs++
+		case *pb.FromRadio_ModuleConfig:
+			mergeOneof(r.log(), variant.ModuleConfig, snapshot.ModuleConfig)
+			progress.ModuleConfigs++
+		case *pb.FromRadio_FileInfo, *pb.FromRadio_DeviceuiConfig:
+			// Part of the dump, kept in Frames only
+		default:
+			continue
+		}
+
+		snapshot.Frames = append(snapshot.Frames, fromRadio)
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+}
+
+// randomNonce returns a nonce that is neither zero nor one of the firmware's special values
+func randomNonce() uint32 {
+	for {
+		nonce := rand.Uint32()
+		if nonce != 0 && nonce != ConfigOnlyNonce && nonce != NodesOnlyNonce {
+			return nonce
+		}
+	}
+}
+
+// mergeOneof copies the variant set in src's oneof into the field of dst with the same name,
+// which is how Config maps onto LocalConfig and ModuleConfig onto LocalModuleConfig
+func mergeOneof(logger *slog.Logger, src proto.Message, dst proto.Message) {
+	srcMsg := src.ProtoReflect()
+	dstMsg := dst.ProtoReflect()
+
+	oneofs := srcMsg.Descriptor().Oneofs()
+	if oneofs.Len() == 0 {
+		return
+	}
+
+	field := srcMsg.WhichOneof(oneofs.Get(0))
+	if field == nil {
+		return
+	}
+
+	dstField := dstMsg.Descriptor().Fields().ByName(field.Name())
+	if dstField == nil || dstField.Message() == nil || field.Message() == nil ||
+		dstField.Message().FullName() != field.Message().FullName() {
+		logger.Debug("no snapshot field for config", "field", string(field.FullName()))
+		return
+	}
+
+	dstMsg.Set(dstField, srcMsg.Get(field))
+}
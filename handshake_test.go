@@ -0,0 +1,149 @@
+package gomesh
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+func TestHandshakeSnapshot(t *testing.T) {
+	device := newFakeDevice(t, 0x11)
+
+	radio := Radio{}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	device.setDump([]*pb.FromRadio{
+		{PayloadVariant: &pb.FromRadio_Metadata{Metadata: &pb.DeviceMetadata{FirmwareVersion: "2.5.0"}}},
+		{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: 0x11, User: &pb.User{LongName: "Me"}}}},
+		textPacket(0x99, 0, "traffic during the dump"),
+		{PayloadVariant: &pb.FromRadio_ConfigCompleteId{ConfigCompleteId: 1}},
+		{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: 0x99}}},
+		{PayloadVariant: &pb.FromRadio_Channel{Channel: &pb.Channel{Index: 0, Role: pb.Channel_PRIMARY}}},
+		{PayloadVariant: &pb.FromRadio_Config{Config: &pb.Config{PayloadVariant: &pb.Config_Lora{Lora: &pb.Config_LoRaConfig{HopLimit: 5}}}}},
+		{PayloadVariant: &pb.FromRadio_ModuleConfig{ModuleConfig: &pb.ModuleConfig{PayloadVariant: &pb.ModuleConfig_Mqtt{Mqtt: &pb.ModuleConfig_MQTTConfig{Enabled: true}}}}},
+	})
+	for len(device.received) > 0 {
+		<-device.received
+	}
+
+	var progress []HandshakeProgress
+	snapshot, err := radio.Handshake(HandshakeOptions{Progress: func(p HandshakeProgress) { progress = append(progress, p) }})
+	if err != nil {
+		t.Fatalf("Error in handshake: %v", err)
+	}
+
+	if sent := (<-device.received).GetWantConfigId(); sent != snapshot.Nonce || sent == 0 {
+		t.Errorf("Expected random nonce %d to be sent, radio got %d", snapshot.Nonce, sent)
+	}
+
+	if snapshot.MyInfo.GetMyNodeNum() != 0x11 || snapshot.Metadata.GetFirmwareVersion() != "2.5.0" {
+		t.Errorf("Unexpected MyInfo or Metadata: %v %v", snapshot.MyInfo, snapshot.Metadata)
+	}
+	if len(snapshot.Nodes) != 2 || snapshot.Self().GetUser().GetLongName() != "Me" || snapshot.Node(0x99) == nil {
+		t.Errorf("Unexpected nodes: %v", snapshot.Nodes)
+	}
+	if len(snapshot.Channels) != 1 || snapshot.Channels[0].Role != pb.Channel_PRIMARY {
+		t.Errorf("Unexpected channels: %v", snapshot.Channels)
+	}
+	if snapshot.Config.GetLora().GetHopLimit() != 5 || !snapshot.ModuleConfig.GetMqtt().GetEnabled() {
+		t.Errorf("Config not merged into snapshot: %v %v", snapshot.Config, snapshot.ModuleConfig)
+	}
+
+	// MyInfo, metadata, two nodes, channel, config, module config and the complete id
+	if len(snapshot.Frames) != 8 || snapshot.Frames[7].GetConfigCompleteId() != snapshot.Nonce {
+		t.Errorf("Expected 8 frames ending with the complete id, got %d", len(snapshot.Frames))
+	}
+
+	final := progress[len(progress)-1]
+	expected := HandshakeProgress{MyInfo: true, Nodes: 2, Channels: 1, Configs: 1, ModuleConfigs: 1}
+	if len(progress) != 7 || final != expected {
+		t.Errorf("Unexpected progress reports: %+v", progress)
+	}
+}
+
+func TestHandshakeSpecialNonces(t *testing.T) {
+	device := newFakeDevice(t, 0x12)
+
+	radio := Radio{}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	for _, nonce := range []uint32{ConfigOnlyNonce, NodesOnlyNonce} {
+		for len(device.received) > 0 {
+			<-device.received
+		}
+
+		snapshot, err := radio.Handshake(HandshakeOptions{Nonce: nonce})
+		if err != nil {
+			t.Fatalf("Error in handshake with nonce %d: %v", nonce, err)
+		}
+		if snapshot.Nonce != nonce {
+			t.Errorf("Expected nonce %d, got %d", nonce, snapshot.Nonce)
+		}
+		if sent := (<-device.received).GetWantConfigId(); sent != nonce {
+			t.Errorf("Expected radio to receive nonce %d, got %d", nonce, sent)
+		}
+	}
+}
+
+func TestHandshakeLargeNodeDB(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   int
+		wantErr bool
+	}{
+		{"fits", 600, false},
+		{"overflows", configDumpBuffer + 100, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := newFakeDevice(t, 0x11)
+			radio := Radio{HeartbeatInterval: -1}
+			if err := radio.InitWithTransport(device.dial(t)); err != nil {
+				t.Fatalf("Error initializing radio: %v", err)
+			}
+			defer radio.Close()
+
+			dump := make([]*pb.FromRadio, tt.nodes)
+			for i := range dump {
+				dump[i] = &pb.FromRadio{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: uint32(0x1000 + i)}}}
+			}
+			device.setDump(dump)
+
+			// Hold the handshake back until the whole dump has been read, as a slow caller would
+			complete := radio.Subscribe(PacketFilter{Variants: []interface{}{&pb.FromRadio_ConfigCompleteId{}}})
+			var once sync.Once
+			progress := func(HandshakeProgress) {
+				once.Do(func() {
+					select {
+					case <-complete.C:
+					case <-time.After(5 * time.Second):
+						t.Error("Timed out waiting for the end of the dump")
+					}
+				})
+			}
+
+			snapshot, err := radio.Handshake(HandshakeOptions{Progress: progress})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Handshake with %d dropped frames succeeded", tt.nodes-configDumpBuffer)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Handshake: %v", err)
+			}
+			if len(snapshot.Nodes) != tt.nodes {
+				t.Errorf("Snapshot has %d nodes, want %d", len(snapshot.Nodes), tt.nodes)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package gomesh
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultHeartbeatInterval is used when Radio.HeartbeatInterval is zero. The firmware drops
+// idle TCP API clients after fifteen minutes
+const DefaultHeartbeatInterval = 5 * time.Minute
+
+// maxHeartbeatFailures is the number of consecutive failed heartbeats after which the link is dropped
+const maxHeartbeatFailures = 3
+
+// disconnectTimeout bounds the Disconnect sent by Close
+const disconnectTimeout = time.Second
+
+// heartbeatInterval returns the configured interval, or zero if heartbeats are disabled
+func (r *Radio) heartbeatInterval() time.Duration {
+	if r.HeartbeatInterval < 0 {
+		return 0
+	}
+	if r.HeartbeatInterval == 0 {
+		return DefaultHeartbeatInterval
+	}
+	return r.HeartbeatInterval
+}
+
+// heartbeat keeps the link alive until the radio is closed. A failed heartbeat is reported as
+// ConnectionUnhealthy; after maxHeartbeatFailures in a row the transport is closed so the
+// reader sees the link as lost and the reconnect policy, if any, takes over
+func (r *Radio) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.closeCtx.Done():
+			return
+		}
+
+		err := r.sendHeartbeat(r.closeCtx)
+		if r.closeCtx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			failures++
+			r.log().Warn("heartbeat failed", "failures", failures, "max_failures", maxHeartbeatFailures, "err", err)
+			r.emitConnection(ConnectionUnhealthy, 0, err)
+
+			if failures >= maxHeartbeatFailures {
+				r.log().Error("radio not responding to heartbeats, dropping link")
+				r.conn().Close()
+				failures = 0
+			}
+			continue
+		}
+
+		if failures > 0 {
+			r.log().Info("heartbeat link healthy again")
+			r.emitConnection(ConnectionHealthy, 0, nil)
+		}
+		failures = 0
+	}
+}
+
+func (r *Radio) sendHeartbeat(ctx context.Context) error {
+	out, err := proto.Marshal(&pb.ToRadio{PayloadVariant: &pb.ToRadio_Heartbeat{Heartbeat: &pb.Heartbeat{}}})
+	if err != nil {
+		return err
+	}
+
+	r.log().Debug("sending heartbeat")
+	return r.sendPacket(ctx, out)
+}
+
+// sendDisconnect tells the firmware that this client is going away
+func (r *Radio) sendDisconnect() error {
+	out, err := proto.Marshal(&pb.ToRadio{PayloadVariant: &pb.ToRadio_Disconnect{Disconnect: true}})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+
+	return r.sendPacket(ctx, out)
+}
@@ -0,0 +1,97 @@
+package gomesh
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// brokenWrites wraps a transport so writes can be made to fail
+type brokenWrites struct {
+	Transport
+	broken atomic.Bool
+}
+
+func (b *brokenWrites) Write(p []byte) (int, error) {
+	if b.broken.Load() {
+		return 0, errors.New("write failed")
+	}
+	return b.Transport.Write(p)
+}
+
+// waitForToRadio reads what the fake device received until match returns true
+func waitForToRadio(t *testing.T, device *fakeDevice, match func(*pb.ToRadio) bool) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case toRadio := <-device.received:
+			if match(toRadio) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for packet on fake device")
+		}
+	}
+}
+
+func TestHeartbeatAndDisconnect(t *testing.T) {
+	device := newFakeDevice(t, 0x51)
+
+	radio := Radio{HeartbeatInterval: 20 * time.Millisecond}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+
+	waitForToRadio(t, device, func(toRadio *pb.ToRadio) bool { return toRadio.GetHeartbeat() != nil })
+
+	radio.Close()
+
+	waitForToRadio(t, device, func(toRadio *pb.ToRadio) bool { return toRadio.GetDisconnect() })
+}
+
+func TestHeartbeatFailureEvents(t *testing.T) {
+	device := newFakeDevice(t, 0x52)
+	transport := &brokenWrites{Transport: device.dial(t)}
+
+	radio := Radio{HeartbeatInterval: 20 * time.Millisecond}
+	events := radio.ConnectionEvents()
+	if err := radio.InitWithTransport(transport); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	transport.broken.Store(true)
+
+	if event := waitForState(t, events, ConnectionUnhealthy); event.Err == nil {
+		t.Errorf("Expected the heartbeat error on the event")
+	}
+
+	// Repeated failures drop the link, which closes a radio with no reconnect policy
+	waitForState(t, events, ConnectionClosed)
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		setting  time.Duration
+		expected time.Duration
+	}{
+		{"Default", 0, DefaultHeartbeatInterval},
+		{"Custom", time.Minute, time.Minute},
+		{"Disabled", -1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			radio := Radio{HeartbeatInterval: tt.setting}
+			if result := radio.heartbeatInterval(); result != tt.expected {
+				t.Errorf("heartbeatInterval() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
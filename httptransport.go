@@ -0,0 +1,341 @@
+package gomesh
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPollInterval is how often the HTTP transport asks an idle radio for new frames
+const defaultPollInterval = 500 * time.Millisecond
+
+// maxHTTPFailures is the number of consecutive failed requests after which the link is reported as lost
+const maxHTTPFailures = 3
+
+// httpRequestTimeout bounds each request to the radio's HTTP API
+const httpRequestTimeout = 10 * time.Second
+
+// HTTPTransportOptions configures NewHTTPTransport
+type HTTPTransportOptions struct {
+	// PollInterval is the wait between polls once the radio has no more frames. Defaults to 500ms
+	PollInterval time.Duration
+
+	// InsecureSkipVerify accepts the self-signed certificates radios serve over https
+	InsecureSkipVerify bool
+
+	// TLSConfig is used for https URLs instead of the default configuration
+	TLSConfig *tls.Config
+
+	// Client replaces the HTTP client, for example to add a proxy. TLS options are then ignored
+	Client *http.Client
+}
+
+// httpTransport speaks the HTTP API served by WiFi radios and meshtasticd. ToRadio frames are
+// PUT to /api/v1/toradio and FromRadio frames are fetched one at a time from
+// /api/v1/fromradio?all=false until the radio returns an empty body. To the Radio it looks like
+// any other stream: writes carry framed protobufs and reads return framed protobufs
+type httpTransport struct {
+	baseURL      string
+	client       *http.Client
+	pollInterval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	frames chan []byte
+	kick   chan struct{}
+
+	mu            sync.Mutex
+	pending       []byte
+	written       []byte
+	readErr       error
+	readDeadline  time.Time
+	writeDeadline time.Time
+	deadlineMoved chan struct{}
+}
+
+// NewHTTPTransport connects to the HTTP API of a radio at baseURL, e.g. http://meshtastic.local
+// or https://192.168.1.20. The radio is polled in the background until the transport is closed
+func NewHTTPTransport(baseURL string, opts HTTPTransportOptions) (Transport, error) {
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		return nil, fmt.Errorf("invalid HTTP API URL %q: must start with http:// or https://", baseURL)
+	}
+
+	client := opts.Client
+	if client == nil {
+		tlsConfig := opts.TLSConfig
+		if tlsConfig == nil && opts.InsecureSkipVerify {
+			tlsConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		client = &http.Client{
+			Timeout:   httpRequestTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		}
+	}
+
+	pollInterval := opts.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &httpTransport{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		client:        client,
+		pollInterval:  pollInterval,
+		ctx:           ctx,
+		cancel:        cancel,
+		frames:        make(chan []byte, inboxBuffer),
+		kick:          make(chan struct{}, 1),
+		deadlineMoved: make(chan struct{}),
+	}
+
+	go h.poll()
+
+	return h, nil
+}
+
+// poll fetches frames from the radio until the transport is closed or the radio stops answering
+func (h *httpTransport) poll() {
+	failures := 0
+
+	for {
+		payload, err := h.fetch()
+		if err != nil {
+			if h.ctx.Err() != nil {
+				return
+			}
+			failures++
+			defaultLogger().Warn("http poll failed", "url", h.baseURL, "failures", failures, "max_failures", maxHTTPFailures, "err", err)
+			if failures >= maxHTTPFailures {
+				h.fail(err)
+				return
+			}
+		} else {
+			failures = 0
+		}
+
+		if len(payload) > 0 {
+			frame, err := EncodeFrame(payload)
+			if err != nil {
+				defaultLogger().Warn("http dropping frame", "url", h.baseURL, "err", err)
+				continue
+			}
+			select {
+			case h.frames <- frame:
+			case <-h.ctx.Done():
+				return
+			}
+			// The radio may have more queued, so ask again straight away
+			continue
+		}
+
+		select {
+		case <-time.After(h.pollInterval):
+		case <-h.kick:
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// fetch GETs one FromRadio payload. An empty payload means the radio has nothing queued
+func (h *httpTransport) fetch() ([]byte, error) {
+	request, err := http.NewRequestWithContext(h.ctx, http.MethodGet, h.baseURL+"/api/v1/fromradio?all=false", nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/x-protobuf")
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET fromradio: %s", response.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(response.Body, maxToFromRadioSzie+1))
+}
+
+// fail records a fatal error for Read to return
+func (h *httpTransport) fail(err error) {
+	h.mu.Lock()
+	h.readErr = err
+	h.mu.Unlock()
+
+	close(h.frames)
+}
+
+// Read returns framed FromRadio protobufs as they are fetched from the radio
+func (h *httpTransport) Read(p []byte) (int, error) {
+	for {
+		h.mu.Lock()
+		if len(h.pending) > 0 {
+			n := copy(p, h.pending)
+			h.pending = h.pending[n:]
+			h.mu.Unlock()
+			return n, nil
+		}
+		deadline := h.readDeadline
+		moved := h.deadlineMoved
+		h.mu.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+
+		var frame []byte
+		var open bool
+		var err error
+		select {
+		case frame, open = <-h.frames:
+			if !open {
+				h.mu.Lock()
+				err = h.readErr
+				h.mu.Unlock()
+				if err == nil {
+					err = net.ErrClosed
+				}
+			}
+		case <-h.ctx.Done():
+			err = net.ErrClosed
+		case <-expired:
+			err = os.ErrDeadlineExceeded
+		case <-moved:
+			// Wait again with the new deadline
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if err != nil {
+			return 0, err
+		}
+		h.mu.Lock()
+		h.pending = frame
+		h.mu.Unlock()
+	}
+}
+
+// Write PUTs every complete frame in p to the radio. Bytes outside of frames are discarded,
+// since the HTTP API has no console
+func (h *httpTransport) Write(p []byte) (int, error) {
+	if h.ctx.Err() != nil {
+		return 0, net.ErrClosed
+	}
+
+	h.mu.Lock()
+	h.written = append(h.written, p...)
+	var payloads [][]byte
+	for {
+		start := bytes.IndexByte(h.written, start1)
+		if start < 0 {
+			h.written = nil
+			break
+		}
+		h.written = h.written[start:]
+		if len(h.written) < headerLen {
+			break
+		}
+		if h.written[1] != start2 {
+			h.written = h.written[1:]
+			continue
+		}
+		length := int(h.written[2])<<8 | int(h.written[3])
+		if len(h.written) < headerLen+length {
+			break
+		}
+		payloads = append(payloads, append([]byte(nil), h.written[headerLen:headerLen+length]...))
+		h.written = h.written[headerLen+length:]
+	}
+	deadline := h.writeDeadline
+	h.mu.Unlock()
+
+	ctx := h.ctx
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	for _, payload := range payloads {
+		if err := h.put(ctx, payload); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return 0, os.ErrDeadlineExceeded
+			}
+			return 0, err
+		}
+	}
+
+	// Poll right away to pick up the answer
+	select {
+	case h.kick <- struct{}{}:
+	default:
+	}
+
+	return len(p), nil
+}
+
+func (h *httpTransport) put(ctx context.Context, payload []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, h.baseURL+"/api/v1/toradio", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-protobuf")
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("PUT toradio: %s", response.Status)
+	}
+
+	return nil
+}
+
+// Close stops polling and unblocks pending reads
+func (h *httpTransport) Close() error {
+	h.cancel()
+	return nil
+}
+
+func (h *httpTransport) SetReadDeadline(t time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.readDeadline = t
+	close(h.deadlineMoved)
+	h.deadlineMoved = make(chan struct{})
+
+	return nil
+}
+
+func (h *httpTransport) SetWriteDeadline(t time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeDeadline = t
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package gomesh
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeHTTPDevice serves the radio HTTP API, answering config requests with a MyInfo packet
+type fakeHTTPDevice struct {
+	nodeNum uint32
+
+	mu       sync.Mutex
+	queue    []*pb.FromRadio
+	received []*pb.ToRadio
+	badQuery bool
+}
+
+func (d *fakeHTTPDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPut && r.URL.Path == "/api/v1/toradio":
+		body, _ := io.ReadAll(r.Body)
+		toRadio := &pb.ToRadio{}
+		if err := proto.Unmarshal(body, toRadio); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d.received = append(d.received, toRadio)
+		if want := toRadio.GetWantConfigId(); want != 0 {
+			d.queue = append(d.queue,
+				&pb.FromRadio{PayloadVariant: &pb.FromRadio_MyInfo{MyInfo: &pb.MyNodeInfo{MyNodeNum: d.nodeNum}}},
+				&pb.FromRadio{PayloadVariant: &pb.FromRadio_ConfigCompleteId{ConfigCompleteId: want}})
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/fromradio":
+		if r.URL.Query().Get("all") != "false" {
+			d.badQuery = true
+		}
+		if len(d.queue) == 0 {
+			return
+		}
+		out, _ := proto.Marshal(d.queue[0])
+		d.queue = d.queue[1:]
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(out)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (d *fakeHTTPDevice) push(fromRadio *pb.FromRadio) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.queue = append(d.queue, fromRadio)
+}
+
+func TestHTTPTransport(t *testing.T) {
+	device := &fakeHTTPDevice{nodeNum: 0xbeef}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	transport, err := NewHTTPTransport(server.URL, HTTPTransportOptions{PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Error creating transport: %v", err)
+	}
+
+	radio := Radio{}
+	if err := radio.InitWithTransport(transport); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	if radio.GetNodeID() != 0xbeef {
+		t.Fatalf("Expected node number 0xbeef, got 0x%x", radio.GetNodeID())
+	}
+
+	sub := radio.Subscribe(PacketFilter{PortNums: []pb.PortNum{pb.PortNum_TEXT_MESSAGE_APP}})
+	device.push(textPacket(0x99, 0, "over http"))
+
+	select {
+	case frame := <-sub.C:
+		if string(frame.GetPacket().GetDecoded().GetPayload()) != "over http" {
+			t.Fatalf("Unexpected frame: %v", frame)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for polled packet")
+	}
+
+	if _, err := radio.SendTextMessage("hello", 0x99, 0); err != nil {
+		t.Fatalf("Error sending: %v", err)
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	if device.badQuery {
+		t.Errorf("Expected every poll to use all=false")
+	}
+	last := device.received[len(device.received)-1]
+	if string(last.GetPacket().GetDecoded().GetPayload()) != "hello" {
+		t.Errorf("Expected text message PUT to the radio, got %v", last)
+	}
+}
+
+func TestHTTPTransportTLS(t *testing.T) {
+	server := httptest.NewTLSServer(&fakeHTTPDevice{nodeNum: 0xcafe})
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		insecure bool
+		wantErr  bool
+	}{
+		{"Self-signed certificate rejected", false, true},
+		{"Self-signed certificate accepted", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := NewHTTPTransport(server.URL, HTTPTransportOptions{
+				PollInterval:       20 * time.Millisecond,
+				InsecureSkipVerify: tt.insecure,
+			})
+			if err != nil {
+				t.Fatalf("Error creating transport: %v", err)
+			}
+
+			radio := Radio{}
+			err = radio.InitWithTransport(transport)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InitWithTransport error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				radio.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package gomesh
+
+import (
+	"log"
+	"log/slog"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// LogLevel controls the verbosity of debug logging
+type LogLevel int
+
+const (
+	LogLevelSilent LogLevel = iota // No debug logs
+	LogLevelError                  // Only errors
+	LogLevelWarn                   // Errors and warnings
+	LogLevelInfo                   // Errors, warnings, and info
+	LogLevelDebug                  // All logs including debug
+)
+
+// levelSilent is above every level gomesh logs at
+const levelSilent = slog.LevelError + 4
+
+// slogLevel returns the lowest slog level shown at level
+func (level LogLevel) slogLevel() slog.Level {
+	switch {
+	case level <= LogLevelSilent:
+		return levelSilent
+	case level == LogLevelError:
+		return slog.LevelError
+	case level == LogLevelWarn:
+		return slog.LevelWarn
+	case level == LogLevelInfo:
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
+
+// globalLogLevel filters the logs of radios without their own Logger and of the package
+// level helpers. The zero value is slog.LevelInfo, matching LogLevelInfo
+var globalLogLevel slog.LevelVar
+
+// SetLogLevel sets the level for logs written through the standard log package. It is kept for
+// compatibility: it has no effect on a Radio with its own Logger, which filters by its handler's
+// level instead
+func SetLogLevel(level LogLevel) {
+	globalLogLevel.Set(level.slogLevel())
+}
+
+// logWriter hands each formatted record to the standard log package, so logs keep its
+// timestamps and follow log.SetOutput as they always have
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	if err := log.Output(2, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// packageLogger is used by radios without a Logger and by the package level helpers
+var packageLogger = slog.New(slog.NewTextHandler(logWriter{}, &slog.HandlerOptions{
+	Level: &globalLogLevel,
+	ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+		// The log package adds its own timestamp
+		if len(groups) == 0 && attr.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return attr
+	},
+}))
+
+// defaultLogger returns the logger for code without a Radio of its own
+func defaultLogger() *slog.Logger {
+	return packageLogger
+}
+
+// log returns the radio's logger, tagged with its port and node number once they are known
+func (r *Radio) log() *slog.Logger {
+	if logger := r.tagged.Load(); logger != nil {
+		return logger
+	}
+	if r.Logger != nil {
+		return r.Logger
+	}
+	return defaultLogger()
+}
+
+// retagLogger rebuilds the logger returned by log after the port or node number changed. The
+// caller holds connMu
+func (r *Radio) retagLogger() {
+	logger := r.Logger
+	if logger == nil {
+		logger = defaultLogger()
+	}
+
+	var attrs []any
+	if r.port != "" {
+		attrs = append(attrs, "port", r.port)
+	}
+	if r.nodeNum != 0 {
+		attrs = append(attrs, "node_num", r.nodeNum)
+	}
+	if len(attrs) > 0 {
+		logger = logger.With(attrs...)
+	}
+
+	r.tagged.Store(logger)
+}
+
+// packetAttrs returns the id, destination and port of a mesh packet as log attributes, followed
+// by args. A nil packet adds nothing
+func packetAttrs(packet *pb.MeshPacket, args ...any) []any {
+	if packet == nil {
+		return args
+	}
+
+	attrs := []any{"packet_id", packet.GetId(), "to", packet.GetTo()}
+	if decoded := packet.GetDecoded(); decoded != nil {
+		attrs = append(attrs, "portnum", decoded.GetPortnum().String())
+	}
+
+	return append(attrs, args...)
+}
@@ -0,0 +1,118 @@
+package gomesh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// syncBuffer is a bytes.Buffer safe for the radio's background goroutines to log into
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSetLogLevel(t *testing.T) {
+	defer SetLogLevel(LogLevelInfo)
+
+	tests := []struct {
+		level   LogLevel
+		enabled []slog.Level
+		dropped []slog.Level
+	}{
+		{LogLevelSilent, nil, []slog.Level{slog.LevelError, slog.LevelWarn, slog.LevelInfo, slog.LevelDebug}},
+		{LogLevelError, []slog.Level{slog.LevelError}, []slog.Level{slog.LevelWarn, slog.LevelInfo, slog.LevelDebug}},
+		{LogLevelWarn, []slog.Level{slog.LevelError, slog.LevelWarn}, []slog.Level{slog.LevelInfo, slog.LevelDebug}},
+		{LogLevelInfo, []slog.Level{slog.LevelError, slog.LevelWarn, slog.LevelInfo}, []slog.Level{slog.LevelDebug}},
+		{LogLevelDebug, []slog.Level{slog.LevelError, slog.LevelWarn, slog.LevelInfo, slog.LevelDebug}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.slogLevel().String(), func(t *testing.T) {
+			SetLogLevel(tt.level)
+			handler := defaultLogger().Handler()
+
+			for _, level := range tt.enabled {
+				if !handler.Enabled(context.Background(), level) {
+					t.Errorf("Expected %v to be logged at LogLevel %d", level, tt.level)
+				}
+			}
+			for _, level := range tt.dropped {
+				if handler.Enabled(context.Background(), level) {
+					t.Errorf("Expected %v to be dropped at LogLevel %d", level, tt.level)
+				}
+			}
+		})
+	}
+}
+
+func TestRadioLogger(t *testing.T) {
+	// A radio's own logger ignores the global level
+	SetLogLevel(LogLevelSilent)
+	defer SetLogLevel(LogLevelInfo)
+
+	out := &syncBuffer{}
+	device := newFakeDevice(t, 0x1234)
+	radio := &Radio{
+		HeartbeatInterval: -1,
+		Logger:            slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	if _, err := radio.SendTextMessage("hello", 0x5678, 0); err != nil {
+		t.Fatalf("Error sending text: %v", err)
+	}
+
+	var sent map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Log line is not JSON: %q", line)
+		}
+		if record["msg"] == "packet sent" && record["portnum"] == pb.PortNum_TEXT_MESSAGE_APP.String() {
+			sent = record
+		}
+	}
+	if sent == nil {
+		t.Fatalf("No packet sent record in log:\n%s", out.String())
+	}
+
+	if sent["node_num"] != float64(0x1234) {
+		t.Errorf("node_num = %v, want %d", sent["node_num"], 0x1234)
+	}
+	if sent["to"] != float64(0x5678) {
+		t.Errorf("to = %v, want %d", sent["to"], 0x5678)
+	}
+	if id, ok := sent["packet_id"].(float64); !ok || id == 0 {
+		t.Errorf("packet_id = %v, want a packet id", sent["packet_id"])
+	}
+	if bytes, ok := sent["bytes"].(float64); !ok || bytes <= 4 {
+		t.Errorf("bytes = %v, want the frame length", sent["bytes"])
+	}
+
+	// The tagged logger is built once, not on every call
+	if allocs := testing.AllocsPerRun(100, func() { radio.log() }); allocs != 0 {
+		t.Errorf("log() allocates %v times per call, want none", allocs)
+	}
+}
@@ -9,22 +9,26 @@ import (
 
 // MessageMetadata contains reply and reaction information
 type MessageMetadata struct {
-	ReplyTo   string `json:"r,omitempty"` // Message ID being replied to
-	Type      string `json:"t,omitempty"` // "reply" or "reaction"
-	Reaction  string `json:"e,omitempty"` // Emoji for reactions
+	ReplyTo   string `json:"r,omitempty"`  // Message ID being replied to
+	Type      string `json:"t,omitempty"`  // "reply" or "reaction"
+	Reaction  string `json:"e,omitempty"`  // Emoji for reactions
 	ReplyText string `json:"rt,omitempty"` // Original message text for iOS fallback
+	ReplyID   uint32 `json:"-"`            // Packet ID being replied to, for native replies and reactions
 }
 
 // ParsedMessage represents a message with extracted metadata
 type ParsedMessage struct {
 	Text     string
 	Metadata *MessageMetadata
-	Format   string // "enhanced", "ios", "simple", "plain"
+	Format   string // "native", "enhanced", "ios", "simple", "plain"
 }
 
 // FormatReplyMessage creates a reply message with enhanced format and iOS fallback
 // Enhanced format: 🔗{"r":"msgId","t":"reply"}actual message text
 // iOS fallback: ↩️ @username: original message\n\nReply text
+//
+// Deprecated: official apps show this format as text. Use Radio.SendReply, which sets the
+// packet's native ReplyId
 func FormatReplyMessage(replyToID string, replyToText string, replyToAuthor string, replyText string) string {
 	// Create metadata
 	metadata := MessageMetadata{
@@ -55,6 +59,9 @@ func FormatReplyMessage(replyToID string, replyToText string, replyToAuthor stri
 // FormatReactionMessage creates a reaction message
 // Enhanced format: 👍{"r":"msgId","t":"reaction","e":"emoji"}
 // Simple format: 👍::messageId
+//
+// Deprecated: official apps show this format as text. Use Radio.SendReaction, which sends a
+// native tapback
 func FormatReactionMessage(messageID string, emoji string) string {
 	// Create metadata
 	metadata := MessageMetadata{
@@ -84,6 +91,7 @@ func FormatReactionMessage(messageID string, emoji string) string {
 
 // ParseMessage parses a message and extracts metadata
 // Supports: enhanced format, iOS format, simple reactions, and plain text
+// Use ParsePacket for received packets, which also understands native replies and reactions
 func ParseMessage(text string) *ParsedMessage {
 	result := &ParsedMessage{
 		Text:   text,
@@ -187,6 +195,11 @@ func GetDisplayText(parsed *ParsedMessage) string {
 	}
 
 	switch parsed.Format {
+	case "native":
+		if IsReaction(parsed) {
+			return "" // Reactions don't have display text
+		}
+		return parsed.Text
 	case "enhanced", "ios":
 		return parsed.Text
 	case "simple":
@@ -205,4 +218,3 @@ func IsReply(parsed *ParsedMessage) bool {
 func IsReaction(parsed *ParsedMessage) bool {
 	return parsed != nil && parsed.Metadata != nil && parsed.Metadata.Type == "reaction"
 }
-
@@ -0,0 +1,140 @@
+package gomesh
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// TextMessage is a text message received from the mesh, decoded from its packet
+type TextMessage struct {
+	PacketID     uint32
+	From         uint32
+	To           uint32 // The destination node, broadcastNum for channel messages
+	Channel      uint32 // The channel index
+	ChannelName  string // The channel's name, or the modem preset's for an unnamed primary channel
+	Text         string // The text as sent, see Parsed for replies and reactions
+	RxTime       time.Time
+	RxSnr        float32
+	RxRssi       int32
+	Hops         int  // Hops the message took to reach this radio, -1 if the sender's firmware does not say
+	ViaMQTT      bool // The message crossed an MQTT bridge
+	PKIEncrypted bool // The message was a direct message encrypted with the nodes' public keys
+	ReplyID      uint32
+	Emoji        bool // Text is a reaction to the message ReplyID
+	Parsed       *ParsedMessage
+	Packet       *pb.MeshPacket // Shared with other listeners, treat it as read only
+}
+
+// IsDirect reports whether the message was sent to one node rather than a channel
+func (m *TextMessage) IsDirect() bool {
+	return m.To != broadcastNum
+}
+
+// Messages returns a channel of the text messages the radio receives. Each call returns a new
+// channel, closed when the radio is closed
+func (r *Radio) Messages() <-chan TextMessage {
+	return r.messages.subscribe()
+}
+
+// hopsAway returns the hops a packet took to reach the radio, or -1 if the sender's firmware
+// does not say
+func hopsAway(packet *pb.MeshPacket) int {
+	if packet.GetHopStart() == 0 {
+		return -1
+	}
+	return int(packet.GetHopStart()) - int(packet.GetHopLimit())
+}
+
+// textMessage decodes a text message packet
+func (r *Radio) textMessage(packet *pb.MeshPacket) TextMessage {
+	decoded := packet.GetDecoded()
+
+	message := TextMessage{
+		PacketID:     packet.GetId(),
+		From:         packet.GetFrom(),
+		To:           packet.GetTo(),
+		Channel:      packet.GetChannel(),
+		ChannelName:  r.channels.name(packet.GetChannel()),
+		Text:         string(decoded.GetPayload()),
+		RxSnr:        packet.GetRxSnr(),
+		RxRssi:       packet.GetRxRssi(),
+		Hops:         hopsAway(packet),
+		ViaMQTT:      packet.GetViaMqtt(),
+		PKIEncrypted: packet.GetPkiEncrypted(),
+		ReplyID:      decoded.GetReplyId(),
+		Emoji:        decoded.GetEmoji() != 0,
+		Parsed:       ParsePacket(packet),
+		Packet:       packet,
+	}
+	if packet.GetRxTime() != 0 {
+		message.RxTime = time.Unix(int64(packet.GetRxTime()), 0)
+	}
+
+	return message
+}
+
+// channelNames follows the channel settings and modem preset the radio reports, to name the
+// channel of each message
+type channelNames struct {
+	mu     sync.Mutex
+	names  map[uint32]string
+	roles  map[uint32]pb.Channel_Role
+	preset string
+}
+
+// update records a channel frame. Disabled channels are forgotten
+func (c *channelNames) update(channel *pb.Channel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.names == nil {
+		c.names = make(map[uint32]string)
+		c.roles = make(map[uint32]pb.Channel_Role)
+	}
+
+	index := uint32(channel.GetIndex())
+	if channel.GetRole() == pb.Channel_DISABLED {
+		delete(c.names, index)
+		delete(c.roles, index)
+		return
+	}
+	c.names[index] = channel.GetSettings().GetName()
+	c.roles[index] = channel.GetRole()
+}
+
+// updateLora records the modem preset, which names an unnamed primary channel
+func (c *channelNames) updateLora(lora *pb.Config_LoRaConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.preset = presetName(lora)
+}
+
+// name returns the name of the channel at index, empty if the channel is unknown
+func (c *channelNames) name(index uint32) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if name := c.names[index]; name != "" || c.roles[index] != pb.Channel_PRIMARY {
+		return name
+	}
+	return c.preset
+}
+
+// presetName returns the name the official apps show for a modem preset, such as LongFast
+func presetName(lora *pb.Config_LoRaConfig) string {
+	if !lora.GetUsePreset() {
+		return "Custom"
+	}
+
+	words := strings.Split(strings.ToLower(lora.GetModemPreset().String()), "_")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, "")
+}
@@ -0,0 +1,106 @@
+package gomesh
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+func TestPresetName(t *testing.T) {
+	tests := []struct {
+		lora *pb.Config_LoRaConfig
+		want string
+	}{
+		{&pb.Config_LoRaConfig{UsePreset: true}, "LongFast"},
+		{&pb.Config_LoRaConfig{UsePreset: true, ModemPreset: pb.Config_LoRaConfig_MEDIUM_SLOW}, "MediumSlow"},
+		{&pb.Config_LoRaConfig{UsePreset: false, ModemPreset: pb.Config_LoRaConfig_SHORT_FAST}, "Custom"},
+	}
+
+	for _, tt := range tests {
+		if got := presetName(tt.lora); got != tt.want {
+			t.Errorf("presetName(%v) = %q, want %q", tt.lora, got, tt.want)
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	const self, other = 0x1234, 0x5678
+
+	device := newFakeDevice(t, self)
+	device.setDump([]*pb.FromRadio{
+		{PayloadVariant: &pb.FromRadio_Channel{Channel: &pb.Channel{Index: 0, Role: pb.Channel_PRIMARY, Settings: &pb.ChannelSettings{}}}},
+		{PayloadVariant: &pb.FromRadio_Channel{Channel: &pb.Channel{Index: 1, Role: pb.Channel_SECONDARY, Settings: &pb.ChannelSettings{Name: "ops"}}}},
+		{PayloadVariant: &pb.FromRadio_Config{Config: &pb.Config{PayloadVariant: &pb.Config_Lora{Lora: &pb.Config_LoRaConfig{
+			UsePreset:   true,
+			ModemPreset: pb.Config_LoRaConfig_MEDIUM_SLOW,
+		}}}}},
+	})
+
+	radio := &Radio{HeartbeatInterval: -1}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	messages := radio.Messages()
+
+	direct := textPacket(other, 0, "psst")
+	packet := direct.GetPacket()
+	packet.Id, packet.To, packet.RxTime = 1, self, 1700000000
+	packet.RxSnr, packet.RxRssi = 6.25, -90
+	packet.HopStart, packet.HopLimit = 3, 1
+	packet.PkiEncrypted = true
+
+	reply := textPacket(other, 1, "roger")
+	packet = reply.GetPacket()
+	packet.Id, packet.To, packet.ViaMqtt = 2, broadcastNum, true
+	packet.GetDecoded().ReplyId = 1
+
+	reaction := textPacket(other, 2, "🎉")
+	packet = reaction.GetPacket()
+	packet.Id, packet.To = 3, broadcastNum
+	packet.GetDecoded().ReplyId, packet.GetDecoded().Emoji = 2, 1
+
+	// Other ports are not messages
+	position := textPacket(other, 0, "")
+	position.GetPacket().GetDecoded().Portnum = pb.PortNum_POSITION_APP
+
+	for _, fromRadio := range []*pb.FromRadio{direct, position, reply, reaction} {
+		device.push(fromRadio)
+	}
+
+	tests := []struct {
+		name  string
+		check func(TextMessage) bool
+	}{
+		{"direct", func(m TextMessage) bool {
+			return m.PacketID == 1 && m.From == other && m.IsDirect() && m.Text == "psst" &&
+				m.ChannelName == "MediumSlow" && m.RxTime.Equal(time.Unix(1700000000, 0)) &&
+				m.RxSnr == 6.25 && m.RxRssi == -90 && m.Hops == 2 && m.PKIEncrypted && !m.ViaMQTT &&
+				m.Parsed.Format == "plain"
+		}},
+		{"reply", func(m TextMessage) bool {
+			return m.PacketID == 2 && !m.IsDirect() && m.Channel == 1 && m.ChannelName == "ops" &&
+				m.RxTime.IsZero() && m.Hops == -1 && m.ViaMQTT && m.ReplyID == 1 && !m.Emoji &&
+				IsReply(m.Parsed) && GetDisplayText(m.Parsed) == "roger"
+		}},
+		{"reaction", func(m TextMessage) bool {
+			return m.PacketID == 3 && m.Channel == 2 && m.ChannelName == "" && m.ReplyID == 2 && m.Emoji &&
+				IsReaction(m.Parsed) && m.Parsed.Metadata.Reaction == "🎉"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			select {
+			case message := <-messages:
+				if !tt.check(message) {
+					t.Errorf("Unexpected message: %+v", message)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Timed out waiting for the message")
+			}
+		})
+	}
+}
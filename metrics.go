@@ -0,0 +1,377 @@
+package gomesh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// AckLatencyBuckets are the upper bounds, in seconds, of the ack latency histogram. Acks from
+// the local radio arrive in milliseconds, acks over the mesh can take tens of seconds
+var AckLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// HistogramSnapshot is a copy of a histogram. Counts[i] is the number of observations no larger
+// than Buckets[i]; observations above the last bucket are only in Count
+type HistogramSnapshot struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64 // Seconds
+}
+
+// MetricsSnapshot is a point in time copy of a radio's metrics. Counters start at zero when the
+// radio is created and keep counting across reconnects
+type MetricsSnapshot struct {
+	BytesReceived   uint64            // Bytes read from the transport
+	BytesSent       uint64            // Bytes written to the transport
+	Frames          uint64            // Protobuf frames split out of the stream
+	FramesDecoded   uint64            // Frames that decoded as FromRadio
+	DecodeErrors    uint64            // Frames that were empty or failed proto.Unmarshal
+	TextChunks      uint64            // Chunks of console text between frames
+	Resyncs         uint64            // Times a bad header forced the framer to search for the next frame
+	DroppedBytes    uint64            // Bytes the framer discarded while resyncing
+	Reconnects      uint64            // Successful reconnects
+	QueueDepth      int               // Mesh packets waiting in the outbound queue
+	PacketsIn       map[string]uint64 // Mesh packets received, by PortNum name
+	PacketsOut      map[string]uint64 // Mesh packets handed to the radio, by PortNum name
+	RoutingErrors   map[string]uint64 // Routing errors received in answer to our packets, by reason
+	AckLatency      HistogramSnapshot // Time from handing a packet to the radio to its routing ack
+	AcksOutstanding int               // Sent packets still waiting for an ack
+}
+
+// histogram counts observations into fixed buckets
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{
+		Buckets: append([]float64(nil), h.buckets...),
+		Counts:  make([]uint64, len(h.buckets)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+	copy(s.Counts, h.counts)
+	return s
+}
+
+// radioMetrics holds the counters a Radio maintains. The zero value is ready to use
+type radioMetrics struct {
+	mu            sync.Mutex
+	snapshot      MetricsSnapshot // Counters only; maps and histogram are kept below
+	packetsIn     map[string]uint64
+	packetsOut    map[string]uint64
+	routingErrors map[string]uint64
+	ackLatency    histogram
+	awaitingAck   map[uint32]time.Time
+}
+
+// portLabel names the port of a mesh packet, or ENCRYPTED when it could not be decoded
+func portLabel(packet *pb.MeshPacket) string {
+	if decoded := packet.GetDecoded(); decoded != nil {
+		return decoded.GetPortnum().String()
+	}
+	return "ENCRYPTED"
+}
+
+func countLabel(counts *map[string]uint64, label string) {
+	if *counts == nil {
+		*counts = make(map[string]uint64)
+	}
+	(*counts)[label]++
+}
+
+// addFrameStats adds what a FrameReader counted since its last report
+func (m *radioMetrics) addFrameStats(delta FrameStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.snapshot.BytesReceived += uint64(delta.Bytes)
+	m.snapshot.Frames += uint64(delta.Frames)
+	m.snapshot.TextChunks += uint64(delta.TextChunks)
+	m.snapshot.Resyncs += uint64(delta.Resyncs)
+	m.snapshot.DroppedBytes += uint64(delta.DroppedBytes)
+}
+
+func (m *radioMetrics) decoded(ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ok {
+		m.snapshot.FramesDecoded++
+	} else {
+		m.snapshot.DecodeErrors++
+	}
+}
+
+func (m *radioMetrics) bytesSent(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.snapshot.BytesSent += uint64(n)
+}
+
+func (m *radioMetrics) reconnected() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.snapshot.Reconnects++
+}
+
+// packetSent counts a mesh packet handed to the radio and starts its ack clock
+func (m *radioMetrics) packetSent(packet *pb.MeshPacket, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	countLabel(&m.packetsOut, portLabel(packet))
+
+	if !packet.GetWantAck() || packet.GetId() == 0 {
+		return
+	}
+	if m.awaitingAck == nil {
+		m.awaitingAck = make(map[uint32]time.Time)
+	}
+	for id, sent := range m.awaitingAck {
+		if now.Sub(sent) > ackTimeout {
+			delete(m.awaitingAck, id)
+		}
+	}
+	m.awaitingAck[packet.GetId()] = now
+}
+
+// packetReceived counts a mesh packet from the radio. A routing packet answering one of ours
+// stops its ack clock
+func (m *radioMetrics) packetReceived(packet *pb.MeshPacket, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	countLabel(&m.packetsIn, portLabel(packet))
+
+	decoded := packet.GetDecoded()
+	if decoded.GetPortnum() != pb.PortNum_ROUTING_APP || decoded.GetRequestId() == 0 {
+		return
+	}
+	sent, ok := m.awaitingAck[decoded.GetRequestId()]
+	if !ok {
+		return
+	}
+	delete(m.awaitingAck, decoded.GetRequestId())
+
+	routing := pb.Routing{}
+	if err := proto.Unmarshal(decoded.GetPayload(), &routing); err == nil && routing.GetErrorReason() != pb.Routing_NONE {
+		countLabel(&m.routingErrors, routing.GetErrorReason().String())
+		return
+	}
+	m.latency().observe(now.Sub(sent).Seconds())
+}
+
+// latency returns the ack latency histogram, setting up its buckets on first use
+func (m *radioMetrics) latency() *histogram {
+	if m.ackLatency.buckets == nil {
+		m.ackLatency.buckets = AckLatencyBuckets
+	}
+	return &m.ackLatency
+}
+
+func copyCounts(counts map[string]uint64) map[string]uint64 {
+	out := make(map[string]uint64, len(counts))
+	for k, v := range counts {
+		out[k] = v
+	}
+	return out
+}
+
+// Metrics returns a copy of the radio's link and packet metrics
+func (r *Radio) Metrics() MetricsSnapshot {
+	m := &r.metrics
+	m.mu.Lock()
+	s := m.snapshot
+	s.PacketsIn = copyCounts(m.packetsIn)
+	s.PacketsOut = copyCounts(m.packetsOut)
+	s.RoutingErrors = copyCounts(m.routingErrors)
+	s.AckLatency = m.latency().snapshot()
+	s.AcksOutstanding = len(m.awaitingAck)
+	m.mu.Unlock()
+
+	s.QueueDepth = r.QueueDepth()
+
+	return s
+}
+
+// metricSample is one line of a metric family. Histograms use suffix for their _bucket, _sum
+// and _count series
+type metricSample struct {
+	suffix string
+	labels string
+	value  float64
+}
+
+// metricFamily is a metric with its help text and one sample per radio and label set
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []metricSample
+}
+
+// radioLabels identifies a radio in the exposition by port and node number
+func (r *Radio) radioLabels() string {
+	r.connMu.Lock()
+	port, nodeNum := r.port, r.nodeNum
+	r.connMu.Unlock()
+
+	return fmt.Sprintf(`port="%s",node_num="%d"`, labelEscaper.Replace(port), nodeNum)
+}
+
+// labelEscaper escapes a Prometheus label value
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes the metrics of radios in the Prometheus text exposition format
+func WritePrometheus(w io.Writer, radios ...*Radio) error {
+	counters := []struct {
+		name  string
+		help  string
+		value func(s *MetricsSnapshot) uint64
+	}{
+		{"gomesh_received_bytes_total", "Bytes read from the radio.", func(s *MetricsSnapshot) uint64 { return s.BytesReceived }},
+		{"gomesh_sent_bytes_total", "Bytes written to the radio.", func(s *MetricsSnapshot) uint64 { return s.BytesSent }},
+		{"gomesh_frames_total", "Protobuf frames read from the stream.", func(s *MetricsSnapshot) uint64 { return s.Frames }},
+		{"gomesh_frames_decoded_total", "Frames decoded as FromRadio.", func(s *MetricsSnapshot) uint64 { return s.FramesDecoded }},
+		{"gomesh_frame_decode_errors_total", "Frames that were empty or failed to decode.", func(s *MetricsSnapshot) uint64 { return s.DecodeErrors }},
+		{"gomesh_text_chunks_total", "Chunks of console text read from the stream.", func(s *MetricsSnapshot) uint64 { return s.TextChunks }},
+		{"gomesh_framer_resyncs_total", "Times a bad frame header forced a resync.", func(s *MetricsSnapshot) uint64 { return s.Resyncs }},
+		{"gomesh_framer_dropped_bytes_total", "Bytes discarded while resyncing.", func(s *MetricsSnapshot) uint64 { return s.DroppedBytes }},
+		{"gomesh_reconnects_total", "Successful reconnects.", func(s *MetricsSnapshot) uint64 { return s.Reconnects }},
+	}
+
+	snapshots := make([]MetricsSnapshot, len(radios))
+	labels := make([]string, len(radios))
+	for i, radio := range radios {
+		snapshots[i] = radio.Metrics()
+		labels[i] = radio.radioLabels()
+	}
+
+	var families []metricFamily
+	for _, counter := range counters {
+		family := metricFamily{name: counter.name, help: counter.help, kind: "counter"}
+		for i := range snapshots {
+			family.samples = append(family.samples, metricSample{labels: labels[i], value: float64(counter.value(&snapshots[i]))})
+		}
+		families = append(families, family)
+	}
+
+	labelled := []struct {
+		name   string
+		help   string
+		label  string
+		counts func(s *MetricsSnapshot) map[string]uint64
+	}{
+		{"gomesh_packets_received_total", "Mesh packets received, by port.", "portnum", func(s *MetricsSnapshot) map[string]uint64 { return s.PacketsIn }},
+		{"gomesh_packets_sent_total", "Mesh packets handed to the radio, by port.", "portnum", func(s *MetricsSnapshot) map[string]uint64 { return s.PacketsOut }},
+		{"gomesh_routing_errors_total", "Routing errors received for sent packets, by reason.", "reason", func(s *MetricsSnapshot) map[string]uint64 { return s.RoutingErrors }},
+	}
+	for _, counter := range labelled {
+		family := metricFamily{name: counter.name, help: counter.help, kind: "counter"}
+		for i := range snapshots {
+			counts := counter.counts(&snapshots[i])
+			keys := make([]string, 0, len(counts))
+			for key := range counts {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				family.samples = append(family.samples, metricSample{
+					labels: fmt.Sprintf(`%s,%s="%s"`, labels[i], counter.label, labelEscaper.Replace(key)),
+					value:  float64(counts[key]),
+				})
+			}
+		}
+		families = append(families, family)
+	}
+
+	gauges := []metricFamily{
+		{name: "gomesh_queue_depth", help: "Mesh packets waiting in the outbound queue.", kind: "gauge"},
+		{name: "gomesh_acks_outstanding", help: "Sent packets waiting for an ack.", kind: "gauge"},
+	}
+	for i := range snapshots {
+		gauges[0].samples = append(gauges[0].samples, metricSample{labels: labels[i], value: float64(snapshots[i].QueueDepth)})
+		gauges[1].samples = append(gauges[1].samples, metricSample{labels: labels[i], value: float64(snapshots[i].AcksOutstanding)})
+	}
+	families = append(families, gauges...)
+
+	latency := metricFamily{name: "gomesh_ack_latency_seconds", help: "Time from handing a packet to the radio to its ack.", kind: "histogram"}
+	for i := range snapshots {
+		h := snapshots[i].AckLatency
+		for b, bound := range h.Buckets {
+			latency.samples = append(latency.samples, metricSample{
+				suffix: "_bucket",
+				labels: fmt.Sprintf(`%s,le="%s"`, labels[i], formatFloat(bound)),
+				value:  float64(h.Counts[b]),
+			})
+		}
+		latency.samples = append(latency.samples,
+			metricSample{suffix: "_bucket", labels: labels[i] + `,le="+Inf"`, value: float64(h.Count)},
+			metricSample{suffix: "_sum", labels: labels[i], value: h.Sum},
+			metricSample{suffix: "_count", labels: labels[i], value: float64(h.Count)},
+		)
+	}
+	families = append(families, latency)
+
+	out := bufio.NewWriter(w)
+	for _, family := range families {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.kind)
+		for _, sample := range family.samples {
+			fmt.Fprintf(out, "%s%s{%s} %s\n", family.name, sample.suffix, sample.labels, formatFloat(sample.value))
+		}
+	}
+
+	return out.Flush()
+}
+
+// formatFloat formats a sample value the way Prometheus expects
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// MetricsHandler returns an http.Handler serving the metrics of radios in the Prometheus text
+// format, for mounting at /metrics
+func MetricsHandler(radios ...*Radio) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := WritePrometheus(w, radios...); err != nil {
+			defaultLogger().Warn("writing metrics failed", "err", err)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package gomesh
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// routingAnswer returns the routing packet the firmware sends in answer to packet id
+func routingAnswer(t *testing.T, id uint32, reason pb.Routing_Error) *pb.FromRadio {
+	t.Helper()
+
+	payload, err := proto.Marshal(&pb.Routing{Variant: &pb.Routing_ErrorReason{ErrorReason: reason}})
+	if err != nil {
+		t.Fatalf("Error marshalling routing: %v", err)
+	}
+
+	return &pb.FromRadio{PayloadVariant: &pb.FromRadio_Packet{Packet: &pb.MeshPacket{
+		Id: newPacketID(),
+		PayloadVariant: &pb.MeshPacket_Decoded{Decoded: &pb.Data{
+			Portnum:   pb.PortNum_ROUTING_APP,
+			Payload:   payload,
+			RequestId: id,
+		}},
+	}}}
+}
+
+// waitForMetrics polls the radio's metrics until done reports true
+func waitForMetrics(t *testing.T, radio *Radio, done func(MetricsSnapshot) bool) MetricsSnapshot {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		metrics := radio.Metrics()
+		if done(metrics) {
+			return metrics
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for metrics, have %+v", metrics)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := histogram{buckets: []float64{0.1, 1, 10}}
+	for _, v := range []float64{0.05, 0.1, 0.5, 5, 50} {
+		h.observe(v)
+	}
+
+	s := h.snapshot()
+	want := []uint64{2, 3, 4}
+	for i := range want {
+		if s.Counts[i] != want[i] {
+			t.Errorf("Counts[%d] = %d, want %d", i, s.Counts[i], want[i])
+		}
+	}
+	if s.Count != 5 || s.Sum != 55.65 {
+		t.Errorf("Count, Sum = %d, %v, want 5, 55.65", s.Count, s.Sum)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	device := newFakeDevice(t, 0x1234)
+	radio := &Radio{HeartbeatInterval: -1}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	// Two packets wanting acks: one is acked, the other fails to route
+	for i, reason := range []pb.Routing_Error{pb.Routing_NONE, pb.Routing_NO_ROUTE} {
+		id := uint32(100 + i)
+		out, err := proto.Marshal(&pb.ToRadio{PayloadVariant: &pb.ToRadio_Packet{Packet: &pb.MeshPacket{
+			Id:      id,
+			To:      0x5678,
+			WantAck: true,
+			PayloadVariant: &pb.MeshPacket_Decoded{Decoded: &pb.Data{
+				Portnum: pb.PortNum_TEXT_MESSAGE_APP,
+				Payload: []byte("hello"),
+			}},
+		}}})
+		if err != nil {
+			t.Fatalf("Error marshalling packet: %v", err)
+		}
+		if err := radio.sendPacket(context.Background(), out); err != nil {
+			t.Fatalf("Error sending packet: %v", err)
+		}
+		device.push(routingAnswer(t, id, reason))
+	}
+
+	device.push(textPacket(0x5678, 0, "hi"))
+	// A frame that does not decode and a header announcing an impossible length
+	device.pushText(string([]byte{start1, start2, 0x00, 0x02, 0xff, 0xff}))
+	device.pushText(string([]byte{start1, start2, 0xff, 0xff}))
+	device.push(textPacket(0x5678, 0, "after resync"))
+
+	metrics := waitForMetrics(t, radio, func(m MetricsSnapshot) bool {
+		return m.PacketsIn[pb.PortNum_TEXT_MESSAGE_APP.String()] == 2
+	})
+
+	if got := metrics.PacketsOut[pb.PortNum_TEXT_MESSAGE_APP.String()]; got != 2 {
+		t.Errorf("PacketsOut[TEXT_MESSAGE_APP] = %d, want 2", got)
+	}
+	if got := metrics.PacketsIn[pb.PortNum_ROUTING_APP.String()]; got != 2 {
+		t.Errorf("PacketsIn[ROUTING_APP] = %d, want 2", got)
+	}
+	if got := metrics.RoutingErrors[pb.Routing_NO_ROUTE.String()]; got != 1 {
+		t.Errorf("RoutingErrors[NO_ROUTE] = %d, want 1", got)
+	}
+	if metrics.AckLatency.Count != 1 || metrics.AcksOutstanding != 0 {
+		t.Errorf("AckLatency.Count, AcksOutstanding = %d, %d, want 1, 0", metrics.AckLatency.Count, metrics.AcksOutstanding)
+	}
+	if metrics.DecodeErrors != 1 {
+		t.Errorf("DecodeErrors = %d, want 1", metrics.DecodeErrors)
+	}
+	if metrics.Resyncs == 0 {
+		t.Errorf("Resyncs = 0, want the bad header counted")
+	}
+	if metrics.Frames != metrics.FramesDecoded+metrics.DecodeErrors {
+		t.Errorf("Frames = %d, want FramesDecoded + DecodeErrors = %d", metrics.Frames, metrics.FramesDecoded+metrics.DecodeErrors)
+	}
+	if metrics.BytesReceived == 0 || metrics.BytesSent == 0 {
+		t.Errorf("BytesReceived, BytesSent = %d, %d, want both counted", metrics.BytesReceived, metrics.BytesSent)
+	}
+
+	server := httptest.NewServer(MetricsHandler(radio))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Error fetching metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading metrics: %v", err)
+	}
+
+	for _, want := range []string{
+		"# TYPE gomesh_packets_sent_total counter",
+		`gomesh_packets_sent_total{port="",node_num="4660",portnum="TEXT_MESSAGE_APP"} 2`,
+		`gomesh_routing_errors_total{port="",node_num="4660",reason="NO_ROUTE"} 1`,
+		`gomesh_frame_decode_errors_total{port="",node_num="4660"} 1`,
+		"# TYPE gomesh_ack_latency_seconds histogram",
+		`gomesh_ack_latency_seconds_bucket{port="",node_num="4660",le="+Inf"} 1`,
+		`gomesh_ack_latency_seconds_count{port="",node_num="4660"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Metrics output missing %q:\n%s", want, body)
+		}
+	}
+}
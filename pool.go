@@ -0,0 +1,338 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// dedupeWindow is how long a pool remembers a packet, so copies heard later by other radios
+// are recognized. Mesh rebroadcasts arrive within seconds; the window leaves plenty of margin
+const dedupeWindow = 10 * time.Minute
+
+// maxTrackedPackets caps the number of packets a pool remembers on a busy mesh
+const maxTrackedPackets = 4096
+
+// Reception records one radio of a pool hearing a mesh packet
+type Reception struct {
+	Radio  *Radio
+	RxSnr  float32
+	RxRssi int32
+	Hops   int // Hops the packet took to reach this radio, -1 if the sender's firmware does not say
+	Time   time.Time
+}
+
+// PoolPacket is a mesh packet delivered once by a RadioPool however many of its radios heard it
+type PoolPacket struct {
+	Packet *pb.MeshPacket // The first copy heard. Shared with other listeners, treat it as read only
+	First  Reception      // The radio that heard it first
+}
+
+// RadioSelector picks the radio a RadioPool sends a packet to node to through
+type RadioSelector func(pool *RadioPool, to uint32) (*Radio, error)
+
+// packetKey identifies a mesh packet across radios
+type packetKey struct {
+	from uint32
+	id   uint32
+}
+
+// heardPacket is what a pool remembers about a packet
+type heardPacket struct {
+	key        packetKey
+	receptions []Reception
+}
+
+// RadioPool merges the incoming packets of several radios, for example radios at different
+// sites or with different antennas on one host. A packet heard by more than one radio is
+// delivered once, and every reception is recorded with its SNR and RSSI. Sends go through the
+// radio chosen by Selector. A RadioPool is safe for use by multiple goroutines
+type RadioPool struct {
+	// Selector chooses the radio for sends. Nil uses RoundRobin
+	Selector RadioSelector
+
+	mu       sync.Mutex
+	radios   []*Radio
+	subs     []*Subscription
+	next     int
+	heard    map[packetKey]*heardPacket
+	order    []*heardPacket                  // Oldest first, for expiry
+	lastRx   map[uint32]map[*Radio]Reception // The latest reception from each node by each radio
+	prunedRx time.Time                       // When lastRx was last scanned for old receptions
+	packets  broadcaster[PoolPacket]
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewRadioPool returns a pool of initialized radios. The pool takes ownership of the radios and
+// closes them when it is closed. Listing a radio twice is an error, in which case the caller
+// keeps ownership of every radio
+func NewRadioPool(radios ...*Radio) (*RadioPool, error) {
+	p := &RadioPool{
+		heard:  make(map[packetKey]*heardPacket),
+		lastRx: make(map[uint32]map[*Radio]Reception),
+	}
+	for _, radio := range radios {
+		if err := p.Add(radio); err != nil {
+			p.stop(false)
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Add puts another initialized radio in the pool
+func (p *RadioPool) Add(radio *Radio) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return errors.New("pool closed")
+	}
+	for _, r := range p.radios {
+		if r == radio {
+			return errors.New("radio already in pool")
+		}
+	}
+
+	sub := radio.Subscribe(PacketFilter{Variants: []interface{}{&pb.FromRadio_Packet{}}})
+	p.radios = append(p.radios, radio)
+	p.subs = append(p.subs, sub)
+
+	p.wg.Add(1)
+	go p.receive(radio, sub)
+
+	return nil
+}
+
+// Radios returns the radios in the pool in the order they were added
+func (p *RadioPool) Radios() []*Radio {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*Radio(nil), p.radios...)
+}
+
+// Packets returns a channel of the packets heard by any radio in the pool, each delivered once.
+// Each call returns a new channel, closed when the pool is closed
+func (p *RadioPool) Packets() <-chan PoolPacket {
+	return p.packets.subscribe()
+}
+
+// Receptions returns every reception of the packet with the given sender and id that the pool
+// still remembers, first heard first
+func (p *RadioPool) Receptions(from uint32, id uint32) []Reception {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	heard, ok := p.heard[packetKey{from: from, id: id}]
+	if !ok {
+		return nil
+	}
+	return append([]Reception(nil), heard.receptions...)
+}
+
+// Close closes every radio in the pool and the Packets channels
+func (p *RadioPool) Close() {
+	p.stop(true)
+}
+
+// stop stops listening to the radios, closing them if closeRadios is set, and closes the
+// Packets channels
+func (p *RadioPool) stop(closeRadios bool) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	radios := p.radios
+	subs := p.subs
+	p.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Unsubscribe()
+	}
+	if closeRadios {
+		for _, radio := range radios {
+			radio.Close()
+		}
+	}
+
+	p.wg.Wait()
+	p.packets.close()
+}
+
+// receive feeds the packets of one radio into the pool until its subscription ends
+func (p *RadioPool) receive(radio *Radio, sub *Subscription) {
+	defer p.wg.Done()
+
+	for fromRadio := range sub.C {
+		if packet := fromRadio.GetPacket(); packet != nil {
+			p.heardBy(radio, packet, time.Now())
+		}
+	}
+}
+
+// heardBy records a reception and delivers the packet if no other radio has heard it yet
+func (p *RadioPool) heardBy(radio *Radio, packet *pb.MeshPacket, now time.Time) {
+	reception := Reception{
+		Radio:  radio,
+		RxSnr:  packet.GetRxSnr(),
+		RxRssi: packet.GetRxRssi(),
+		Hops:   hopsAway(packet),
+		Time:   now,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire(now)
+
+	if p.lastRx[packet.GetFrom()] == nil {
+		p.lastRx[packet.GetFrom()] = make(map[*Radio]Reception)
+	}
+	p.lastRx[packet.GetFrom()][radio] = reception
+
+	// Without an id there is nothing to match copies on
+	if packet.GetId() == 0 {
+		p.packets.publish(PoolPacket{Packet: packet, First: reception})
+		return
+	}
+
+	key := packetKey{from: packet.GetFrom(), id: packet.GetId()}
+	if heard, ok := p.heard[key]; ok {
+		heard.receptions = append(heard.receptions, reception)
+		return
+	}
+
+	heard := &heardPacket{key: key, receptions: []Reception{reception}}
+	p.heard[key] = heard
+	p.order = append(p.order, heard)
+	p.packets.publish(PoolPacket{Packet: packet, First: reception})
+}
+
+// expire forgets packets first heard before the dedupe window, and the oldest packets once too
+// many are remembered. Receptions older than the window are forgotten too, scanning for them
+// at most once a minute. The caller holds mu
+func (p *RadioPool) expire(now time.Time) {
+	drop := 0
+	for drop < len(p.order) {
+		first := p.order[drop].receptions[0].Time
+		if now.Sub(first) <= dedupeWindow && len(p.order)-drop < maxTrackedPackets {
+			break
+		}
+		delete(p.heard, p.order[drop].key)
+		drop++
+	}
+	if drop > 0 {
+		p.order = append([]*heardPacket(nil), p.order[drop:]...)
+	}
+
+	if now.Sub(p.prunedRx) < time.Minute {
+		return
+	}
+	p.prunedRx = now
+	for from, byRadio := range p.lastRx {
+		for radio, reception := range byRadio {
+			if now.Sub(reception.Time) > dedupeWindow {
+				delete(byRadio, radio)
+			}
+		}
+		if len(byRadio) == 0 {
+			delete(p.lastRx, from)
+		}
+	}
+}
+
+// RoundRobin sends through each radio of the pool in turn
+func RoundRobin(pool *RadioPool, to uint32) (*Radio, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if len(pool.radios) == 0 {
+		return nil, errors.New("pool has no radios")
+	}
+	radio := pool.radios[pool.next%len(pool.radios)]
+	pool.next++
+
+	return radio, nil
+}
+
+// BestSNR sends through the radio that last heard the destination with the best SNR. SNR is
+// measured on the last hop only, so radios that heard the destination over fewer hops are
+// preferred and SNR breaks the tie; an unknown hop count ranks after any known one. Broadcasts
+// and destinations no radio has heard within the dedupe window fall back to RoundRobin
+func BestSNR(pool *RadioPool, to uint32) (*Radio, error) {
+	pool.mu.Lock()
+	var best *Radio
+	var bestRx Reception
+	if to != broadcastNum {
+		now := time.Now()
+		for _, radio := range pool.radios {
+			reception, ok := pool.lastRx[to][radio]
+			if ok && now.Sub(reception.Time) <= dedupeWindow && (best == nil || reception.betterThan(bestRx)) {
+				best, bestRx = radio, reception
+			}
+		}
+	}
+	pool.mu.Unlock()
+
+	if best == nil {
+		return RoundRobin(pool, to)
+	}
+	return best, nil
+}
+
+// betterThan reports whether rx came over fewer hops than other, or over as many with a better SNR
+func (rx Reception) betterThan(other Reception) bool {
+	if rx.Hops != other.Hops {
+		if rx.Hops < 0 || other.Hops < 0 {
+			return other.Hops < 0
+		}
+		return rx.Hops < other.Hops
+	}
+	return rx.RxSnr > other.RxSnr
+}
+
+// Explicit always sends through radio
+func Explicit(radio *Radio) RadioSelector {
+	return func(pool *RadioPool, to uint32) (*Radio, error) {
+		return radio, nil
+	}
+}
+
+// Pick returns the radio the pool's Selector chooses for a packet to node to, for sending with
+// any of the Radio methods
+func (p *RadioPool) Pick(to uint32) (*Radio, error) {
+	selector := p.Selector
+	if selector == nil {
+		selector = RoundRobin
+	}
+	return selector(p, to)
+}
+
+// SendTextMessage sends a text message through the radio chosen by the pool's Selector
+func (p *RadioPool) SendTextMessage(message string, to int64, channel int64) (*SentPacket, error) {
+	return p.SendTextMessageContext(context.Background(), message, to, channel)
+}
+
+// SendTextMessageContext sends a text message through the radio chosen by the pool's Selector,
+// giving up when ctx is done
+func (p *RadioPool) SendTextMessageContext(ctx context.Context, message string, to int64, channel int64) (*SentPacket, error) {
+	destination := uint32(to)
+	if to == 0 {
+		destination = broadcastNum
+	}
+
+	radio, err := p.Pick(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	return radio.SendTextMessageContext(ctx, message, to, channel)
+}
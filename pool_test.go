@@ -0,0 +1,223 @@
+package gomesh
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// poolOf returns a pool of radios connected to fresh fake devices
+func poolOf(t *testing.T, n int) (*RadioPool, []*fakeDevice) {
+	t.Helper()
+
+	pool, err := NewRadioPool()
+	if err != nil {
+		t.Fatalf("Error creating pool: %v", err)
+	}
+	devices := make([]*fakeDevice, n)
+	for i := range devices {
+		devices[i] = newFakeDevice(t, uint32(0x100+i))
+		radio := &Radio{HeartbeatInterval: -1}
+		if err := radio.InitWithTransport(devices[i].dial(t)); err != nil {
+			t.Fatalf("Error initializing radio %d: %v", i, err)
+		}
+		if err := pool.Add(radio); err != nil {
+			t.Fatalf("Error adding radio %d: %v", i, err)
+		}
+	}
+	t.Cleanup(pool.Close)
+
+	return pool, devices
+}
+
+// heard returns a packet from node from as received with the given SNR
+func heard(from uint32, id uint32, snr float32) *pb.FromRadio {
+	fromRadio := textPacket(from, 0, "diversity")
+	fromRadio.GetPacket().Id = id
+	fromRadio.GetPacket().RxSnr = snr
+	fromRadio.GetPacket().RxRssi = -100
+	fromRadio.GetPacket().HopStart = 3
+	fromRadio.GetPacket().HopLimit = 2
+	return fromRadio
+}
+
+// waitForReceptions polls until the pool has recorded n receptions of a packet
+func waitForReceptions(t *testing.T, pool *RadioPool, from uint32, id uint32, n int) []Reception {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		receptions := pool.Receptions(from, id)
+		if len(receptions) >= n {
+			return receptions
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d receptions, have %d", n, len(receptions))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRadioPoolDedupe(t *testing.T) {
+	pool, devices := poolOf(t, 2)
+	radios := pool.Radios()
+	packets := pool.Packets()
+
+	devices[0].push(heard(0x42, 7, 2.5))
+	receptions := waitForReceptions(t, pool, 0x42, 7, 1)
+	devices[1].push(heard(0x42, 7, 9))
+	receptions = waitForReceptions(t, pool, 0x42, 7, 2)
+
+	if receptions[0].Radio != radios[0] || receptions[0].RxSnr != 2.5 {
+		t.Errorf("First reception = %+v, want radio 0 at 2.5 dB", receptions[0])
+	}
+	if receptions[1].Radio != radios[1] || receptions[1].RxSnr != 9 || receptions[1].RxRssi != -100 || receptions[1].Hops != 1 {
+		t.Errorf("Second reception = %+v, want radio 1 at 9 dB, -100 dBm, 1 hop", receptions[1])
+	}
+
+	select {
+	case packet := <-packets:
+		if packet.Packet.GetId() != 7 || packet.First.Radio != radios[0] {
+			t.Errorf("Unexpected pool packet: %+v", packet)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the pool packet")
+	}
+	select {
+	case packet := <-packets:
+		t.Errorf("Packet delivered twice: %+v", packet)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The same id from another node is a different packet
+	devices[1].push(heard(0x43, 7, 1))
+	select {
+	case packet := <-packets:
+		if packet.Packet.GetFrom() != 0x43 {
+			t.Errorf("Unexpected pool packet: %+v", packet)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the second node's packet")
+	}
+}
+
+func TestRadioPoolSelectors(t *testing.T) {
+	pool, devices := poolOf(t, 3)
+	radios := pool.Radios()
+
+	// Node 0x42 is heard best by the third radio
+	for i, snr := range []float32{1, -4, 6} {
+		devices[i].push(heard(0x42, 9, snr))
+	}
+	waitForReceptions(t, pool, 0x42, 9, 3)
+
+	// Node 0x43 is heard directly by the first radio and through a relay, with a better SNR on
+	// the last hop, by the third
+	direct := heard(0x43, 10, -2)
+	direct.GetPacket().HopLimit = 3
+	devices[0].push(direct)
+	devices[2].push(heard(0x43, 10, 6))
+	waitForReceptions(t, pool, 0x43, 10, 2)
+
+	tests := []struct {
+		name     string
+		selector RadioSelector
+		to       []uint32
+		want     []*Radio
+	}{
+		{"round robin", RoundRobin, []uint32{0x42, 0x42, 0x42, 0x42}, []*Radio{radios[0], radios[1], radios[2], radios[0]}},
+		{"best snr", BestSNR, []uint32{0x42, 0x42}, []*Radio{radios[2], radios[2]}},
+		{"best snr prefers fewer hops", BestSNR, []uint32{0x43}, []*Radio{radios[0]}},
+		{"explicit", Explicit(radios[1]), []uint32{0x42, broadcastNum}, []*Radio{radios[1], radios[1]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool.mu.Lock()
+			pool.next = 0
+			pool.mu.Unlock()
+			pool.Selector = tt.selector
+
+			for i, to := range tt.to {
+				radio, err := pool.Pick(to)
+				if err != nil {
+					t.Fatalf("Pick(%x): %v", to, err)
+				}
+				if radio != tt.want[i] {
+					t.Errorf("Pick %d chose radio %d", i, indexOf(radios, radio))
+				}
+			}
+		})
+	}
+
+	// Unheard nodes and broadcasts fall back to round robin
+	pool.Selector = BestSNR
+	pool.mu.Lock()
+	pool.next = 1
+	pool.mu.Unlock()
+	if radio, _ := pool.Pick(0x99); radio != radios[1] {
+		t.Errorf("BestSNR for an unheard node chose radio %d, want 1", indexOf(radios, radio))
+	}
+	if radio, _ := pool.Pick(broadcastNum); radio != radios[2] {
+		t.Errorf("BestSNR for a broadcast chose radio %d, want 2", indexOf(radios, radio))
+	}
+
+	// Sends go through the chosen radio
+	pool.Selector = Explicit(radios[2])
+	if _, err := pool.SendTextMessage("via pool", 0x42, 0); err != nil {
+		t.Fatalf("SendTextMessage: %v", err)
+	}
+	waitForToRadio(t, devices[2], func(toRadio *pb.ToRadio) bool {
+		return string(toRadio.GetPacket().GetDecoded().GetPayload()) == "via pool"
+	})
+}
+
+func indexOf(radios []*Radio, radio *Radio) int {
+	for i, r := range radios {
+		if r == radio {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestNewRadioPool(t *testing.T) {
+	device := newFakeDevice(t, 0x100)
+	radio := &Radio{HeartbeatInterval: -1}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	if pool, err := NewRadioPool(radio, radio); err == nil {
+		pool.Close()
+		t.Fatal("NewRadioPool accepted a radio listed twice")
+	}
+
+	// The failed pool left the radio open
+	if _, err := radio.SendTextMessage("still here", 0x42, 0); err != nil {
+		t.Errorf("SendTextMessage after a failed pool: %v", err)
+	}
+}
+
+func TestRadioPoolForgetsOldReceptions(t *testing.T) {
+	pool, err := NewRadioPool()
+	if err != nil {
+		t.Fatalf("Error creating pool: %v", err)
+	}
+	defer pool.Close()
+
+	radio := &Radio{}
+	now := time.Now()
+	pool.heardBy(radio, heard(0x42, 1, 5).GetPacket(), now.Add(-dedupeWindow-2*time.Minute))
+	pool.heardBy(radio, heard(0x43, 2, 5).GetPacket(), now)
+
+	pool.mu.Lock()
+	_, old := pool.lastRx[0x42]
+	_, recent := pool.lastRx[0x43]
+	pool.mu.Unlock()
+	if old || !recent {
+		t.Errorf("Remembered receptions from 0x42, 0x43 = %t, %t, want false, true", old, recent)
+	}
+}
@@ -0,0 +1,505 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// proxyClientBuffer is the number of frames queued for a proxy client before it is disconnected as too slow
+const proxyClientBuffer = 512
+
+// proxyWriteTimeout bounds a single write to a proxy client
+const proxyWriteTimeout = 10 * time.Second
+
+// ProxyServer shares one Radio with any number of TCP clients speaking the stream protocol,
+// such as other goMesh programs, the Python CLI or the official apps. Every FromRadio frame is
+// sent to every client and ToRadio frames from clients are written to the radio one at a
+// time. Config requests are answered from a cached copy of the radio's config, so clients
+// connecting or reconnecting do not trigger dumps that other clients would see. The cache is
+// reloaded after a client changes the radio's settings.
+type ProxyServer struct {
+	radio *Radio
+	cache configCache
+
+	mu       sync.Mutex
+	clients  map[*proxyClient]struct{}
+	listener net.Listener
+	sub      *Subscription
+	closed   bool
+
+	// writeMu serializes writes to the radio
+	writeMu sync.Mutex
+
+	// refreshMu serializes reloads of the cache
+	refreshMu sync.Mutex
+
+	// dumpNonce is the nonce of the proxy's own config request in flight, zero when there is
+	// none. Guarded by mu
+	dumpNonce uint32
+}
+
+// NewProxyServer returns a proxy for an initialized radio. The radio stays owned by the
+// caller and is not closed by the proxy
+func NewProxyServer(radio *Radio) *ProxyServer {
+	return &ProxyServer{radio: radio, clients: make(map[*proxyClient]struct{})}
+}
+
+// ListenAndServe listens on addr, usually ":4403", and serves clients until Close
+func (p *ProxyServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return p.Serve(listener)
+}
+
+// Serve loads the radio's config and then accepts clients on listener until Close
+func (p *ProxyServer) Serve(listener net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		listener.Close()
+		return errors.New("proxy closed")
+	}
+	p.listener = listener
+	p.sub = p.radio.Subscribe(PacketFilter{})
+	p.mu.Unlock()
+
+	go p.fanOut(p.sub)
+
+	p.refreshConfig()
+
+	p.radio.log().Info("proxy listening", "addr", listener.Addr().String())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		client := &proxyClient{conn: conn, out: make(chan []byte, proxyClientBuffer), done: make(chan struct{})}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		p.clients[client] = struct{}{}
+		p.mu.Unlock()
+
+		p.radio.log().Info("proxy client connected", "client", conn.RemoteAddr().String())
+
+		go client.writeLoop()
+		go p.readClient(client)
+	}
+}
+
+// Addr returns the address the proxy is listening on, or nil before Serve
+func (p *ProxyServer) Addr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.listener == nil {
+		return nil
+	}
+	return p.listener.Addr()
+}
+
+// Close stops accepting clients and disconnects the connected ones
+func (p *ProxyServer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	listener := p.listener
+	sub := p.sub
+	clients := p.clients
+	p.clients = make(map[*proxyClient]struct{})
+	p.mu.Unlock()
+
+	for client := range clients {
+		client.close()
+	}
+	if sub != nil {
+		sub.Unsubscribe()
+	}
+	if listener != nil {
+		return listener.Close()
+	}
+
+	return nil
+}
+
+// fanOut caches config frames and forwards frames to the clients. The proxy's own config dump,
+// from its MyInfo to its ConfigCompleteId, only fills the cache; config frames the radio sends
+// at other times, such as NodeInfo for a newly heard node, are cached and forwarded
+func (p *ProxyServer) fanOut(sub *Subscription) {
+	inDump := false
+	for fromRadio := range sub.C {
+		switch variant := fromRadio.GetPayloadVariant().(type) {
+		case *pb.FromRadio_MyInfo:
+			// Every dump starts with MyInfo
+			p.mu.Lock()
+			inDump = p.dumpNonce != 0
+			p.mu.Unlock()
+		case *pb.FromRadio_ConfigCompleteId:
+			// Completes a dump requested by the proxy or its radio, never by a client
+			p.mu.Lock()
+			if variant.ConfigCompleteId == p.dumpNonce {
+				p.dumpNonce = 0
+			}
+			p.mu.Unlock()
+			inDump = false
+			continue
+		}
+
+		if p.cache.update(fromRadio) && inDump {
+			continue
+		}
+
+		out, err := proto.Marshal(fromRadio)
+		if err != nil {
+			continue
+		}
+		frame, err := EncodeFrame(out)
+		if err != nil {
+			continue
+		}
+
+		p.broadcast(frame)
+	}
+}
+
+// broadcast queues a frame for every client, dropping clients that have fallen too far behind
+func (p *ProxyServer) broadcast(frame []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for client := range p.clients {
+		if !client.send(frame) {
+			p.radio.log().Warn("proxy client not keeping up, disconnecting", "client", client.conn.RemoteAddr().String())
+			delete(p.clients, client)
+			client.close()
+		}
+	}
+}
+
+// readClient handles the frames a client sends until it disconnects
+func (p *ProxyServer) readClient(client *proxyClient) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.clients, client)
+		p.mu.Unlock()
+		client.close()
+		p.radio.log().Info("proxy client disconnected", "client", client.conn.RemoteAddr().String())
+	}()
+
+	frames := NewFrameReader(client.conn)
+	for {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			return
+		}
+		if frame.Kind != FrameProtobuf {
+			continue
+		}
+
+		toRadio := &pb.ToRadio{}
+		if err := proto.Unmarshal(frame.Payload, toRadio); err != nil {
+			p.radio.log().Debug("proxy dropping undecodable frame", "client", client.conn.RemoteAddr().String(), "bytes", len(frame.Payload), "err", err)
+			continue
+		}
+
+		switch variant := toRadio.GetPayloadVariant().(type) {
+		case *pb.ToRadio_WantConfigId:
+			p.replayConfig(client, variant.WantConfigId)
+		case *pb.ToRadio_Disconnect:
+			// Only this client is going away; the radio stays connected for the others
+			return
+		default:
+			if err := p.writeToRadio(frame.Payload); err != nil {
+				p.radio.log().Warn("proxy write to radio failed", "client", client.conn.RemoteAddr().String(), "err", err)
+			} else if p.changesConfig(toRadio) {
+				p.cache.invalidate()
+			}
+		}
+	}
+}
+
+// replayConfig answers a client's config request from the cache. Like the firmware,
+// ConfigOnlyNonce leaves out every node but the radio's own and NodesOnlyNonce sends only nodes
+func (p *ProxyServer) replayConfig(client *proxyClient, nonce uint32) {
+	p.refreshConfig()
+
+	self := p.radio.GetNodeID()
+	var frames []*pb.FromRadio
+	for _, fromRadio := range p.cache.frames() {
+		node, isNode := fromRadio.GetPayloadVariant().(*pb.FromRadio_NodeInfo)
+		switch {
+		case nonce == ConfigOnlyNonce && isNode && node.NodeInfo.GetNum() != self:
+		case nonce == NodesOnlyNonce && !isNode:
+		default:
+			frames = append(frames, fromRadio)
+		}
+	}
+	frames = append(frames, &pb.FromRadio{PayloadVariant: &pb.FromRadio_ConfigCompleteId{ConfigCompleteId: nonce}})
+
+	for _, fromRadio := range frames {
+		out, err := proto.Marshal(fromRadio)
+		if err != nil {
+			continue
+		}
+		frame, err := EncodeFrame(out)
+		if err != nil {
+			continue
+		}
+		if !client.send(frame) {
+			client.close()
+			return
+		}
+	}
+}
+
+// refreshConfig reloads the cache from a full config dump, unless it is up to date. On failure
+// the old cache is kept and the next config request tries again
+func (p *ProxyServer) refreshConfig() {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+
+	version, fresh := p.cache.state()
+	if fresh {
+		return
+	}
+
+	nonce := randomNonce()
+	p.mu.Lock()
+	p.dumpNonce = nonce
+	p.mu.Unlock()
+
+	snapshot, err := p.radio.Handshake(HandshakeOptions{Nonce: nonce})
+	if err != nil {
+		p.mu.Lock()
+		if p.dumpNonce == nonce {
+			p.dumpNonce = 0
+		}
+		p.mu.Unlock()
+		p.radio.log().Warn("proxy could not load radio config", "err", err)
+		return
+	}
+	p.cache.replace(snapshot.Frames, version)
+}
+
+// changesConfig reports whether a client's frame is an admin message changing the connected
+// radio's settings or node database, which leaves the cache out of date
+func (p *ProxyServer) changesConfig(toRadio *pb.ToRadio) bool {
+	packet := toRadio.GetPacket()
+	if packet.GetDecoded().GetPortnum() != pb.PortNum_ADMIN_APP || packet.GetTo() != p.radio.GetNodeID() {
+		return false
+	}
+
+	admin := &pb.AdminMessage{}
+	if err := proto.Unmarshal(packet.GetDecoded().GetPayload(), admin); err != nil {
+		return false
+	}
+
+	switch admin.GetPayloadVariant().(type) {
+	case *pb.AdminMessage_SetOwner, *pb.AdminMessage_SetChannel, *pb.AdminMessage_SetConfig,
+		*pb.AdminMessage_SetModuleConfig, *pb.AdminMessage_SetHamMode, *pb.AdminMessage_SetFixedPosition,
+		*pb.AdminMessage_RemoveFixedPosition, *pb.AdminMessage_SetFavoriteNode, *pb.AdminMessage_RemoveFavoriteNode,
+		*pb.AdminMessage_SetIgnoredNode, *pb.AdminMessage_RemoveIgnoredNode, *pb.AdminMessage_RemoveByNodenum,
+		*pb.AdminMessage_AddContact, *pb.AdminMessage_StoreUiConfig, *pb.AdminMessage_CommitEditSettings,
+		*pb.AdminMessage_RestorePreferences, *pb.AdminMessage_FactoryResetConfig, *pb.AdminMessage_FactoryResetDevice,
+		*pb.AdminMessage_NodedbReset:
+		return true
+	}
+
+	return false
+}
+
+// writeToRadio forwards a client's ToRadio payload, one client at a time
+func (p *ProxyServer) writeToRadio(payload []byte) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	return p.radio.sendPacket(context.Background(), payload)
+}
+
+// proxyClient is one TCP connection to the proxy
+type proxyClient struct {
+	conn net.Conn
+	out  chan []byte
+
+	mu     sync.Mutex
+	done   chan struct{}
+	closed bool
+}
+
+// send queues a frame for the client, reporting false if its queue is full or it is closed
+func (c *proxyClient) send(frame []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	select {
+	case c.out <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *proxyClient) writeLoop() {
+	for {
+		select {
+		case frame := <-c.out:
+			c.conn.SetWriteDeadline(time.Now().Add(proxyWriteTimeout))
+			if _, err := c.conn.Write(frame); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *proxyClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+	c.conn.Close()
+}
+
+// configCache keeps the latest copy of every frame in a config dump, in the order first seen
+type configCache struct {
+	mu      sync.Mutex
+	keys    map[string]int
+	entries []*pb.FromRadio
+	fresh   bool // Loaded from a dump since the last invalidate
+	version int  // Counts invalidations, so a dump started before one does not mark the cache fresh
+}
+
+// update stores fromRadio if it is part of a config dump and reports whether it was
+func (c *configCache) update(fromRadio *pb.FromRadio) bool {
+	key := configCacheKey(fromRadio)
+	if key == "" {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.put(key, fromRadio)
+	return true
+}
+
+// put stores fromRadio under key, replacing an older copy in place. The caller holds mu
+func (c *configCache) put(key string, fromRadio *pb.FromRadio) {
+	if c.keys == nil {
+		c.keys = make(map[string]int)
+	}
+	if i, ok := c.keys[key]; ok {
+		c.entries[i] = fromRadio
+	} else {
+		c.keys[key] = len(c.entries)
+		c.entries = append(c.entries, fromRadio)
+	}
+}
+
+// state returns the cache's version and whether it is up to date
+func (c *configCache) state() (version int, fresh bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.version, c.fresh
+}
+
+// invalidate marks the cache out of date, keeping its frames until it is reloaded
+func (c *configCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.fresh = false
+	c.version++
+}
+
+// replace swaps the cache for the config frames of a new dump, so removed nodes and channels
+// go away. The cache is fresh unless it was invalidated since version
+func (c *configCache) replace(frames []*pb.FromRadio, version int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.keys = nil
+	c.entries = nil
+	for _, fromRadio := range frames {
+		if key := configCacheKey(fromRadio); key != "" {
+			c.put(key, fromRadio)
+		}
+	}
+	c.fresh = version == c.version
+}
+
+// frames returns a copy of the cached dump
+func (c *configCache) frames() []*pb.FromRadio {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	frames := make([]*pb.FromRadio, len(c.entries))
+	copy(frames, c.entries)
+
+	return frames
+}
+
+// configCacheKey identifies what a config frame describes, so newer copies replace older ones.
+// Frames that are not part of a config dump have no key
+func configCacheKey(fromRadio *pb.FromRadio) string {
+	switch variant := fromRadio.GetPayloadVariant().(type) {
+	case *pb.FromRadio_MyInfo:
+		return "myinfo"
+	case *pb.FromRadio_Metadata:
+		return "metadata"
+	case *pb.FromRadio_DeviceuiConfig:
+		return "deviceui"
+	case *pb.FromRadio_NodeInfo:
+		return fmt.Sprintf("node/%d", variant.NodeInfo.GetNum())
+	case *pb.FromRadio_Channel:
+		return fmt.Sprintf("channel/%d", variant.Channel.GetIndex())
+	case *pb.FromRadio_Config:
+		return fmt.Sprintf("config/%T", variant.Config.GetPayloadVariant())
+	case *pb.FromRadio_ModuleConfig:
+		return fmt.Sprintf("module/%T", variant.ModuleConfig.GetPayloadVariant())
+	case *pb.FromRadio_FileInfo:
+		return "file/" + variant.FileInfo.GetFileName()
+	}
+
+	return ""
+}
@@ -0,0 +1,263 @@
+package gomesh
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// proxyTestClient is a raw stream protocol client connected to a proxy
+type proxyTestClient struct {
+	conn   net.Conn
+	frames *FrameReader
+	writer *FrameWriter
+}
+
+func dialProxy(t *testing.T, proxy *ProxyServer) *proxyTestClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", proxy.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &proxyTestClient{conn: conn, frames: NewFrameReader(conn), writer: NewFrameWriter(conn)}
+}
+
+func (c *proxyTestClient) send(t *testing.T, toRadio *pb.ToRadio) {
+	t.Helper()
+
+	out, err := proto.Marshal(toRadio)
+	if err != nil {
+		t.Fatalf("Error marshaling: %v", err)
+	}
+	if err := c.writer.WriteFrame(out); err != nil {
+		t.Fatalf("Error writing to proxy: %v", err)
+	}
+}
+
+func (c *proxyTestClient) receive(t *testing.T) *pb.FromRadio {
+	t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		frame, err := c.frames.ReadFrame()
+		if err != nil {
+			t.Fatalf("Error reading from proxy: %v", err)
+		}
+		if frame.Kind != FrameProtobuf {
+			continue
+		}
+		fromRadio := &pb.FromRadio{}
+		if err := proto.Unmarshal(frame.Payload, fromRadio); err != nil {
+			t.Fatalf("Error decoding frame: %v", err)
+		}
+		return fromRadio
+	}
+}
+
+func TestProxyServer(t *testing.T) {
+	device := newFakeDevice(t, 0xabc)
+
+	radio := Radio{}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+
+	proxy := NewProxyServer(&radio)
+	served := make(chan error, 1)
+	go func() { served <- proxy.Serve(listener) }()
+	for proxy.Addr() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	first := dialProxy(t, proxy)
+	second := dialProxy(t, proxy)
+
+	// Config requests are answered from the cache with the client's own nonce
+	first.send(t, &pb.ToRadio{PayloadVariant: &pb.ToRadio_WantConfigId{WantConfigId: 7}})
+	if info := first.receive(t).GetMyInfo(); info.GetMyNodeNum() != 0xabc {
+		t.Fatalf("Expected cached MyInfo for 0xabc, got %v", info)
+	}
+	if nonce := first.receive(t).GetConfigCompleteId(); nonce != 7 {
+		t.Fatalf("Expected ConfigCompleteId 7, got %d", nonce)
+	}
+
+	// Packets from the radio reach every client
+	device.push(textPacket(0x99, 0, "to everyone"))
+	for _, client := range []*proxyTestClient{first, second} {
+		packet := client.receive(t).GetPacket()
+		if string(packet.GetDecoded().GetPayload()) != "to everyone" {
+			t.Fatalf("Unexpected packet: %v", packet)
+		}
+	}
+
+	// Client writes are forwarded, config requests and disconnects are not
+	for len(device.received) > 0 {
+		<-device.received
+	}
+	second.send(t, &pb.ToRadio{PayloadVariant: &pb.ToRadio_WantConfigId{WantConfigId: 8}})
+	second.send(t, &pb.ToRadio{PayloadVariant: &pb.ToRadio_Packet{Packet: &pb.MeshPacket{To: 0x99, Id: 1234}}})
+
+	select {
+	case toRadio := <-device.received:
+		if toRadio.GetPacket().GetId() != 1234 {
+			t.Fatalf("Expected forwarded packet, got %v", toRadio)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for forwarded packet")
+	}
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Error closing proxy: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Serve returned %v", err)
+	}
+}
+
+func TestConfigCacheReplacesByKey(t *testing.T) {
+	cache := configCache{}
+
+	cache.update(&pb.FromRadio{PayloadVariant: &pb.FromRadio_MyInfo{MyInfo: &pb.MyNodeInfo{MyNodeNum: 1}}})
+	cache.update(&pb.FromRadio{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: 5}}})
+	cache.update(&pb.FromRadio{PayloadVariant: &pb.FromRadio_MyInfo{MyInfo: &pb.MyNodeInfo{MyNodeNum: 2}}})
+
+	if cache.update(textPacket(1, 0, "not config")) {
+		t.Errorf("Expected mesh packets to be left out of the cache")
+	}
+
+	frames := cache.frames()
+	if len(frames) != 2 {
+		t.Fatalf("Expected 2 cached frames, got %d", len(frames))
+	}
+	if frames[0].GetMyInfo().GetMyNodeNum() != 2 {
+		t.Errorf("Expected newest MyInfo to replace the first in place, got %v", frames[0])
+	}
+}
+
+func TestProxyReplayConfig(t *testing.T) {
+	const self, other = 0xabc, 0x99
+
+	node := func(num uint32, name string) *pb.FromRadio {
+		return &pb.FromRadio{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: num, User: &pb.User{LongName: name}}}}
+	}
+	dump := []*pb.FromRadio{
+		node(self, "before"),
+		node(other, "neighbour"),
+		{PayloadVariant: &pb.FromRadio_Channel{Channel: &pb.Channel{Index: 0, Role: pb.Channel_PRIMARY}}},
+		{PayloadVariant: &pb.FromRadio_Config{Config: &pb.Config{PayloadVariant: &pb.Config_Lora{Lora: &pb.Config_LoRaConfig{}}}}},
+	}
+
+	device := newFakeDevice(t, self)
+	device.setDump(dump)
+
+	radio := Radio{HeartbeatInterval: -1}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	proxy := NewProxyServer(&radio)
+	defer proxy.Close()
+	go proxy.Serve(listener)
+	for proxy.Addr() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	client := dialProxy(t, proxy)
+
+	// replay requests a dump and returns the cache keys of the frames answered, and the owner
+	// name of the radio's own node
+	replay := func(t *testing.T, nonce uint32) (keys []string, owner string) {
+		t.Helper()
+
+		client.send(t, &pb.ToRadio{PayloadVariant: &pb.ToRadio_WantConfigId{WantConfigId: nonce}})
+		for {
+			fromRadio := client.receive(t)
+			if complete, ok := fromRadio.GetPayloadVariant().(*pb.FromRadio_ConfigCompleteId); ok {
+				if complete.ConfigCompleteId != nonce {
+					t.Fatalf("ConfigCompleteId = %d, want %d", complete.ConfigCompleteId, nonce)
+				}
+				return keys, owner
+			}
+			keys = append(keys, configCacheKey(fromRadio))
+			if info := fromRadio.GetNodeInfo(); info.GetNum() == self {
+				owner = info.GetUser().GetLongName()
+			}
+		}
+	}
+
+	own, neighbour, channel, lora := configCacheKey(dump[0]), configCacheKey(dump[1]), configCacheKey(dump[2]), configCacheKey(dump[3])
+
+	tests := []struct {
+		name  string
+		nonce uint32
+		keys  []string
+	}{
+		{"full", 7, []string{"myinfo", own, neighbour, channel, lora}},
+		{"config only", ConfigOnlyNonce, []string{"myinfo", own, channel, lora}},
+		{"nodes only", NodesOnlyNonce, []string{own, neighbour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, _ := replay(t, tt.nonce)
+			if fmt.Sprint(keys) != fmt.Sprint(tt.keys) {
+				t.Errorf("Replayed %v, want %v", keys, tt.keys)
+			}
+		})
+	}
+
+	t.Run("live node info", func(t *testing.T) {
+		// The firmware announces a newly heard node outside of any dump
+		device.push(node(0x77, "newcomer"))
+		if info := client.receive(t).GetNodeInfo(); info.GetNum() != 0x77 || info.GetUser().GetLongName() != "newcomer" {
+			t.Fatalf("Expected the live NodeInfo for 0x77, got %v", info)
+		}
+
+		keys, _ := replay(t, NodesOnlyNonce)
+		if want := fmt.Sprint([]string{own, neighbour, "node/119"}); fmt.Sprint(keys) != want {
+			t.Errorf("Replayed %v after the live NodeInfo, want %v", keys, want)
+		}
+	})
+
+	t.Run("after admin write", func(t *testing.T) {
+		setOwner, err := proto.Marshal(&pb.AdminMessage{PayloadVariant: &pb.AdminMessage_SetOwner{SetOwner: &pb.User{LongName: "after"}}})
+		if err != nil {
+			t.Fatalf("Error marshaling: %v", err)
+		}
+
+		// The firmware applies the change, which only a new dump shows
+		device.setDump(append([]*pb.FromRadio{node(self, "after")}, dump[1:]...))
+		client.send(t, &pb.ToRadio{PayloadVariant: &pb.ToRadio_Packet{Packet: &pb.MeshPacket{
+			To: self,
+			Id: 4321,
+			PayloadVariant: &pb.MeshPacket_Decoded{Decoded: &pb.Data{
+				Portnum: pb.PortNum_ADMIN_APP,
+				Payload: setOwner,
+			}},
+		}}})
+		waitForToRadio(t, device, func(toRadio *pb.ToRadio) bool {
+			return toRadio.GetPacket().GetId() == 4321
+		})
+
+		if _, owner := replay(t, ConfigOnlyNonce); owner != "after" {
+			t.Errorf("Owner after set_owner = %q, want after", owner)
+		}
+	})
+}
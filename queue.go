@@ -0,0 +1,318 @@
+package gomesh
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// errRadioClosed is returned for packets still queued when the radio is closed
+var errRadioClosed = fmt.Errorf("%w: radio closed", ErrNotConnected)
+
+// queueStallTimeout is how long the queue waits for the firmware to report free space before
+// handing it one packet anyway, in case a QueueStatus was lost. The firmware answers that
+// packet with a QueueStatus, which restores flow control
+const queueStallTimeout = 5 * time.Second
+
+// QueueState is the progress of an outgoing mesh packet through the outbound queue
+type QueueState int
+
+const (
+	PacketQueued    QueueState = iota // Waiting in the queue
+	PacketSent                        // Handed to the radio
+	PacketFailed                      // Writing to the radio failed
+	PacketCancelled                   // The sender's context ended while the packet was queued
+)
+
+func (s QueueState) String() string {
+	switch s {
+	case PacketQueued:
+		return "queued"
+	case PacketSent:
+		return "sent"
+	case PacketFailed:
+		return "failed"
+	case PacketCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// QueueEvent reports a packet moving through the outbound queue
+type QueueEvent struct {
+	PacketID uint32
+	Priority pb.MeshPacket_Priority
+	State    QueueState
+	Depth    int // Packets still waiting after this event
+	Err      error
+	Time     time.Time
+}
+
+// queuedPacket is a mesh packet waiting for its turn
+type queuedPacket struct {
+	ctx      context.Context
+	packet   *pb.MeshPacket
+	id       uint32
+	priority pb.MeshPacket_Priority
+	seq      uint64
+	frame    []byte
+	done     chan error
+	index    int // Position in the heap, -1 once taken off it
+}
+
+// packetHeap orders packets by priority, then by the order they were queued
+type packetHeap []*queuedPacket
+
+func (h packetHeap) Len() int { return len(h) }
+
+func (h packetHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h packetHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *packetHeap) Push(x interface{}) {
+	item := x.(*queuedPacket)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *packetHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*h = old[:len(old)-1]
+	return item
+}
+
+// outboundQueue holds mesh packets until the firmware has room for them. The firmware reports the
+// free space in its transmit queue with a QueueStatus after every packet it is given; until the
+// first report the space is assumed to be there
+type outboundQueue struct {
+	mu      sync.Mutex
+	packets packetHeap
+	seq     uint64
+	free    int // Free slots last reported by the firmware minus packets sent since, -1 if unknown
+	status  *pb.QueueStatus
+	wake    chan struct{}
+	events  broadcaster[QueueEvent]
+}
+
+// signal wakes the send loop without blocking
+func (q *outboundQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// effectivePriority is the priority the firmware would give the packet
+func effectivePriority(packet *pb.MeshPacket) pb.MeshPacket_Priority {
+	if packet.GetPriority() != pb.MeshPacket_UNSET {
+		return packet.GetPriority()
+	}
+	if packet.GetWantAck() {
+		return pb.MeshPacket_RELIABLE
+	}
+	return pb.MeshPacket_DEFAULT
+}
+
+// QueueDepth returns the number of mesh packets waiting in the outbound queue
+func (r *Radio) QueueDepth() int {
+	r.queue.mu.Lock()
+	defer r.queue.mu.Unlock()
+
+	return len(r.queue.packets)
+}
+
+// QueueStatus returns the firmware's last report on its transmit queue, or nil if none has
+// been received yet
+func (r *Radio) QueueStatus() *pb.QueueStatus {
+	r.queue.mu.Lock()
+	defer r.queue.mu.Unlock()
+
+	if r.queue.status == nil {
+		return nil
+	}
+	return proto.Clone(r.queue.status).(*pb.QueueStatus)
+}
+
+// QueueEvents returns a channel of outbound queue events. Each call returns a new channel,
+// closed when the radio is closed
+func (r *Radio) QueueEvents() <-chan QueueEvent {
+	return r.queue.events.subscribe()
+}
+
+// startQueue prepares the outbound queue and starts handing packets to the radio
+func (r *Radio) startQueue() {
+	r.queue.mu.Lock()
+	r.queue.free = -1
+	r.queue.wake = make(chan struct{}, 1)
+	r.queue.mu.Unlock()
+
+	go r.sendLoop()
+}
+
+// resetQueueCredits forgets the firmware's free space, for a new connection
+func (r *Radio) resetQueueCredits() {
+	r.queue.mu.Lock()
+	r.queue.free = -1
+	r.queue.status = nil
+	r.queue.mu.Unlock()
+
+	r.queue.signal()
+}
+
+// updateQueueStatus records a QueueStatus from the firmware and releases waiting packets
+func (r *Radio) updateQueueStatus(status *pb.QueueStatus) {
+	r.queue.mu.Lock()
+	r.queue.status = status
+	r.queue.free = int(status.GetFree())
+	r.queue.mu.Unlock()
+
+	r.log().Debug("queue status", "free", status.GetFree(), "maxlen", status.GetMaxlen(), "packet_id", status.GetMeshPacketId())
+	r.queue.signal()
+}
+
+func (r *Radio) emitQueue(item *queuedPacket, state QueueState, depth int, err error) {
+	r.queue.events.publish(QueueEvent{
+		PacketID: item.id,
+		Priority: item.priority,
+		State:    state,
+		Depth:    depth,
+		Err:      err,
+		Time:     time.Now(),
+	})
+}
+
+// sendQueued puts a mesh packet on the outbound queue and waits until it has been written to
+// the radio, the write failed or ctx is done
+func (r *Radio) sendQueued(ctx context.Context, packet *pb.MeshPacket, frame []byte) error {
+	item := &queuedPacket{
+		ctx:      ctx,
+		packet:   packet,
+		id:       packet.GetId(),
+		priority: effectivePriority(packet),
+		frame:    frame,
+		done:     make(chan error, 1),
+	}
+
+	r.queue.mu.Lock()
+	if r.queue.wake == nil {
+		r.queue.mu.Unlock()
+		return ErrNotConnected
+	}
+	r.queue.seq++
+	item.seq = r.queue.seq
+	heap.Push(&r.queue.packets, item)
+	depth := len(r.queue.packets)
+	r.queue.mu.Unlock()
+
+	r.log().Debug("packet queued", packetAttrs(packet, "priority", item.priority.String(), "depth", depth)...)
+	r.emitQueue(item, PacketQueued, depth, nil)
+	r.queue.signal()
+
+	select {
+	case err := <-item.done:
+		return err
+	case <-ctx.Done():
+	case <-r.closeCtx.Done():
+	}
+
+	// Take the packet back unless the send loop already has it
+	r.queue.mu.Lock()
+	queued := item.index >= 0
+	if queued {
+		heap.Remove(&r.queue.packets, item.index)
+	}
+	depth = len(r.queue.packets)
+	r.queue.mu.Unlock()
+
+	if !queued {
+		return <-item.done
+	}
+
+	err := contextError(ctx)
+	if err == nil {
+		err = errRadioClosed
+	}
+	r.emitQueue(item, PacketCancelled, depth, err)
+
+	return err
+}
+
+// sendLoop hands queued packets to the radio, highest priority first, while the firmware
+// has room for them
+func (r *Radio) sendLoop() {
+	for {
+		item, depth, ok := r.nextPacket()
+		if !ok {
+			return
+		}
+
+		err := r.write(item.ctx, item.frame)
+		if err == nil {
+			// Counted before the sender is released so an ack can never beat it
+			r.metrics.packetSent(item.packet, time.Now())
+		}
+		item.done <- err
+
+		if err != nil {
+			r.log().Error("queued packet not sent", "packet_id", item.id, "err", err)
+			r.emitQueue(item, PacketFailed, depth, err)
+			continue
+		}
+		r.log().Debug("packet handed to radio", "packet_id", item.id, "bytes", len(item.frame), "depth", depth)
+		r.emitQueue(item, PacketSent, depth, nil)
+	}
+}
+
+// nextPacket waits for a packet and for room in the firmware's queue. It returns false once
+// the radio is closed
+func (r *Radio) nextPacket() (*queuedPacket, int, bool) {
+	var stall <-chan time.Time
+
+	for {
+		r.queue.mu.Lock()
+		if len(r.queue.packets) > 0 && r.queue.free != 0 {
+			item := heap.Pop(&r.queue.packets).(*queuedPacket)
+			if r.queue.free > 0 {
+				r.queue.free--
+			}
+			depth := len(r.queue.packets)
+			r.queue.mu.Unlock()
+			return item, depth, true
+		}
+		waiting := len(r.queue.packets) > 0
+		r.queue.mu.Unlock()
+
+		if waiting && stall == nil {
+			stall = time.After(queueStallTimeout)
+		}
+
+		select {
+		case <-r.queue.wake:
+		case <-stall:
+			r.log().Warn("no queue status from the radio, sending one packet to probe it")
+			r.queue.mu.Lock()
+			r.queue.free = 1
+			r.queue.mu.Unlock()
+			stall = nil
+		case <-r.closeCtx.Done():
+			return nil, 0, false
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// priorityPacket returns a marshalled ToRadio carrying a mesh packet with the given id and priority
+func priorityPacket(t *testing.T, id uint32, priority pb.MeshPacket_Priority) []byte {
+	t.Helper()
+
+	out, err := proto.Marshal(&pb.ToRadio{PayloadVariant: &pb.ToRadio_Packet{Packet: &pb.MeshPacket{
+		Id:       id,
+		To:       broadcastNum,
+		Priority: priority,
+		PayloadVariant: &pb.MeshPacket_Decoded{Decoded: &pb.Data{
+			Portnum: pb.PortNum_TEXT_MESSAGE_APP,
+			Payload: []byte("queued"),
+		}},
+	}}})
+	if err != nil {
+		t.Fatalf("Error marshalling packet: %v", err)
+	}
+
+	return out
+}
+
+// nextQueueEvent waits for the next queue event
+func nextQueueEvent(t *testing.T, events <-chan QueueEvent) QueueEvent {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a queue event")
+	}
+	return QueueEvent{}
+}
+
+// blockQueue reports a full firmware queue and waits for the radio to see it
+func blockQueue(t *testing.T, radio *Radio, device *fakeDevice) {
+	t.Helper()
+
+	device.push(&pb.FromRadio{PayloadVariant: &pb.FromRadio_QueueStatus{QueueStatus: &pb.QueueStatus{Free: 0, Maxlen: 16}}})
+	deadline := time.Now().Add(2 * time.Second)
+	for radio.QueueStatus() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the queue status")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEffectivePriority(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet *pb.MeshPacket
+		want   pb.MeshPacket_Priority
+	}{
+		{"unset", &pb.MeshPacket{}, pb.MeshPacket_DEFAULT},
+		{"unset with ack", &pb.MeshPacket{WantAck: true}, pb.MeshPacket_RELIABLE},
+		{"explicit", &pb.MeshPacket{Priority: pb.MeshPacket_BACKGROUND}, pb.MeshPacket_BACKGROUND},
+		{"explicit with ack", &pb.MeshPacket{Priority: pb.MeshPacket_ALERT, WantAck: true}, pb.MeshPacket_ALERT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := effectivePriority(tt.packet); got != tt.want {
+				t.Errorf("effectivePriority() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueuePriorityAndCredits(t *testing.T) {
+	device := newFakeDevice(t, 0x1234)
+	radio := &Radio{HeartbeatInterval: -1}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	blockQueue(t, radio, device)
+	events := radio.QueueEvents()
+
+	packets := []struct {
+		id       uint32
+		priority pb.MeshPacket_Priority
+	}{
+		{1, pb.MeshPacket_BACKGROUND},
+		{2, pb.MeshPacket_DEFAULT},
+		{3, pb.MeshPacket_ALERT},
+		{4, pb.MeshPacket_DEFAULT},
+	}
+
+	errs := make(chan error, len(packets))
+	for i, p := range packets {
+		frame := priorityPacket(t, p.id, p.priority)
+		go func() { errs <- radio.sendPacket(context.Background(), frame) }()
+
+		event := nextQueueEvent(t, events)
+		if event.State != PacketQueued || event.PacketID != p.id || event.Depth != i+1 {
+			t.Fatalf("Unexpected event queueing packet %d: %+v", p.id, event)
+		}
+	}
+	if depth := radio.QueueDepth(); depth != len(packets) {
+		t.Fatalf("QueueDepth() = %d, want %d", depth, len(packets))
+	}
+
+	// Free space for all but one packet
+	device.push(&pb.FromRadio{PayloadVariant: &pb.FromRadio_QueueStatus{QueueStatus: &pb.QueueStatus{Free: 3, Maxlen: 16}}})
+
+	var order []uint32
+	for i := 0; i < 3; i++ {
+		event := nextQueueEvent(t, events)
+		if event.State != PacketSent {
+			t.Fatalf("Unexpected event: %+v", event)
+		}
+		order = append(order, event.PacketID)
+	}
+	if want := []uint32{3, 2, 4}; !equalIDs(order, want) {
+		t.Errorf("Sent order = %v, want %v", order, want)
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("Packet sent without queue space: %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if depth := radio.QueueDepth(); depth != 1 {
+		t.Errorf("QueueDepth() = %d, want 1", depth)
+	}
+
+	device.push(&pb.FromRadio{PayloadVariant: &pb.FromRadio_QueueStatus{QueueStatus: &pb.QueueStatus{Free: 1, Maxlen: 16}}})
+	if event := nextQueueEvent(t, events); event.State != PacketSent || event.PacketID != 1 || event.Depth != 0 {
+		t.Errorf("Unexpected event for the last packet: %+v", event)
+	}
+
+	for range packets {
+		if err := <-errs; err != nil {
+			t.Errorf("sendPacket: %v", err)
+		}
+	}
+}
+
+func TestQueueCancel(t *testing.T) {
+	device := newFakeDevice(t, 0x1234)
+	radio := &Radio{HeartbeatInterval: -1}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	blockQueue(t, radio, device)
+	events := radio.QueueEvents()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := radio.sendPacket(ctx, priorityPacket(t, 7, pb.MeshPacket_HIGH))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("sendPacket error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if event := nextQueueEvent(t, events); event.State != PacketQueued {
+		t.Errorf("Unexpected first event: %+v", event)
+	}
+	if event := nextQueueEvent(t, events); event.State != PacketCancelled || event.PacketID != 7 || event.Depth != 0 {
+		t.Errorf("Unexpected cancel event: %+v", event)
+	}
+	if depth := radio.QueueDepth(); depth != 0 {
+		t.Errorf("QueueDepth() = %d, want 0", depth)
+	}
+}
+
+func equalIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueueStallSendsOneProbe(t *testing.T) {
+	device := newFakeDevice(t, 0x1234)
+	radio := &Radio{HeartbeatInterval: -1}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	blockQueue(t, radio, device)
+	events := radio.QueueEvents()
+
+	errs := make(chan error, 3)
+	for id := uint32(1); id <= 3; id++ {
+		frame := priorityPacket(t, id, pb.MeshPacket_DEFAULT)
+		go func() { errs <- radio.sendPacket(context.Background(), frame) }()
+		if event := nextQueueEvent(t, events); event.State != PacketQueued {
+			t.Fatalf("Unexpected event queueing packet %d: %+v", id, event)
+		}
+	}
+
+	// The QueueStatus never comes, so one packet goes out to probe the firmware
+	select {
+	case event := <-events:
+		if event.State != PacketSent || event.Depth != 2 {
+			t.Fatalf("Unexpected event after the stall: %+v", event)
+		}
+	case <-time.After(queueStallTimeout + 2*time.Second):
+		t.Fatal("Timed out waiting for the probe packet")
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("Backlog sent to a stalled radio: %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Its answer restores flow control
+	device.push(&pb.FromRadio{PayloadVariant: &pb.FromRadio_QueueStatus{QueueStatus: &pb.QueueStatus{Free: 2, Maxlen: 16}}})
+	for i := 0; i < 2; i++ {
+		if event := nextQueueEvent(t, events); event.State != PacketSent {
+			t.Fatalf("Unexpected event: %+v", event)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("sendPacket: %v", err)
+		}
+	}
+}
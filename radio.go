@@ -1,15 +1,14 @@
 package gomesh
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"log"
-	"math/rand"
-	"os"
+	"log/slog"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
 
@@ -17,53 +16,6 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-// LogLevel controls the verbosity of debug logging
-type LogLevel int
-
-const (
-	LogLevelSilent LogLevel = iota // No debug logs
-	LogLevelError                  // Only errors
-	LogLevelWarn                   // Errors and warnings
-	LogLevelInfo                   // Errors, warnings, and info
-	LogLevelDebug                  // All logs including debug
-)
-
-// globalLogLevel controls verbosity of all gomesh logging
-var globalLogLevel = LogLevelInfo
-
-// SetLogLevel sets the global log level for gomesh
-func SetLogLevel(level LogLevel) {
-	globalLogLevel = level
-}
-
-// debugLog logs a message if the log level is Debug or higher
-func debugLog(format string, v ...interface{}) {
-	if globalLogLevel >= LogLevelDebug {
-		log.Printf(format, v...)
-	}
-}
-
-// infoLog logs a message if the log level is Info or higher
-func infoLog(format string, v ...interface{}) {
-	if globalLogLevel >= LogLevelInfo {
-		log.Printf(format, v...)
-	}
-}
-
-// warnLog logs a message if the log level is Warn or higher
-func warnLog(format string, v ...interface{}) {
-	if globalLogLevel >= LogLevelWarn {
-		log.Printf(format, v...)
-	}
-}
-
-// errorLog logs a message if the log level is Error or higher
-func errorLog(format string, v ...interface{}) {
-	if globalLogLevel >= LogLevelError {
-		log.Printf(format, v...)
-	}
-}
-
 // min returns the smaller of two integers
 func min(a, b int) int {
 	if a < b {
@@ -82,7 +34,7 @@ func validatePacketStructure(packet []byte) error {
 		return errors.New("invalid packet header")
 	}
 
-	expectedLength := int((packet[2] << 8) + packet[3])
+	expectedLength := int(packet[2])<<8 | int(packet[3])
 	actualPayloadLength := len(packet) - headerLen
 
 	if actualPayloadLength != expectedLength {
@@ -90,7 +42,7 @@ func validatePacketStructure(packet []byte) error {
 	}
 
 	if expectedLength > maxToFromRadioSzie {
-		return errors.New(fmt.Sprintf("packet too large: %d > %d", expectedLength, maxToFromRadioSzie))
+		return fmt.Errorf("%w: %d > %d bytes", ErrPayloadTooLarge, expectedLength, maxToFromRadioSzie)
 	}
 
 	return nil
@@ -129,55 +81,59 @@ type RadioResponseSet struct {
 	AllResponses    []*RadioResponse
 }
 
-// isTextData determines if the given bytes represent text data
-// This function is now VERY conservative - only identifies data as text when absolutely certain
-func isTextData(data []byte) bool {
-	if len(data) == 0 {
-		return false
-	}
-
-	// Convert to string for pattern matching
-	dataStr := string(data)
+// consolePatterns are fragments that only appear in the firmware's console output
+var consolePatterns = []string{
+	"DEBUG", "INFO", "WARN", "ERROR", "TRACE",
+	"SerialConsole", "Send known nodes",
+}
 
-	// ONLY identify as text if we find EXPLICIT console/debug patterns
-	// Do NOT use ASCII ratio heuristics as they incorrectly flag protobuf data
-	debugPatterns := []string{
-		"DEBUG", "INFO", "WARN", "ERROR", "TRACE",
-		"SerialConsole", "Send known nodes",
-		"\x1b[",                                                                                                    // ANSI escape sequences
-		"| 12:", "| 13:", "| 14:", "| 15:", "| 16:", "| 17:", "| 18:", "| 19:", "| 20:", "| 21:", "| 22:", "| 23:", // Time patterns with pipe
-	}
+// consoleTimePattern matches the time of day printed on every console log line
+var consoleTimePattern = regexp.MustCompile(`\b\d{1,2}:\d{2}:\d{2}\b`)
 
-	// Must contain at least one explicit debug pattern
-	hasDebugPattern := false
-	for _, pattern := range debugPatterns {
-		if strings.Contains(dataStr, pattern) {
-			hasDebugPattern = true
-			break
+// hasConsolePattern reports whether text contains one of consolePatterns
+func hasConsolePattern(text string) bool {
+	for _, pattern := range consolePatterns {
+		if strings.Contains(text, pattern) {
+			return true
 		}
 	}
+	return false
+}
+
+// isConsoleLine reports whether a cleaned up line of text looks like console output
+func isConsoleLine(line string) bool {
+	return hasConsolePattern(line) || consoleTimePattern.MatchString(line)
+}
 
-	if !hasDebugPattern {
+// isTextData reports whether bytes read outside a frame are console output. Bytes holding one
+// of consolePatterns or an ANSI escape sequence count when more than half of them are printable,
+// so console lines mixed with line noise are kept. A time of day matched by consoleTimePattern,
+// such as 12:22:47, only counts when every byte is printable, since text messages carry times
+// too and their packets are mostly printable
+func isTextData(data []byte) bool {
+	if len(data) == 0 {
 		return false
 	}
 
-	// Additional validation: if it has debug patterns, it should also have reasonable text characteristics
-	// But be much more lenient than before
+	text := string(data)
+	switch {
+	case hasConsolePattern(text) || strings.Contains(text, "\x1b["):
+		return printableRatio(data) > 0.5
+	case consoleTimePattern.MatchString(text):
+		return printableRatio(data) == 1
+	}
+	return false
+}
+
+// printableRatio returns the share of data that is printable or whitespace
+func printableRatio(data []byte) float64 {
 	printableCount := 0
 	for _, b := range data {
 		if unicode.IsPrint(rune(b)) || b == '\n' || b == '\r' || b == '\t' || b == ' ' {
 			printableCount++
 		}
 	}
-
-	// Only require 50% printable characters (much more lenient)
-	// This catches cases where debug output is mixed with some binary data
-	if len(data) > 0 {
-		printableRatio := float64(printableCount) / float64(len(data))
-		return printableRatio > 0.5
-	}
-
-	return false
+	return float64(printableCount) / float64(len(data))
 }
 
 // isLikelyFalsePacketHeader checks if what looks like a packet header is actually text data
@@ -219,6 +175,12 @@ func extractTextFromBytes(data []byte) []string {
 
 	// Text cleanup completed silently
 
+	// A buffer without any console output is not text, but once it has some every printable
+	// line is kept, console or not
+	if !isConsoleLine(text) {
+		return nil
+	}
+
 	lines := strings.Split(text, "\n")
 	var validLines []string
 
@@ -278,68 +240,256 @@ func isPrintableText(line string) bool {
 	return float64(printableCount)/float64(len(line)) >= 0.8
 }
 
-// Radio holds the port and serial io.ReadWriteCloser struct to maintain one serial connection
+// Radio holds the port and serial io.ReadWriteCloser struct to maintain one serial connection.
+//
+// Once initialized a Radio is safe for use by multiple goroutines. Writes to the device are
+// serialized, config requests run one at a time, and requests that expect an answer (Handshake,
+// GetRadioInfo, AdminRequest and the getters built on them) are matched to their answer by
+// nonce or packet id, so concurrent callers never see each other's responses. The exported
+// configuration fields must be set before Init and not changed afterwards. The ReadResponse
+// helpers share one queue of unread frames and are not correlated; use Subscribe instead when
+// reading from several goroutines.
 type Radio struct {
-	streamer streamer
-	nodeNum  uint32
+	// Reconnect enables automatic reconnects when set before Init
+	Reconnect *ReconnectPolicy
+
+	// Retry resends direct messages the mesh could not deliver when set before Init
+	Retry *RetryPolicy
+
+	// ChunkTimeout is how long a chunked transfer may go without progress before either side
+	// abandons it. Zero uses DefaultChunkTimeout
+	ChunkTimeout time.Duration
+
+	// HeartbeatInterval is how often a heartbeat is sent to keep the link alive. Zero uses
+	// DefaultHeartbeatInterval and a negative value disables heartbeats
+	HeartbeatInterval time.Duration
+
+	// Capture, if set before Init, records every byte read from and written to the radio,
+	// including across reconnects. Play it back with NewReplayTransport
+	Capture *CaptureWriter
+
+	// Logger receives the radio's logs, tagged with its port and node number. When nil they are
+	// written through the standard log package, filtered by SetLogLevel
+	Logger *slog.Logger
+
+	// tagged is Logger, or the package logger, with the port and node number attached. It is
+	// rebuilt when they change so logging on the read path costs no locking or allocation
+	tagged atomic.Pointer[slog.Logger]
+
+	// Connection state, guarded by connMu
+	connMu      sync.Mutex
+	streamer    streamer
+	port        string
+	nodeNum     uint32
+	ownConfig   *DeviceSnapshot // The config-only dump read when the link came up
+	switchMode  bool
+	dial        func(ctx context.Context) (Transport, error)
+	closeCtx    context.Context
+	closeCancel context.CancelFunc
+	connEvents  broadcaster[ConnectionEvent]
+	logs        broadcaster[DeviceLogEntry]
+	deliveries  broadcaster[DeliveryEvent]
+
+	// Reconnect attempts since the link was last up, the handshake of the latest one and why it
+	// failed, guarded by connMu
+	reconnects      int
+	cancelHandshake context.CancelFunc
+	handshakeErr    error
+
+	// Outbound mesh packets waiting for room in the firmware's queue
+	queue outboundQueue
+
+	// Link and packet counters, see Metrics
+	metrics radioMetrics
+
+	// Chunked transfers in progress, see SendPayload
+	chunks chunkTransfers
+
+	// Recent text messages, so reactions can be sent to the right conversation
+	texts recentTexts
+
+	// Received text messages, and the channel names to label them with
+	messages broadcaster[TextMessage]
+	channels channelNames
+
+	// writeMu serializes writes to the transport and configMu config dumps, which the
+	// firmware cannot run two of at once
+	writeMu  sync.Mutex
+	configMu sync.Mutex
+
+	// Background reader state, guarded by subsMu
+	subsMu     sync.Mutex
+	subs       map[*Subscription]struct{}
+	pending    map[uint32]chan *pb.MeshPacket
+	sent       map[uint32]*SentPacket
+	inbox      chan inboxEntry
+	inboxFull  bool // The inbox overflowed since the last ReadResponse, already logged
+	readErr    error
+	readerDone chan struct{}
 }
 
-// Init initializes the Serial connection for the radio
+// Init initializes the connection to the radio. port is a serial port name, an IP address or a
+// connection URI such as tcp://node.local:4403 or serial:///dev/ttyACM0?baud=921600
 func (r *Radio) Init(port string) error {
+	return r.InitContext(context.Background(), port)
+}
+
+// InitContext is Init with the console mode switch and the initial node query bounded by ctx
+func (r *Radio) InitContext(ctx context.Context, port string) error {
+
+	r.dial = func(ctx context.Context) (Transport, error) {
+		s := streamer{}
+		if err := s.Init(port); err != nil {
+			return nil, err
+		}
+		return s.transport, nil
+	}
 
 	streamer := streamer{}
 	err := streamer.Init(port)
 	if err != nil {
 		return err
 	}
-	r.streamer = streamer
 
-	// Switch radio from console mode to API mode
-	infoLog("🔄 RADIO INIT: Switching to API mode...")
-	err = r.switchToAPIMode()
-	if err != nil {
-		errorLog("❌ RADIO INIT: Failed to switch to API mode: %v", err)
-		return err
+	r.connMu.Lock()
+	r.port = port
+	r.retagLogger()
+	r.connMu.Unlock()
+
+	// Only serial ports have a console that needs switching to API mode
+	_, isSerial := streamer.transport.(*serialTransport)
+
+	return r.start(ctx, streamer, isSerial)
+}
+
+// InitWithTransport initializes the radio over a caller supplied Transport. The transport must
+// already be connected to a device speaking the stream API. Serial transports created with
+// NewSerialTransport are switched out of console mode first, other transports are used as is
+func (r *Radio) InitWithTransport(transport Transport) error {
+	return r.InitWithTransportContext(context.Background(), transport)
+}
+
+// InitWithTransportContext is InitWithTransport with the initial node query bounded by ctx
+func (r *Radio) InitWithTransportContext(ctx context.Context, transport Transport) error {
+	if transport == nil {
+		return errors.New("nil transport")
 	}
-	infoLog("✅ RADIO INIT: Successfully switched to API mode")
 
-	err = r.getNodeNum()
-	if err != nil {
+	if r.Reconnect != nil && r.Reconnect.Dial == nil {
+		transport.Close()
+		return errors.New("reconnect policy needs a Dial function when using InitWithTransport")
+	}
+
+	_, isSerial := transport.(*serialTransport)
+
+	return r.start(ctx, streamer{transport: transport}, isSerial)
+}
+
+// start takes ownership of an open streamer and queries the radio for its node number
+func (r *Radio) start(ctx context.Context, s streamer, switchMode bool) error {
+	s.transport = r.captured(s.transport)
+
+	r.connMu.Lock()
+	r.streamer = s
+	r.switchMode = switchMode
+	r.closeCtx, r.closeCancel = context.WithCancel(context.Background())
+	if r.Reconnect != nil && r.Reconnect.Dial != nil {
+		r.dial = r.Reconnect.Dial
+	}
+	r.connMu.Unlock()
+
+	if switchMode {
+		// Switch radio from console mode to API mode
+		r.log().Info("switching to API mode")
+		err := r.switchToAPIMode(ctx)
+		if err != nil {
+			r.log().Error("switch to API mode failed", "err", err)
+			r.closeCancel()
+			s.Close()
+			return err
+		}
+		r.log().Info("switched to API mode")
+	}
+
+	// From here on all reads go through the background reader and mesh packets through the queue
+	r.startReader()
+	r.startQueue()
+	r.startChunks()
+
+	if err := r.getNodeNum(ctx); err != nil {
+		r.Close()
 		return err
 	}
 
+	r.emitConnection(ConnectionConnected, 0, nil)
+
+	if interval := r.heartbeatInterval(); interval > 0 {
+		go r.heartbeat(interval)
+	}
+
 	return nil
 }
 
 // GetNodeID returns the node ID of the connected radio
 func (r *Radio) GetNodeID() uint32 {
+	r.connMu.Lock()
+	defer r.connMu.Unlock()
+
 	return r.nodeNum
 }
 
+// conn returns the streamer for the current connection
+func (r *Radio) conn() *streamer {
+	r.connMu.Lock()
+	defer r.connMu.Unlock()
+
+	s := r.streamer
+	return &s
+}
+
+// setStreamer swaps in the streamer for a new connection. It fails, closing s, once the radio is closed
+func (r *Radio) setStreamer(s streamer) error {
+	r.connMu.Lock()
+	defer r.connMu.Unlock()
+
+	if r.closeCtx.Err() != nil {
+		s.Close()
+		return r.closeCtx.Err()
+	}
+	s.transport = r.captured(s.transport)
+	r.streamer = s
+
+	return nil
+}
+
 // switchToAPIMode switches the radio from console mode to API (protobuf) mode
-func (r *Radio) switchToAPIMode() error {
-	infoLog("📤 SWITCHING TO API MODE: Sending exit command...")
+func (r *Radio) switchToAPIMode(ctx context.Context) error {
+	r.log().Debug("sending console exit command")
 
 	// Send "exit" command to exit console mode and switch to API mode
 	// This is the standard way to switch Meshtastic radios from console to API mode
 	exitCommand := []byte("exit\n")
-	err := r.streamer.Write(exitCommand)
+	err := r.write(ctx, exitCommand)
 	if err != nil {
 		return err
 	}
 
 	// Wait a bit for the mode switch to take effect
-	time.Sleep(500 * time.Millisecond)
+	if err := sleepContext(ctx, 500*time.Millisecond); err != nil {
+		return err
+	}
 
 	// Clear any remaining console output from the buffer
 	for i := 0; i < 10; i++ {
 		b := make([]byte, 1024)
-		err := r.streamer.Read(b)
+		err := r.conn().Read(ctx, b)
 		if err != nil {
 			// If we get a timeout or EOF, that's expected - buffer is clear
 			break
 		}
-		time.Sleep(50 * time.Millisecond)
+		if err := sleepContext(ctx, 50*time.Millisecond); err != nil {
+			return err
+		}
 	}
 
 	// Send additional commands to ensure we're fully in API mode
@@ -361,473 +511,171 @@ func (r *Radio) switchToAPIMode() error {
 	}
 
 	for _, cmd := range commands {
-		err = r.streamer.Write([]byte(cmd))
+		err = r.write(ctx, []byte(cmd))
 		if err == nil {
 			// Wait a bit for each command to take effect
-			time.Sleep(200 * time.Millisecond)
+			if err := sleepContext(ctx, 200*time.Millisecond); err != nil {
+				return err
+			}
 
 			// Clear any response from the command
 			for j := 0; j < 3; j++ {
 				b := make([]byte, 512)
-				err := r.streamer.Read(b)
+				err := r.conn().Read(ctx, b)
 				if err != nil {
 					break
 				}
-				time.Sleep(50 * time.Millisecond)
+				if err := sleepContext(ctx, 50*time.Millisecond); err != nil {
+					return err
+				}
 			}
 		}
 	}
-	return nil
+	return contextError(ctx)
 }
 
-// sendPacket takes a protbuf packet, construct the appropriate header and sends it to the radio
-func (r *Radio) sendPacket(protobufPacket []byte) (err error) {
+// write sends raw bytes to the radio, one caller at a time
+func (r *Radio) write(ctx context.Context, p []byte) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	s := r.conn()
+	if s.transport == nil {
+		return ErrNotConnected
+	}
+	if err := s.Write(ctx, p); err != nil {
+		return err
+	}
+	r.metrics.bytesSent(len(p))
 
-	packageLength := len(protobufPacket) // FIXED: Don't convert to string, which corrupts binary data
+	return nil
+}
 
-	header := []byte{start1, start2, byte(packageLength>>8) & 0xff, byte(packageLength) & 0xff}
+// sendPacket takes a protbuf packet, construct the appropriate header and sends it to the radio.
+// Mesh packets wait their turn in the outbound queue; other messages are written straight away
+func (r *Radio) sendPacket(ctx context.Context, protobufPacket []byte) (err error) {
 
-	radioPacket := append(header, protobufPacket...)
+	radioPacket, err := EncodeFrame(protobufPacket)
+	if err != nil {
+		r.log().Error("packet send failed", "bytes", len(protobufPacket), "err", err)
+		return err
+	}
 
 	// Send packet to radio
 
-	err = r.streamer.Write(radioPacket)
+	toRadio := pb.ToRadio{}
+	if proto.Unmarshal(protobufPacket, &toRadio) == nil && toRadio.GetPacket() != nil {
+		err = r.sendQueued(ctx, toRadio.GetPacket(), radioPacket)
+	} else {
+		err = r.write(ctx, radioPacket)
+	}
 	if err != nil {
-		errorLog("❌ PACKET SEND FAILED: %v", err)
+		r.log().Error("packet send failed", packetAttrs(toRadio.GetPacket(), "bytes", len(radioPacket), "err", err)...)
 		return err
 	}
 
-	debugLog("✅ PACKET SENT SUCCESSFULLY")
+	r.log().Debug("packet sent", packetAttrs(toRadio.GetPacket(), "bytes", len(radioPacket))...)
 	return
 
 }
 
-// ReadResponseWithTypes reads responses from the serial port and returns both text and protobuf data
+// ReadResponseWithTypes returns the responses received from the radio, both text and protobuf,
+// until the radio has been quiet for two seconds. The timeout argument has no effect and is
+// kept for compatibility; use ReadResponseWithTypesContext to bound the read
 func (r *Radio) ReadResponseWithTypes(timeout bool) (*RadioResponseSet, error) {
-	infoLog("📥 READRESPONSE_ENHANCED: Starting to read radio response (timeout=%v)", timeout)
+	return r.ReadResponseWithTypesContext(context.Background())
+}
+
+// ReadResponseWithTypesContext returns the text and protobuf responses received from the radio
+// until it has been quiet for two seconds or ctx is done
+func (r *Radio) ReadResponseWithTypesContext(ctx context.Context) (*RadioResponseSet, error) {
+	r.log().Debug("reading responses")
 
-	b := make([]byte, 1)
-	emptyByte := make([]byte, 0)
-	processedBytes := make([]byte, 0)
-	textBuffer := make([]byte, 0)
-	repeatByteCounter := 0
-	previousByte := make([]byte, 1)
-	totalBytesRead := 0
+	responses, err := r.collectResponses(ctx, 0, false)
+	if err != nil {
+		r.log().Error("reading responses failed", "err", err)
+		return nil, err
+	}
 
 	responseSet := &RadioResponseSet{
 		ProtobufPackets: make([]*pb.FromRadio, 0),
 		TextMessages:    make([]string, 0),
-		AllResponses:    make([]*RadioResponse, 0),
-	}
-
-	for {
-		err := r.streamer.Read(b)
-		if err == nil {
-			totalBytesRead++
-			// Suppress all byte-by-byte logging to reduce noise
-		}
-
-		if bytes.Equal(b, previousByte) {
-			repeatByteCounter++
-		} else {
-			repeatByteCounter = 0
-		}
-
-		if err == io.EOF || repeatByteCounter > 20 || errors.Is(err, os.ErrDeadlineExceeded) {
-			debugLog("📥 READRESPONSE_ENHANCED: Breaking loop - EOF=%v, RepeatCount=%d, Timeout=%v, TotalBytes=%d",
-				err == io.EOF, repeatByteCounter, errors.Is(err, os.ErrDeadlineExceeded), totalBytesRead)
-			break
-		} else if err != nil {
-			errorLog("❌ READRESPONSE_ENHANCED: Read error: %v", err)
-			return nil, err
-		}
-		copy(previousByte, b)
-
-		if len(b) > 0 {
-			// Try to detect if we're in a protobuf packet sequence
-			pointer := len(processedBytes)
-
-			// Check if this byte could be the start of a protobuf packet
-			if pointer == 0 && b[0] == start1 {
-				// Process any accumulated text data before starting protobuf parsing
-				if len(textBuffer) > 0 && isTextData(textBuffer) {
-					textLines := extractTextFromBytes(textBuffer)
-					if len(textLines) > 0 {
-						// Completely suppress text data logging to reduce noise
-						for _, line := range textLines {
-							responseSet.TextMessages = append(responseSet.TextMessages, line)
-							responseSet.AllResponses = append(responseSet.AllResponses, &RadioResponse{
-								Type:     ResponseTypeText,
-								TextData: line,
-								RawBytes: []byte(line),
-							})
-						}
-					}
-					textBuffer = emptyByte
-				}
-
-				// Start protobuf packet processing
-				processedBytes = append(processedBytes, b...)
-				debugLog("🔍 HEADER: Found START1 (0x%02x)", b[0])
-			} else if pointer == 1 && b[0] == start2 {
-				// Continue protobuf packet processing
-				processedBytes = append(processedBytes, b...)
-				debugLog("🔍 HEADER: Found START2 (0x%02x)", b[0])
-			} else if pointer > 0 && pointer < headerLen {
-				// Continue building protobuf header
-				processedBytes = append(processedBytes, b...)
-			} else if pointer >= headerLen {
-				// We're in protobuf payload processing
-				processedBytes = append(processedBytes, b...)
-
-				packetLength := int((processedBytes[2] << 8) + processedBytes[3])
-				if pointer == headerLen {
-					debugLog("🔍 PACKET LENGTH: Calculated length=%d (bytes 2-3: 0x%02x 0x%02x)",
-						packetLength, processedBytes[2], processedBytes[3])
-					if packetLength > maxToFromRadioSzie {
-						errorLog("❌ PACKET TOO LARGE: %d > %d - resetting", packetLength, maxToFromRadioSzie)
-						processedBytes = emptyByte
-						textBuffer = append(textBuffer, b...)
-						continue
-					}
-
-					// Check if this might be a false packet header (debug output that accidentally looks like a header)
-					if len(processedBytes) >= 8 && isLikelyFalsePacketHeader(processedBytes) {
-						debugLog("🔍 FALSE HEADER DETECTED: Treating as text data")
-						textBuffer = append(textBuffer, processedBytes...)
-						processedBytes = emptyByte
-						continue
-					}
-				}
-
-				if len(processedBytes) != 0 && pointer+1 == packetLength+headerLen {
-					// Complete protobuf packet received
-					payloadBytes := processedBytes[headerLen:]
-
-					debugLog("🔍 PARSING PROTOBUF: TotalLen=%d, HeaderLen=%d, PayloadLen=%d, ExpectedLen=%d",
-						len(processedBytes), headerLen, len(payloadBytes), packetLength)
-
-					if len(payloadBytes) == 0 {
-						warnLog("⚠️  EMPTY PAYLOAD: Skipping empty protobuf payload")
-						processedBytes = emptyByte
-						continue
-					}
-
-					if len(payloadBytes) != packetLength {
-						warnLog("⚠️  LENGTH MISMATCH: Expected %d bytes, got %d bytes", packetLength, len(payloadBytes))
-						processedBytes = emptyByte
-						continue
-					}
-
-					// Try to decode as protobuf first - if it fails, treat as text
-					fromRadio := pb.FromRadio{}
-					if err := proto.Unmarshal(payloadBytes, &fromRadio); err != nil {
-						// Protobuf parsing failed - treat as text data
-						debugLog("🔍 PROTOBUF DECODE FAILED: Treating as text data (len=%d)", len(payloadBytes))
-						textBuffer = append(textBuffer, processedBytes...)
-						processedBytes = emptyByte
-						continue
-					}
-
-					debugLog("✅ PROTOBUF DECODED: Type=%T, PayloadVariant=%T", &fromRadio, fromRadio.PayloadVariant)
-
-					responseSet.ProtobufPackets = append(responseSet.ProtobufPackets, &fromRadio)
-					responseSet.AllResponses = append(responseSet.AllResponses, &RadioResponse{
-						Type:        ResponseTypeProtobuf,
-						ProtobufMsg: &fromRadio,
-						RawBytes:    make([]byte, len(processedBytes)),
-					})
-					copy(responseSet.AllResponses[len(responseSet.AllResponses)-1].RawBytes, processedBytes)
-
-					processedBytes = emptyByte
-				}
-			} else {
-				// Not in protobuf sequence, accumulate as potential text data
-				textBuffer = append(textBuffer, b...)
-
-				// Reset protobuf processing if we were in the middle of it
-				if len(processedBytes) > 0 {
-					// Only log if we have significant data to avoid spam
-					if len(processedBytes) > 4 {
-						debugLog("🔍 HEADER: Expected START1, got text data - resetting (%d bytes)", len(processedBytes))
-					}
-					textBuffer = append(textBuffer, processedBytes...)
-					processedBytes = emptyByte
-				}
-			}
-		} else {
-			debugLog("📥 READRESPONSE_ENHANCED: Empty byte received, breaking")
-			break
-		}
+		AllResponses:    responses,
 	}
 
-	// Process any remaining text data
-	if len(textBuffer) > 0 && isTextData(textBuffer) {
-		textLines := extractTextFromBytes(textBuffer)
-		if len(textLines) > 0 {
-			// Completely suppress final text data logging to reduce noise
-			for _, line := range textLines {
-				responseSet.TextMessages = append(responseSet.TextMessages, line)
-				responseSet.AllResponses = append(responseSet.AllResponses, &RadioResponse{
-					Type:     ResponseTypeText,
-					TextData: line,
-					RawBytes: []byte(line),
-				})
-			}
+	for _, response := range responses {
+		switch response.Type {
+		case ResponseTypeProtobuf:
+			responseSet.ProtobufPackets = append(responseSet.ProtobufPackets, response.ProtobufMsg)
+		case ResponseTypeText:
+			responseSet.TextMessages = append(responseSet.TextMessages, response.TextData)
 		}
 	}
 
-	infoLog("📥 READRESPONSE_ENHANCED: Completed - Found %d protobuf packets, %d text messages, TotalBytesRead=%d",
-		len(responseSet.ProtobufPackets), len(responseSet.TextMessages), totalBytesRead)
-
-	if len(processedBytes) > 0 {
-		warnLog("⚠️  READRESPONSE_ENHANCED: %d unprocessed protobuf bytes remaining: %x",
-			len(processedBytes), processedBytes)
-	}
+	r.log().Info("read responses", "packets", len(responseSet.ProtobufPackets), "text_messages", len(responseSet.TextMessages))
 
 	return responseSet, nil
 }
 
-// ReadResponse reads any responses in the serial port, convert them to a FromRadio protobuf and return
+// ReadResponse returns the FromRadio packets received from the radio until it has been quiet for
+// two seconds. The timeout argument has no effect and is kept for compatibility; use
+// ReadResponseContext to bound the read
 func (r *Radio) ReadResponse(timeout bool) (FromRadioPackets []*pb.FromRadio, err error) {
-	infoLog("📥 READRESPONSE: Starting to read radio response (timeout=%v)", timeout)
-
-	b := make([]byte, 1)
-	emptyByte := make([]byte, 0)
-	processedBytes := make([]byte, 0)
-	repeatByteCounter := 0
-	previousByte := make([]byte, 1)
-	totalBytesRead := 0
-
-	/************************************************************************************************
-	* Process the returned data byte by byte until we have a valid command
-	* Each command will come back with [START1, START2, PROTOBUF_PACKET]
-	* where the protobuf packet is sent in binary. After reading START1 and START2
-	* we use the next bytes to find the length of the packet.
-	* After finding the length the looop continues to gather bytes until the length of the gathered
-	* bytes is equal to the packet length plus the header
-	 */
-	for {
-		err := r.streamer.Read(b)
-		if err == nil {
-			totalBytesRead++
-			// Suppress all byte-by-byte logging to reduce noise
-		}
-
-		if bytes.Equal(b, previousByte) {
-			repeatByteCounter++
-		} else {
-			repeatByteCounter = 0
-		}
-
-		if err == io.EOF || repeatByteCounter > 20 || errors.Is(err, os.ErrDeadlineExceeded) {
-			debugLog("📥 READRESPONSE: Breaking loop - EOF=%v, RepeatCount=%d, Timeout=%v, TotalBytes=%d",
-				err == io.EOF, repeatByteCounter, errors.Is(err, os.ErrDeadlineExceeded), totalBytesRead)
-			break
-		} else if err != nil {
-			errorLog("❌ READRESPONSE: Read error: %v", err)
-			return nil, err
-		}
-		copy(previousByte, b)
-
-		if len(b) > 0 {
-			pointer := len(processedBytes)
-			processedBytes = append(processedBytes, b...)
-
-			if pointer == 0 {
-				if b[0] != start1 {
-					// Suppress logging completely for text data to reduce noise
-					processedBytes = emptyByte
-				} else {
-					debugLog("🔍 HEADER: Found START1 (0x%02x)", b[0])
-				}
-			} else if pointer == 1 {
-				if b[0] != start2 {
-					debugLog("🔍 HEADER: Expected START2 (0x%02x), got 0x%02x - resetting", start2, b[0])
-					processedBytes = emptyByte
-				} else {
-					debugLog("🔍 HEADER: Found START2 (0x%02x)", b[0])
-				}
-			} else if pointer >= headerLen {
-				packetLength := int((processedBytes[2] << 8) + processedBytes[3])
-
-				if pointer == headerLen {
-					debugLog("🔍 PACKET LENGTH: Calculated length=%d (bytes 2-3: 0x%02x 0x%02x)",
-						packetLength, processedBytes[2], processedBytes[3])
-					if packetLength > maxToFromRadioSzie {
-						errorLog("❌ PACKET TOO LARGE: %d > %d - resetting", packetLength, maxToFromRadioSzie)
-						processedBytes = emptyByte
-					}
-				}
-
-				if len(processedBytes) != 0 && pointer+1 == packetLength+headerLen {
-					payloadBytes := processedBytes[headerLen:]
-
-					debugLog("🔍 PARSING PROTOBUF: TotalLen=%d, HeaderLen=%d, PayloadLen=%d, ExpectedLen=%d",
-						len(processedBytes), headerLen, len(payloadBytes), packetLength)
-
-					// Validate payload before attempting to parse
-					if len(payloadBytes) == 0 {
-						warnLog("⚠️  EMPTY PAYLOAD: Skipping empty protobuf payload")
-						processedBytes = emptyByte
-						continue
-					}
-
-					if len(payloadBytes) != packetLength {
-						warnLog("⚠️  LENGTH MISMATCH: Expected %d bytes, got %d bytes", packetLength, len(payloadBytes))
-						processedBytes = emptyByte
-						continue
-					}
-
-					// Try to decode as protobuf first - if it fails, skip (this function only returns protobuf)
-					fromRadio := pb.FromRadio{}
-					if err := proto.Unmarshal(payloadBytes, &fromRadio); err != nil {
-						// Protobuf parsing failed - skip this data (ReadResponse only returns protobuf packets)
-						debugLog("🔍 PROTOBUF DECODE FAILED: Skipping non-protobuf data (len=%d)", len(payloadBytes))
-						processedBytes = emptyByte
-						continue
-					}
-
-					debugLog("✅ PROTOBUF DECODED: Type=%T, PayloadVariant=%T",
-						&fromRadio, fromRadio.PayloadVariant)
-
-					FromRadioPackets = append(FromRadioPackets, &fromRadio)
-					processedBytes = emptyByte
-				}
-			}
+	return r.ReadResponseContext(context.Background())
+}
 
-		} else {
-			debugLog("📥 READRESPONSE: Empty byte received, breaking")
-			break
-		}
+// ReadResponseContext returns the FromRadio packets received from the radio until it has been
+// quiet for two seconds or ctx is done
+func (r *Radio) ReadResponseContext(ctx context.Context) (FromRadioPackets []*pb.FromRadio, err error) {
+	r.log().Debug("reading responses")
 
+	FromRadioPackets, err = r.readProtobufResponses(ctx, 0)
+	if err != nil {
+		r.log().Error("reading responses failed", "err", err)
+		return nil, err
 	}
 
-	infoLog("📥 READRESPONSE: Completed - Found %d packets, TotalBytesRead=%d",
-		len(FromRadioPackets), totalBytesRead)
-
-	if len(processedBytes) > 0 {
-		warnLog("⚠️  READRESPONSE: %d unprocessed bytes remaining: %x",
-			len(processedBytes), processedBytes)
-	}
+	r.log().Info("read responses", "packets", len(FromRadioPackets))
 
 	return FromRadioPackets, nil
 
 }
 
-// ReadResponseBatch reads responses from the serial port with a maximum count limit
+// ReadResponseBatch reads responses from the radio with a maximum count limit. The timeout
+// argument has no effect and is kept for compatibility; use ReadResponseBatchContext to bound the read
 func (r *Radio) ReadResponseBatch(timeout bool, maxResponses int) (FromRadioPackets []*pb.FromRadio, err error) {
-	infoLog("📥 READRESPONSE_BATCH: Starting to read radio response (timeout=%v, maxResponses=%d)", timeout, maxResponses)
-
-	b := make([]byte, 1)
-	emptyByte := make([]byte, 0)
-	processedBytes := make([]byte, 0)
-	repeatByteCounter := 0
-	previousByte := make([]byte, 1)
-	totalBytesRead := 0
-	responseCount := 0
-
-	for responseCount < maxResponses {
-		err := r.streamer.Read(b)
-		if err == nil {
-			totalBytesRead++
-		}
-
-		if bytes.Equal(b, previousByte) {
-			repeatByteCounter++
-		} else {
-			repeatByteCounter = 0
-		}
+	return r.ReadResponseBatchContext(context.Background(), maxResponses)
+}
 
-		if err == io.EOF || repeatByteCounter > 20 || errors.Is(err, os.ErrDeadlineExceeded) {
-			debugLog("📥 READRESPONSE_BATCH: Breaking loop - EOF=%v, RepeatCount=%d, Timeout=%v, TotalBytes=%d, Responses=%d",
-				err == io.EOF, repeatByteCounter, errors.Is(err, os.ErrDeadlineExceeded), totalBytesRead, responseCount)
-			break
-		} else if err != nil {
-			errorLog("❌ READRESPONSE_BATCH: Read error: %v", err)
-			return nil, err
-		}
-		copy(previousByte, b)
-
-		if len(b) > 0 {
-			pointer := len(processedBytes)
-			processedBytes = append(processedBytes, b...)
-
-			if pointer == 0 {
-				if b[0] != start1 {
-					// Suppress logging completely for text data to reduce noise
-					processedBytes = emptyByte
-				} else {
-					debugLog("🔍 HEADER: Found START1 (0x%02x)", b[0])
-				}
-			} else if pointer == 1 {
-				if b[0] != start2 {
-					warnLog("⚠️  HEADER: Expected START2 (0x%02x) but got (0x%02x), resetting", start2, b[0])
-					processedBytes = emptyByte
-				} else {
-					debugLog("🔍 HEADER: Found START2 (0x%02x)", b[0])
-				}
-			} else if pointer == 2 || pointer == 3 {
-				// Length bytes - continue collecting
-			} else if pointer >= 4 {
-				// We have header, now check if we have complete packet
-				if len(processedBytes) >= 4 {
-					packetLength := int((processedBytes[2] << 8) + processedBytes[3]) // Big-endian like other functions
-					totalExpectedLength := 4 + packetLength
-
-					if len(processedBytes) >= totalExpectedLength {
-						// We have a complete packet
-						debugLog("🔍 PACKET LENGTH: Calculated length=%d (bytes 2-3: 0x%02x 0x%02x)",
-							packetLength, processedBytes[2], processedBytes[3])
-
-						payloadBytes := processedBytes[4:totalExpectedLength]
-
-						debugLog("🔍 PARSING PROTOBUF: TotalLen=%d, HeaderLen=4, PayloadLen=%d, ExpectedLen=%d",
-							len(processedBytes), len(payloadBytes), packetLength)
-
-						// Try to decode as protobuf first - if it fails, skip (this function only returns protobuf)
-						var fromRadio pb.FromRadio
-						if err := proto.Unmarshal(payloadBytes, &fromRadio); err != nil {
-							debugLog("🔍 PROTOBUF DECODE FAILED: Skipping non-protobuf data (len=%d)", len(payloadBytes))
-							processedBytes = emptyByte
-							continue
-						}
-
-						debugLog("✅ PROTOBUF DECODED: Type=%T, PayloadVariant=%T", &fromRadio, fromRadio.PayloadVariant)
-						FromRadioPackets = append(FromRadioPackets, &fromRadio)
-						responseCount++
-
-						// Remove processed packet and continue with remaining bytes
-						if len(processedBytes) > totalExpectedLength {
-							processedBytes = processedBytes[totalExpectedLength:]
-						} else {
-							processedBytes = emptyByte
-						}
-
-						// Check if we've reached our limit
-						if responseCount >= maxResponses {
-							infoLog("📥 READRESPONSE_BATCH: Reached max responses limit (%d), stopping", maxResponses)
-							break
-						}
-					}
-				}
-			}
+// ReadResponseBatchContext reads at most maxResponses packets, stopping early when the radio goes
+// quiet or ctx is done
+func (r *Radio) ReadResponseBatchContext(ctx context.Context, maxResponses int) (FromRadioPackets []*pb.FromRadio, err error) {
+	r.log().Debug("reading responses", "max_responses", maxResponses)
 
-		} else {
-			debugLog("📥 READRESPONSE_BATCH: Empty byte received, breaking")
-			break
-		}
+	FromRadioPackets, err = r.readProtobufResponses(ctx, maxResponses)
+	if err != nil {
+		r.log().Error("reading responses failed", "err", err)
+		return nil, err
 	}
 
-	infoLog("📥 READRESPONSE_BATCH: Completed - Found %d packets, TotalBytesRead=%d",
-		len(FromRadioPackets), totalBytesRead)
+	r.log().Info("read responses", "packets", len(FromRadioPackets))
+
+	return FromRadioPackets, nil
+}
+
+// readProtobufResponses collects protobuf responses from the inbox, skipping console text
+func (r *Radio) readProtobufResponses(ctx context.Context, maxResponses int) (packets []*pb.FromRadio, err error) {
+	responses, err := r.collectResponses(ctx, maxResponses, true)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(processedBytes) > 0 {
-		warnLog("⚠️  READRESPONSE_BATCH: %d unprocessed bytes remaining: %x",
-			len(processedBytes), processedBytes)
+	packets = make([]*pb.FromRadio, 0, len(responses))
+	for _, response := range responses {
+		packets = append(packets, response.ProtobufMsg)
 	}
 
-	return FromRadioPackets, nil
+	return packets, nil
 }
 
 // ReadTextResponse reads text responses from the serial port, filtering out protobuf data
@@ -854,6 +702,7 @@ func (r *Radio) createAdminPacket(nodeNum uint32, payload []byte) (packetOut []b
 	radioMessage := pb.ToRadio{
 		PayloadVariant: &pb.ToRadio_Packet{
 			Packet: &pb.MeshPacket{
+				Id:      newPacketID(),
 				To:      nodeNum,
 				WantAck: true,
 				PayloadVariant: &pb.MeshPacket_Decoded{
@@ -876,116 +725,64 @@ func (r *Radio) createAdminPacket(nodeNum uint32, payload []byte) (packetOut []b
 
 }
 
-// getNodeNum returns the current NodeNumber after querying the radio
-func (r *Radio) getNodeNum() (err error) {
-	// Send first request for Radio and Node information
-	nodeInfo := pb.ToRadio{PayloadVariant: &pb.ToRadio_WantConfigId{WantConfigId: 42}}
-
-	out, err := proto.Marshal(&nodeInfo)
-	if err != nil {
-		return err
-	}
-
-	r.sendPacket(out)
-
-	radioResponses, err := r.GetRadioInfo()
+// getNodeNum refreshes the node number by requesting the radio's config. The node database is
+// skipped since only MyInfo is needed
+func (r *Radio) getNodeNum(ctx context.Context) (err error) {
+	snapshot, err := r.HandshakeContext(ctx, HandshakeOptions{Nonce: ConfigOnlyNonce})
 	if err != nil {
 		return err
 	}
 
-	// Gather the Node number for channel settings requests
-	nodeNum := uint32(0)
-	myInfoCount := 0
-	for _, response := range radioResponses {
-		if info, ok := response.GetPayloadVariant().(*pb.FromRadio_MyInfo); ok {
-			nodeNum = info.MyInfo.MyNodeNum
-			myInfoCount++
-			infoLog("🎯 FOUND MyInfo PACKET: NodeNum=%d (!%x)", nodeNum, nodeNum)
-		}
-	}
+	nodeNum := snapshot.MyInfo.GetMyNodeNum()
+	r.connMu.Lock()
+	r.nodeNum = nodeNum
+	r.ownConfig = snapshot
+	r.retagLogger()
+	r.connMu.Unlock()
 
-	infoLog("📊 NODE ID DETECTION: Found %d MyInfo packets out of %d total responses", myInfoCount, len(radioResponses))
 	if nodeNum == 0 {
-		warnLog("⚠️  NO MyInfo PACKET FOUND - Node ID will be 0")
+		r.log().Warn("no MyInfo in config, node number is unknown")
+	} else {
+		r.log().Info("found node number")
 	}
-
-	r.nodeNum = nodeNum
 	return
 }
 
 // GetRadioInfo retrieves information from the radio including config and adjacent Node information
 func (r *Radio) GetRadioInfo() (radioResponses []*pb.FromRadio, err error) {
-	infoLog("🔄 GETRADIOINFO: Starting radio info request")
-
-	// Send first request for Radio and Node information
-	nodeInfo := pb.ToRadio{PayloadVariant: &pb.ToRadio_WantConfigId{WantConfigId: 42}}
-
-	out, err := proto.Marshal(&nodeInfo)
-	if err != nil {
-		errorLog("❌ GETRADIOINFO: Failed to marshal WantConfigId: %v", err)
-		return nil, err
-	}
-
-	err = r.sendPacket(out)
-	if err != nil {
-		return nil, err
-	}
-
-	checks := 0
+	return r.GetRadioInfoContext(context.Background())
+}
 
-	infoLog("📥 GETRADIOINFO: Reading initial response...")
-	radioResponses, err = r.ReadResponse(true)
+// GetRadioInfoContext is GetRadioInfo bounded by ctx. It returns the frames of a full config
+// dump; use HandshakeContext for the same data as a DeviceSnapshot
+func (r *Radio) GetRadioInfoContext(ctx context.Context) (radioResponses []*pb.FromRadio, err error) {
+	r.log().Debug("requesting radio info")
 
+	snapshot, err := r.HandshakeContext(ctx, HandshakeOptions{})
 	if err != nil {
-		errorLog("❌ GETRADIOINFO: Initial ReadResponse failed: %v", err)
+		r.log().Error("radio info request failed", "err", err)
 		return nil, err
 	}
 
-	infoLog("📊 GETRADIOINFO: Initial response count: %d", len(radioResponses))
-	for i, resp := range radioResponses {
-		debugLog("📊 GETRADIOINFO: Response #%d: Type=%T, PayloadVariant=%T",
-			i, resp, resp.PayloadVariant)
-	}
-
-	for checks < 5 && len(radioResponses) == 0 {
-		infoLog("🔄 GETRADIOINFO: Retry %d/5 - no responses yet", checks+1)
-
-		// Add a small delay before retry to let radio process
-		time.Sleep(500 * time.Millisecond)
-
-		radioResponses, err = r.ReadResponse(true)
-		if err != nil {
-			errorLog("❌ GETRADIOINFO: ReadResponse retry %d failed: %v", checks+1, err)
-			// Don't return immediately - try a few more times
-			checks++
-			time.Sleep(1 * time.Second)
-			continue
-		}
-
-		infoLog("📊 GETRADIOINFO: Retry %d response count: %d", checks+1, len(radioResponses))
-		for i, resp := range radioResponses {
-			debugLog("📊 GETRADIOINFO: Retry %d Response #%d: Type=%T, PayloadVariant=%T",
-				checks+1, i, resp, resp.PayloadVariant)
-		}
-
-		checks++
-		if len(radioResponses) == 0 {
-			time.Sleep(1 * time.Second)
-		}
-	}
-
-	if len(radioResponses) == 0 {
-		errorLog("❌ GETRADIOINFO: No responses after %d retries", checks)
-		return nil, errors.New("failed to get radio info after multiple retries")
-	}
+	r.log().Info("got radio info", "frames", len(snapshot.Frames))
+	return snapshot.Frames, nil
+}
 
-	infoLog("✅ GETRADIOINFO: Success! Got %d responses after %d attempts", len(radioResponses), checks+1)
-	return
+// SendTextMessage sends a free form text message to other radios. The returned SentPacket
+// reports whether the mesh delivered it
+func (r *Radio) SendTextMessage(message string, to int64, channel int64) (*SentPacket, error) {
+	return r.SendTextMessageContext(context.Background(), message, to, channel)
+}
 
+// SendTextMessageContext sends a text message, giving up when ctx is done. ctx only bounds
+// handing the message to the radio; wait for delivery with the SentPacket
+func (r *Radio) SendTextMessageContext(ctx context.Context, message string, to int64, channel int64) (*SentPacket, error) {
+	return r.sendText(ctx, &pb.Data{Payload: []byte(message)}, to, channel)
 }
 
-// SendTextMessage sends a free form text message to other radios
-func (r *Radio) SendTextMessage(message string, to int64, channel int64) error {
+// sendText sends a text message packet carrying data, which holds the text and any reply or
+// reaction fields
+func (r *Radio) sendText(ctx context.Context, data *pb.Data, to int64, channel int64) (*SentPacket, error) {
 	var address int64
 	if to == 0 {
 		address = broadcastNum
@@ -994,45 +791,33 @@ func (r *Radio) SendTextMessage(message string, to int64, channel int64) error {
 	}
 
 	// This constant is defined in Constants_DATA_PAYLOAD_LEN, but not in a friendly way to use
-	if len(message) > 240 {
-		return errors.New("message too large")
-	}
-
-	rand.Seed(time.Now().UnixNano())
-	packetID := rand.Intn(2386828-1) + 1
-
-	radioMessage := pb.ToRadio{
-		PayloadVariant: &pb.ToRadio_Packet{
-			Packet: &pb.MeshPacket{
-				To:      uint32(address),
-				WantAck: true,
-				Id:      uint32(packetID),
-				Channel: uint32(channel),
-				PayloadVariant: &pb.MeshPacket_Decoded{
-					Decoded: &pb.Data{
-						Payload: []byte(message),
-						Portnum: pb.PortNum_TEXT_MESSAGE_APP,
-					},
-				},
-			},
+	if len(data.Payload) > 240 {
+		return nil, fmt.Errorf("%w: text message is %d bytes, the limit is 240", ErrPayloadTooLarge, len(data.Payload))
+	}
+
+	data.Portnum = pb.PortNum_TEXT_MESSAGE_APP
+	packet := &pb.MeshPacket{
+		To:      uint32(address),
+		WantAck: true,
+		Id:      newPacketID(),
+		Channel: uint32(channel),
+		PayloadVariant: &pb.MeshPacket_Decoded{
+			Decoded: data,
 		},
 	}
 
-	out, err := proto.Marshal(&radioMessage)
-	if err != nil {
-		return err
-	}
-
-	if err := r.sendPacket(out); err != nil {
-		return err
-	}
-
-	return nil
+	r.texts.remember(packet.Id, textConversation{from: r.GetNodeID(), to: packet.To, channel: packet.Channel})
 
+	return r.sendTracked(ctx, packet)
 }
 
 // SetRadioOwner sets the owner of the radio visible on the public mesh
 func (r *Radio) SetRadioOwner(name string) error {
+	return r.SetRadioOwnerContext(context.Background(), name)
+}
+
+// SetRadioOwnerContext sets the owner of the radio, giving up when ctx is done
+func (r *Radio) SetRadioOwnerContext(ctx context.Context, name string) error {
 
 	if len(name) <= 2 {
 		return errors.New("name too short")
@@ -1052,14 +837,14 @@ func (r *Radio) SetRadioOwner(name string) error {
 		return err
 	}
 
-	nodeNum := r.nodeNum
+	nodeNum := r.GetNodeID()
 
 	packet, err := r.createAdminPacket(nodeNum, out)
 	if err != nil {
 		return err
 	}
 
-	if err := r.sendPacket(packet); err != nil {
+	if err := r.sendPacket(ctx, packet); err != nil {
 		return err
 	}
 
@@ -1068,6 +853,11 @@ func (r *Radio) SetRadioOwner(name string) error {
 
 // SetModemMode sets the channel modem setting to be fast or slow
 func (r *Radio) SetModemMode(mode string) error {
+	return r.SetModemModeContext(context.Background(), mode)
+}
+
+// SetModemModeContext sets the modem preset, giving up when ctx is done
+func (r *Radio) SetModemModeContext(ctx context.Context, mode string) error {
 
 	var modemSetting pb.Config_LoRaConfig_ModemPreset
 
@@ -1106,14 +896,14 @@ func (r *Radio) SetModemMode(mode string) error {
 		return err
 	}
 
-	nodeNum := r.nodeNum
+	nodeNum := r.GetNodeID()
 
 	packet, err := r.createAdminPacket(nodeNum, out)
 	if err != nil {
 		return err
 	}
 
-	if err := r.sendPacket(packet); err != nil {
+	if err := r.sendPacket(ctx, packet); err != nil {
 		return err
 	}
 
@@ -1123,6 +913,11 @@ func (r *Radio) SetModemMode(mode string) error {
 
 // SetLocation sets a fixed location for the radio
 func (r *Radio) SetLocation(lat int32, long int32, alt int32) error {
+	return r.SetLocationContext(context.Background(), lat, long, alt)
+}
+
+// SetLocationContext sets a fixed location, giving up when ctx is done
+func (r *Radio) SetLocationContext(ctx context.Context, lat int32, long int32, alt int32) error {
 
 	positionPacket := pb.Position{
 		LatitudeI:  &lat,
@@ -1135,7 +930,7 @@ func (r *Radio) SetLocation(lat int32, long int32, alt int32) error {
 		return err
 	}
 
-	nodeNum := r.nodeNum
+	nodeNum := r.GetNodeID()
 
 	radioMessage := pb.ToRadio{
 		PayloadVariant: &pb.ToRadio_Packet{
@@ -1158,7 +953,7 @@ func (r *Radio) SetLocation(lat int32, long int32, alt int32) error {
 		return err
 	}
 
-	if err := r.sendPacket(packet); err != nil {
+	if err := r.sendPacket(ctx, packet); err != nil {
 		return err
 	}
 
@@ -1167,7 +962,12 @@ func (r *Radio) SetLocation(lat int32, long int32, alt int32) error {
 
 // SetNodeFavorite marks a node as favorite on the radio device
 func (r *Radio) SetNodeFavorite(nodeID uint32) error {
-	infoLog("🌟 GOMESH: SetNodeFavorite called for node %d (!%x)", nodeID, nodeID)
+	return r.SetNodeFavoriteContext(context.Background(), nodeID)
+}
+
+// SetNodeFavoriteContext marks a node as favorite, giving up when ctx is done
+func (r *Radio) SetNodeFavoriteContext(ctx context.Context, nodeID uint32) error {
+	logger := r.log().With("node", nodeID)
 
 	adminPacket := pb.AdminMessage{
 		PayloadVariant: &pb.AdminMessage_SetFavoriteNode{
@@ -1177,35 +977,34 @@ func (r *Radio) SetNodeFavorite(nodeID uint32) error {
 
 	out, err := proto.Marshal(&adminPacket)
 	if err != nil {
-		errorLog("❌ GOMESH: Failed to marshal admin packet: %v", err)
+		logger.Error("marshalling admin message failed", "err", err)
 		return err
 	}
 
-	debugLog("✅ GOMESH: Admin packet marshaled successfully, size: %d bytes", len(out))
-
-	nodeNum := r.nodeNum
-	debugLog("🔍 GOMESH: Using nodeNum %d for admin packet", nodeNum)
-
+	nodeNum := r.GetNodeID()
 	packet, err := r.createAdminPacket(nodeNum, out)
 	if err != nil {
-		errorLog("❌ GOMESH: Failed to create admin packet: %v", err)
+		logger.Error("creating admin packet failed", "err", err)
 		return err
 	}
 
-	debugLog("✅ GOMESH: Admin packet created successfully, size: %d bytes", len(packet))
-
-	if err := r.sendPacket(packet); err != nil {
-		errorLog("❌ GOMESH: Failed to send packet: %v", err)
+	if err := r.sendPacket(ctx, packet); err != nil {
+		logger.Error("sending admin packet failed", "err", err)
 		return err
 	}
 
-	infoLog("✅ GOMESH: SetNodeFavorite packet sent successfully for node %d", nodeID)
+	logger.Info("node marked as favorite")
 	return nil
 }
 
 // RemoveNodeFavorite removes a node from favorites on the radio device
 func (r *Radio) RemoveNodeFavorite(nodeID uint32) error {
-	infoLog("🌟 GOMESH: RemoveNodeFavorite called for node %d (!%x)", nodeID, nodeID)
+	return r.RemoveNodeFavoriteContext(context.Background(), nodeID)
+}
+
+// RemoveNodeFavoriteContext removes a favorite node, giving up when ctx is done
+func (r *Radio) RemoveNodeFavoriteContext(ctx context.Context, nodeID uint32) error {
+	logger := r.log().With("node", nodeID)
 
 	adminPacket := pb.AdminMessage{
 		PayloadVariant: &pb.AdminMessage_RemoveFavoriteNode{
@@ -1215,34 +1014,33 @@ func (r *Radio) RemoveNodeFavorite(nodeID uint32) error {
 
 	out, err := proto.Marshal(&adminPacket)
 	if err != nil {
-		errorLog("❌ GOMESH: Failed to marshal admin packet: %v", err)
+		logger.Error("marshalling admin message failed", "err", err)
 		return err
 	}
 
-	debugLog("✅ GOMESH: Admin packet marshaled successfully, size: %d bytes", len(out))
-
-	nodeNum := r.nodeNum
-	debugLog("🔍 GOMESH: Using nodeNum %d for admin packet", nodeNum)
-
+	nodeNum := r.GetNodeID()
 	packet, err := r.createAdminPacket(nodeNum, out)
 	if err != nil {
-		errorLog("❌ GOMESH: Failed to create admin packet: %v", err)
+		logger.Error("creating admin packet failed", "err", err)
 		return err
 	}
 
-	debugLog("✅ GOMESH: Admin packet created successfully, size: %d bytes", len(packet))
-
-	if err := r.sendPacket(packet); err != nil {
-		errorLog("❌ GOMESH: Failed to send packet: %v", err)
+	if err := r.sendPacket(ctx, packet); err != nil {
+		logger.Error("sending admin packet failed", "err", err)
 		return err
 	}
 
-	infoLog("✅ GOMESH: RemoveNodeFavorite packet sent successfully for node %d", nodeID)
+	logger.Info("node removed from favorites")
 	return nil
 }
 
 // Send a factory reset command to the radio
 func (r *Radio) FactoryRest() error {
+	return r.FactoryResetContext(context.Background())
+}
+
+// FactoryResetContext sends a factory reset command to the radio, giving up when ctx is done
+func (r *Radio) FactoryResetContext(ctx context.Context) error {
 	adminPacket := pb.AdminMessage{
 		PayloadVariant: &pb.AdminMessage_FactoryResetDevice{
 			FactoryResetDevice: 1,
@@ -1253,21 +1051,49 @@ func (r *Radio) FactoryRest() error {
 		return err
 	}
 
-	nodeNum := r.nodeNum
+	nodeNum := r.GetNodeID()
 
 	packet, err := r.createAdminPacket(nodeNum, out)
 	if err != nil {
 		return err
 	}
 
-	if err := r.sendPacket(packet); err != nil {
+	if err := r.sendPacket(ctx, packet); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// Close closes the serial port. Added so users can defer the close after opening
+// Close tells the radio the client is disconnecting and closes the port. Added so users can
+// defer the close after opening
 func (r *Radio) Close() {
-	r.streamer.Close()
+	// Cancelling under connMu stops a reconnect from swapping in a transport after this point
+	r.connMu.Lock()
+	open := r.closeCtx != nil && r.closeCtx.Err() == nil
+	if r.closeCancel != nil {
+		r.closeCancel()
+	}
+	s := r.streamer
+	r.connMu.Unlock()
+
+	// Let the firmware know no client is attached any more
+	if open {
+		if err := r.sendDisconnect(); err != nil {
+			r.log().Debug("could not send disconnect", "err", err)
+		}
+	}
+
+	s.Close()
+
+	// Wait for the reader so subscriptions are closed by the time Close returns
+	if r.readerDone != nil {
+		<-r.readerDone
+	}
+	r.connEvents.close()
+	r.logs.close()
+	r.queue.events.close()
+	r.deliveries.close()
+	r.chunks.payloads.close()
+	r.messages.close()
 }
@@ -13,7 +13,7 @@ var port = flag.String("port", "", "port the radio is connected to")
 
 func TestRadioInfo(t *testing.T) {
 
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
@@ -31,7 +31,7 @@ func TestRadioInfo(t *testing.T) {
 }
 
 func TestGetChannelInfo(t *testing.T) {
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
@@ -49,13 +49,13 @@ func TestGetChannelInfo(t *testing.T) {
 
 func TestSendText(t *testing.T) {
 
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
 	defer radio.Close()
 
-	err = radio.SendTextMessage("Test", 0, 1)
+	_, err = radio.SendTextMessage("Test", 0, 1)
 
 	if err != nil {
 		t.Fatalf("Error when communicating with radio: %v", err)
@@ -65,7 +65,7 @@ func TestSendText(t *testing.T) {
 
 func TestSetOwner(t *testing.T) {
 
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
@@ -113,7 +113,7 @@ func TestSetOwner(t *testing.T) {
 
 func TestSetChannelURL(t *testing.T) {
 
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
@@ -142,7 +142,7 @@ func TestSetChannelURL(t *testing.T) {
 
 func TestSetModem(t *testing.T) {
 
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
@@ -156,7 +156,7 @@ func TestSetModem(t *testing.T) {
 }
 
 func TestSetRadioConfig(t *testing.T) {
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
@@ -184,7 +184,7 @@ func TestSetRadioConfig(t *testing.T) {
 }
 
 func TestAddChannel(t *testing.T) {
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
@@ -219,7 +219,7 @@ func TestAddChannel(t *testing.T) {
 }
 
 func TestDeleteChannel(t *testing.T) {
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
@@ -259,7 +259,7 @@ func TestDeleteChannel(t *testing.T) {
 
 func TestSetChannelSettings(t *testing.T) {
 
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
@@ -311,7 +311,7 @@ func TestSetChannelSettings(t *testing.T) {
 
 func TestSetLocation(t *testing.T) {
 
-	radio, err := radioSetup()
+	radio, err := radioSetup(t)
 	if err != nil {
 		t.Fatalf("Error when opening serial communications with radio: %v", err)
 	}
@@ -339,7 +339,13 @@ func TestSetLocation(t *testing.T) {
 	}
 }
 
-func radioSetup() (radio Radio, err error) {
+// radioSetup connects to the radio given with -port. Without one the test is skipped; the
+// tests in the emulator package cover the same calls without hardware
+func radioSetup(t *testing.T) (radio Radio, err error) {
+	if *port == "" {
+		t.Skip("no -port given")
+	}
+
 	radio = Radio{}
 
 	err = radio.Init(*port)
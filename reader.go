@@ -0,0 +1,397 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// subscriptionBuffer is the number of frames a subscriber can fall behind before the oldest are dropped
+const subscriptionBuffer = 256
+
+// inboxBuffer is the number of unread responses kept for the ReadResponse helpers
+const inboxBuffer = 1024
+
+// responseIdleTimeout is how long the ReadResponse helpers wait for the radio to go quiet
+const responseIdleTimeout = 2 * time.Second
+
+// inboxEntry is a response kept for the ReadResponse helpers, with the time it arrived
+type inboxEntry struct {
+	response *RadioResponse
+	received time.Time
+}
+
+// PacketFilter selects which FromRadio frames a Subscription receives. Every populated field
+// must match; the zero value matches everything.
+type PacketFilter struct {
+	// Variants limits delivery to frames whose payload variant has the same type as one of
+	// the given values, e.g. &pb.FromRadio_Packet{} or &pb.FromRadio_NodeInfo{}
+	Variants []interface{}
+
+	// PortNums limits delivery to decoded mesh packets on one of the given ports
+	PortNums []pb.PortNum
+
+	// From limits delivery to mesh packets sent by this node number
+	From uint32
+
+	// Channel limits delivery to mesh packets received on this channel index
+	Channel *uint32
+}
+
+// matches reports whether the frame passes the filter
+func (f PacketFilter) matches(fromRadio *pb.FromRadio) bool {
+
+	if len(f.Variants) > 0 {
+		variantType := reflect.TypeOf(fromRadio.GetPayloadVariant())
+		found := false
+		for _, variant := range f.Variants {
+			if reflect.TypeOf(variant) == variantType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.PortNums) == 0 && f.From == 0 && f.Channel == nil {
+		return true
+	}
+
+	packet := fromRadio.GetPacket()
+	if packet == nil {
+		return false
+	}
+
+	if len(f.PortNums) > 0 {
+		portNum := packet.GetDecoded().GetPortnum()
+		found := false
+		for _, p := range f.PortNums {
+			if packet.GetDecoded() != nil && p == portNum {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.From != 0 && packet.From != f.From {
+		return false
+	}
+
+	if f.Channel != nil && packet.Channel != *f.Channel {
+		return false
+	}
+
+	return true
+}
+
+// Subscription delivers frames read from the radio that match its filter. Frames are shared
+// between subscribers and must be treated as read only. A subscriber that falls more than
+// subscriptionBuffer frames behind loses the oldest frames.
+type Subscription struct {
+	// C receives matching frames. It is closed by Unsubscribe or when the radio is closed
+	C <-chan *pb.FromRadio
+
+	ch      chan *pb.FromRadio
+	filter  PacketFilter
+	radio   *Radio
+	once    sync.Once
+	dropped bool // A frame was dropped for falling behind, guarded by radio.subsMu
+}
+
+// Unsubscribe stops delivery and closes C
+func (s *Subscription) Unsubscribe() {
+	s.radio.subsMu.Lock()
+	delete(s.radio.subs, s)
+	s.radio.subsMu.Unlock()
+
+	s.close()
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() { close(s.ch) })
+}
+
+// Subscribe returns a Subscription receiving every frame from the radio that matches filter.
+// Frames are read continuously in the background, so packets arriving while other calls are
+// in progress are not lost.
+func (r *Radio) Subscribe(filter PacketFilter) *Subscription {
+	return r.subscribe(filter, subscriptionBuffer)
+}
+
+// subscribe returns a Subscription that can fall buffer frames behind
+func (r *Radio) subscribe(filter PacketFilter, buffer int) *Subscription {
+	ch := make(chan *pb.FromRadio, buffer)
+	sub := &Subscription{C: ch, ch: ch, filter: filter, radio: r}
+
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	if r.subs == nil {
+		// The reader is not running, so nothing will ever be delivered
+		sub.close()
+		return sub
+	}
+	r.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// offer sends v on ch without blocking, discarding the oldest queued value if ch is full.
+// It reports whether a value had to be dropped
+func offer[T any](ch chan T, v T) (dropped bool) {
+	for {
+		select {
+		case ch <- v:
+			return dropped
+		default:
+		}
+
+		select {
+		case <-ch:
+			dropped = true
+		default:
+		}
+	}
+}
+
+// startReader launches the goroutine that owns all reads from the transport
+func (r *Radio) startReader() {
+	r.subsMu.Lock()
+	r.subs = make(map[*Subscription]struct{})
+	r.pending = make(map[uint32]chan *pb.MeshPacket)
+	r.sent = make(map[uint32]*SentPacket)
+	r.inbox = make(chan inboxEntry, inboxBuffer)
+	r.readerDone = make(chan struct{})
+	r.subsMu.Unlock()
+
+	go r.readLoop(r.conn().transport, r.readerDone)
+}
+
+// readLoop reads from the transport until the radio is closed or the connection is lost for
+// good. With a reconnect policy set, a failed transport is replaced and reading carries on
+func (r *Radio) readLoop(transport Transport, done chan struct{}) {
+	defer close(done)
+	defer r.closeSubscriptions()
+
+	for {
+		err := r.readTransport(transport)
+
+		if r.Reconnect != nil && r.closeCtx.Err() == nil {
+			transport, err = r.reconnect(err)
+			if err == nil {
+				continue
+			}
+		}
+
+		r.subsMu.Lock()
+		r.readErr = err
+		r.subsMu.Unlock()
+
+		r.emitConnection(ConnectionClosed, 0, err)
+		return
+	}
+}
+
+// readTransport decodes the stream until the transport fails or is closed, fanning frames out
+// to the inbox and to subscribers
+func (r *Radio) readTransport(transport Transport) error {
+
+	// The reader blocks until data arrives; Close unblocks it by closing the transport
+	transport.SetReadDeadline(time.Time{})
+
+	frames := NewFrameReader(transport)
+	var counted FrameStats
+
+	for {
+		frame, err := frames.ReadFrame()
+
+		stats := frames.Stats()
+		r.metrics.addFrameStats(stats.sub(counted))
+		counted = stats
+
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			r.log().Debug("reader stopped", "err", err)
+			return err
+		}
+
+		responses := decodeResponses(r.log(), frame)
+		if frame.Kind == FrameProtobuf {
+			r.metrics.decoded(len(responses) > 0)
+		}
+
+		for _, response := range responses {
+			r.dispatch(response)
+		}
+	}
+}
+
+// dispatch hands a decoded response to the inbox and every matching subscriber
+func (r *Radio) dispatch(response *RadioResponse) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	// Radios only read through subscriptions never empty the inbox, so overflowing it is
+	// logged once until the next ReadResponse
+	if offer(r.inbox, inboxEntry{response: response, received: time.Now()}) && !r.inboxFull {
+		r.inboxFull = true
+		r.log().Debug("inbox full, dropping the oldest responses until the next read")
+	}
+
+	r.publishLog(response)
+
+	if response.Type != ResponseTypeProtobuf {
+		return
+	}
+
+	if status := response.ProtobufMsg.GetQueueStatus(); status != nil {
+		r.updateQueueStatus(status)
+	}
+	if channel := response.ProtobufMsg.GetChannel(); channel != nil {
+		r.channels.update(channel)
+	}
+	if lora := response.ProtobufMsg.GetConfig().GetLora(); lora != nil {
+		r.channels.updateLora(lora)
+	}
+	if packet := response.ProtobufMsg.GetPacket(); packet != nil {
+		r.metrics.packetReceived(packet, time.Now())
+		r.deliverAck(packet)
+		if packet.GetDecoded().GetPortnum() == pb.PortNum_TEXT_MESSAGE_APP {
+			r.texts.remember(packet.GetId(), textConversation{from: packet.GetFrom(), to: packet.GetTo(), channel: packet.GetChannel()})
+			r.messages.publish(r.textMessage(packet))
+		}
+	}
+	r.deliverPending(response.ProtobufMsg)
+
+	for sub := range r.subs {
+		if sub.filter.matches(response.ProtobufMsg) {
+			if offer(sub.ch, response.ProtobufMsg) {
+				sub.dropped = true
+				r.log().Warn("subscriber not keeping up, dropped oldest frame")
+			}
+		}
+	}
+}
+
+// closeSubscriptions closes the inbox and every subscriber, and fails packets still waiting for
+// an ack, once the reader has stopped
+func (r *Radio) closeSubscriptions() {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	for sub := range r.subs {
+		sub.close()
+	}
+	r.subs = nil
+	r.pending = nil
+	r.failDeliveries()
+	r.sent = nil
+	close(r.inbox)
+}
+
+// collectResponses reads responses from the inbox until the radio has been quiet for
+// responseIdleTimeout, maxResponses have been collected (0 for no limit) or ctx is done.
+// With protobufOnly set, console text is skipped and does not count towards the limit.
+// Responses that arrived more than responseIdleTimeout before the call are stale and
+// skipped, so answers to a request sent just before are kept but old traffic is not
+func (r *Radio) collectResponses(ctx context.Context, maxResponses int, protobufOnly bool) ([]*RadioResponse, error) {
+	if r.inbox == nil {
+		return nil, ErrNotConnected
+	}
+
+	r.subsMu.Lock()
+	r.inboxFull = false
+	r.subsMu.Unlock()
+	stale := time.Now().Add(-responseIdleTimeout)
+
+	responses := make([]*RadioResponse, 0)
+
+	idle := time.NewTimer(responseIdleTimeout)
+	defer idle.Stop()
+
+	for maxResponses <= 0 || len(responses) < maxResponses {
+		select {
+		case entry, ok := <-r.inbox:
+			if !ok {
+				r.subsMu.Lock()
+				err := r.readErr
+				r.subsMu.Unlock()
+				if len(responses) == 0 && err != nil {
+					return nil, err
+				}
+				return responses, nil
+			}
+			if entry.received.Before(stale) {
+				continue
+			}
+			if protobufOnly && entry.response.Type != ResponseTypeProtobuf {
+				continue
+			}
+			responses = append(responses, entry.response)
+
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(responseIdleTimeout)
+		case <-idle.C:
+			return responses, nil
+		case <-ctx.Done():
+			return responses, contextError(ctx)
+		}
+	}
+
+	return responses, nil
+}
+
+// decodeResponses turns a frame from the stream into responses. Protobuf frames that fail to
+// decode are dropped, console text is split into lines and kept only if it looks like text
+func decodeResponses(logger *slog.Logger, frame Frame) (responses []*RadioResponse) {
+
+	if frame.Kind == FrameText {
+		if !isTextData(frame.Payload) {
+			return nil
+		}
+		for _, line := range extractTextFromBytes(frame.Payload) {
+			responses = append(responses, &RadioResponse{
+				Type:     ResponseTypeText,
+				TextData: line,
+				RawBytes: []byte(line),
+			})
+		}
+		return responses
+	}
+
+	if len(frame.Payload) == 0 {
+		logger.Warn("skipping empty protobuf frame")
+		return nil
+	}
+
+	fromRadio := pb.FromRadio{}
+	if err := proto.Unmarshal(frame.Payload, &fromRadio); err != nil {
+		logger.Debug("dropping undecodable frame", "bytes", len(frame.Payload), "err", err)
+		return nil
+	}
+
+	logger.Debug("decoded frame", "bytes", len(frame.Payload), "variant", fmt.Sprintf("%T", fromRadio.PayloadVariant))
+
+	return []*RadioResponse{{
+		Type:        ResponseTypeProtobuf,
+		ProtobufMsg: &fromRadio,
+		RawBytes:    frame.Raw(),
+	}}
+}
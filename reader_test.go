@@ -0,0 +1,148 @@
+package gomesh
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+func textPacket(from uint32, channel uint32, text string) *pb.FromRadio {
+	return &pb.FromRadio{
+		PayloadVariant: &pb.FromRadio_Packet{
+			Packet: &pb.MeshPacket{
+				From:    from,
+				Channel: channel,
+				PayloadVariant: &pb.MeshPacket_Decoded{
+					Decoded: &pb.Data{
+						Portnum: pb.PortNum_TEXT_MESSAGE_APP,
+						Payload: []byte(text),
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestPacketFilterMatches(t *testing.T) {
+	channelOne := uint32(1)
+	text := textPacket(0x10, 1, "hello")
+	nodeInfo := &pb.FromRadio{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: 0x10}}}
+
+	tests := []struct {
+		name     string
+		filter   PacketFilter
+		frame    *pb.FromRadio
+		expected bool
+	}{
+		{"zero filter matches packet", PacketFilter{}, text, true},
+		{"zero filter matches node info", PacketFilter{}, nodeInfo, true},
+		{"variant match", PacketFilter{Variants: []interface{}{&pb.FromRadio_Packet{}}}, text, true},
+		{"variant mismatch", PacketFilter{Variants: []interface{}{&pb.FromRadio_Packet{}}}, nodeInfo, false},
+		{"port match", PacketFilter{PortNums: []pb.PortNum{pb.PortNum_TEXT_MESSAGE_APP}}, text, true},
+		{"port mismatch", PacketFilter{PortNums: []pb.PortNum{pb.PortNum_POSITION_APP}}, text, false},
+		{"port filter skips non packets", PacketFilter{PortNums: []pb.PortNum{pb.PortNum_TEXT_MESSAGE_APP}}, nodeInfo, false},
+		{"from match", PacketFilter{From: 0x10}, text, true},
+		{"from mismatch", PacketFilter{From: 0x11}, text, false},
+		{"channel match", PacketFilter{Channel: &channelOne}, text, true},
+		{"channel mismatch", PacketFilter{Channel: new(uint32)}, text, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.filter.matches(tt.frame); result != tt.expected {
+				t.Errorf("matches() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSubscribeReceivesPacketsDuringRequests(t *testing.T) {
+	device := newFakeDevice(t, 0x42)
+
+	radio := Radio{}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+
+	texts := radio.Subscribe(PacketFilter{PortNums: []pb.PortNum{pb.PortNum_TEXT_MESSAGE_APP}})
+	nodes := radio.Subscribe(PacketFilter{Variants: []interface{}{&pb.FromRadio_NodeInfo{}}})
+
+	device.push(textPacket(0x99, 0, "arrived while idle"))
+	device.push(&pb.FromRadio{PayloadVariant: &pb.FromRadio_NodeInfo{NodeInfo: &pb.NodeInfo{Num: 0x99}}})
+
+	select {
+	case frame := <-texts.C:
+		if string(frame.GetPacket().GetDecoded().GetPayload()) != "arrived while idle" {
+			t.Fatalf("Unexpected text frame: %v", frame)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for text packet")
+	}
+
+	select {
+	case frame := <-nodes.C:
+		if frame.GetNodeInfo().GetNum() != 0x99 {
+			t.Fatalf("Unexpected node frame: %v", frame)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for node info")
+	}
+
+	// Filtered subscriptions must not see each other's frames
+	select {
+	case frame := <-texts.C:
+		t.Fatalf("Text subscription received unexpected frame: %v", frame)
+	default:
+	}
+
+	nodes.Unsubscribe()
+	if _, ok := <-nodes.C; ok {
+		t.Fatalf("Expected channel to be closed after Unsubscribe")
+	}
+
+	radio.Close()
+	if _, ok := <-texts.C; ok {
+		t.Fatalf("Expected channel to be closed after Close")
+	}
+}
+
+func TestInboxSkipsStaleResponses(t *testing.T) {
+	out := &syncBuffer{}
+	device := newFakeDevice(t, 0x42)
+	radio := Radio{
+		HeartbeatInterval: -1,
+		Logger:            slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	// A radio only read through subscriptions fills its inbox and says so once
+	for i := 0; i < inboxBuffer+10; i++ {
+		radio.dispatch(&RadioResponse{Type: ResponseTypeProtobuf, ProtobufMsg: textPacket(0x99, 0, "unread")})
+	}
+	if n := strings.Count(out.String(), "inbox full"); n != 1 {
+		t.Errorf("Inbox overflow logged %d times, want once", n)
+	}
+
+	// Traffic from long before a read is not returned by it
+	radio.subsMu.Lock()
+	for len(radio.inbox) > 0 {
+		<-radio.inbox
+	}
+	radio.inbox <- inboxEntry{response: &RadioResponse{Type: ResponseTypeProtobuf, ProtobufMsg: textPacket(0x99, 0, "hours old")}, received: time.Now().Add(-time.Hour)}
+	radio.subsMu.Unlock()
+	device.push(textPacket(0x99, 0, "just now"))
+
+	packets, err := radio.ReadResponse(true)
+	if err != nil {
+		t.Fatalf("ReadResponse: %v", err)
+	}
+	if len(packets) != 1 || string(packets[0].GetPacket().GetDecoded().GetPayload()) != "just now" {
+		t.Errorf("ReadResponse = %v, want only the fresh packet", packets)
+	}
+}
@@ -0,0 +1,178 @@
+package gomesh
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// handshakeTimeout bounds the node query run after a reconnect
+const handshakeTimeout = 30 * time.Second
+
+// ConnectionState describes the state of the link between a Radio and its device
+type ConnectionState int
+
+const (
+	ConnectionConnected    ConnectionState = iota // The link is up and the radio answered the handshake
+	ConnectionDisconnected                        // The link dropped; a reconnect may follow
+	ConnectionReconnecting                        // A reconnect attempt is starting
+	ConnectionClosed                              // The radio was closed or gave up reconnecting
+	ConnectionUnhealthy                           // A heartbeat could not be sent
+	ConnectionHealthy                             // Heartbeats are getting through again after a failure
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionConnected:
+		return "connected"
+	case ConnectionDisconnected:
+		return "disconnected"
+	case ConnectionReconnecting:
+		return "reconnecting"
+	case ConnectionClosed:
+		return "closed"
+	case ConnectionUnhealthy:
+		return "unhealthy"
+	case ConnectionHealthy:
+		return "healthy"
+	}
+	return "unknown"
+}
+
+// ConnectionEvent reports a change in the connection to the device
+type ConnectionEvent struct {
+	State   ConnectionState
+	Err     error // The error that caused a disconnect or a failed attempt, if any
+	Attempt int   // The reconnect attempt number, starting at 1
+	Time    time.Time
+}
+
+// ReconnectPolicy enables automatic reconnects when set on Radio.Reconnect before Init. When
+// the transport fails the radio reopens it with exponential backoff, switches serial devices
+// back to API mode, repeats the config handshake and refreshes the node number. Subscriptions
+// stay open across reconnects.
+type ReconnectPolicy struct {
+	// InitialBackoff is the wait before the first attempt, doubled after every failure. Defaults to one second
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait between attempts. Defaults to thirty seconds
+	MaxBackoff time.Duration
+
+	// MaxAttempts gives up after this many consecutive failures; 0 retries forever
+	MaxAttempts int
+
+	// Dial opens a new transport. When nil, radios started with Init or InitContext reopen
+	// the same port; it is required with InitWithTransport
+	Dial func(ctx context.Context) (Transport, error)
+}
+
+func (p ReconnectPolicy) backoff(attempt int) time.Duration {
+	return exponentialBackoff(attempt, p.InitialBackoff, time.Second, p.MaxBackoff, 30*time.Second)
+}
+
+// ConnectionEvents returns a channel of connection state changes. Each call returns a new
+// channel, closed when the radio is closed
+func (r *Radio) ConnectionEvents() <-chan ConnectionEvent {
+	return r.connEvents.subscribe()
+}
+
+func (r *Radio) emitConnection(state ConnectionState, attempt int, err error) {
+	r.connEvents.publish(ConnectionEvent{State: state, Err: err, Attempt: attempt, Time: time.Now()})
+}
+
+// reconnect reopens the transport until it succeeds, the policy gives up or the radio is closed.
+// The handshake needs the reader running, so it is started in the background once the new
+// transport is in place; a failed handshake closes the transport and lands back here. Attempts
+// are counted until a handshake succeeds, so MaxAttempts and the backoff also cover links that
+// come up but fail before the radio answers. Giving up returns the last attempt's error wrapped
+// with cause
+func (r *Radio) reconnect(cause error) (Transport, error) {
+	policy := r.Reconnect
+
+	r.connMu.Lock()
+	attempt := r.reconnects
+	lastErr := r.handshakeErr
+	r.handshakeErr = nil
+	if r.cancelHandshake != nil {
+		// The link the handshake was running on is gone
+		r.cancelHandshake()
+		r.cancelHandshake = nil
+	}
+	r.connMu.Unlock()
+
+	r.emitConnection(ConnectionDisconnected, attempt, cause)
+	if attempt == 0 {
+		r.log().Warn("link lost", "err", cause)
+	} else {
+		r.log().Warn("link lost before the handshake finished", "attempt", attempt, "err", cause)
+	}
+
+	for attempt++; policy.MaxAttempts <= 0 || attempt <= policy.MaxAttempts; attempt++ {
+		if err := sleepContext(r.closeCtx, policy.backoff(attempt)); err != nil {
+			return nil, err
+		}
+
+		r.connMu.Lock()
+		r.reconnects = attempt
+		r.connMu.Unlock()
+
+		r.emitConnection(ConnectionReconnecting, attempt, nil)
+		r.log().Info("reconnecting", "attempt", attempt)
+
+		transport, err := r.dial(r.closeCtx)
+		if err != nil {
+			lastErr = err
+			r.log().Warn("reconnect failed", "attempt", attempt, "err", err)
+			r.emitConnection(ConnectionDisconnected, attempt, err)
+			continue
+		}
+
+		if err := r.setStreamer(streamer{transport: transport}); err != nil {
+			return nil, err
+		}
+		r.resetQueueCredits()
+
+		if r.switchMode {
+			if err := r.switchToAPIMode(r.closeCtx); err != nil {
+				transport.Close()
+				lastErr = err
+				r.log().Warn("reconnect failed to switch to API mode", "attempt", attempt, "err", err)
+				r.emitConnection(ConnectionDisconnected, attempt, err)
+				continue
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.closeCtx, handshakeTimeout)
+		r.connMu.Lock()
+		r.cancelHandshake = cancel
+		r.connMu.Unlock()
+
+		go func(attempt int) {
+			defer cancel()
+
+			if err := r.getNodeNum(ctx); err != nil {
+				r.log().Warn("handshake after reconnect failed", "attempt", attempt, "err", err)
+				r.connMu.Lock()
+				r.handshakeErr = err
+				r.connMu.Unlock()
+				transport.Close()
+				return
+			}
+
+			r.connMu.Lock()
+			r.reconnects = 0
+			r.connMu.Unlock()
+
+			r.log().Info("reconnected", "attempt", attempt)
+			r.metrics.reconnected()
+			r.emitConnection(ConnectionConnected, attempt, nil)
+		}(attempt)
+
+		return transport, nil
+	}
+
+	if lastErr == nil {
+		return nil, cause
+	}
+	return nil, fmt.Errorf("giving up after %d reconnect attempts: %w (link lost: %w)", policy.MaxAttempts, lastErr, cause)
+}
@@ -0,0 +1,200 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+func TestReconnectPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   ReconnectPolicy
+		attempt  int
+		expected time.Duration
+	}{
+		{"Defaults first attempt", ReconnectPolicy{}, 1, time.Second},
+		{"Defaults doubled", ReconnectPolicy{}, 3, 4 * time.Second},
+		{"Defaults capped", ReconnectPolicy{}, 10, 30 * time.Second},
+		{"Custom initial", ReconnectPolicy{InitialBackoff: 100 * time.Millisecond}, 2, 200 * time.Millisecond},
+		{"Custom cap", ReconnectPolicy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}, 5, 3 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.policy.backoff(tt.attempt); result != tt.expected {
+				t.Errorf("backoff(%d) = %v, expected %v", tt.attempt, result, tt.expected)
+			}
+		})
+	}
+}
+
+// waitForState reads connection events until one with the given state arrives
+func waitForState(t *testing.T, events <-chan ConnectionEvent, state ConnectionState) ConnectionEvent {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("Event channel closed waiting for %v", state)
+			}
+			if event.State == state {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %v", state)
+		}
+	}
+}
+
+func TestReconnectAfterConnectionDrop(t *testing.T) {
+	device := newFakeDevice(t, 0x10)
+
+	radio := Radio{
+		Reconnect: &ReconnectPolicy{
+			InitialBackoff: 10 * time.Millisecond,
+			Dial: func(ctx context.Context) (Transport, error) {
+				return NewTCPTransport(device.listener.Addr().String())
+			},
+		},
+	}
+	events := radio.ConnectionEvents()
+
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	waitForState(t, events, ConnectionConnected)
+
+	sub := radio.Subscribe(PacketFilter{PortNums: []pb.PortNum{pb.PortNum_TEXT_MESSAGE_APP}})
+
+	// The device comes back with a different node number, which the handshake must pick up
+	device.setNodeNum(0x20)
+	device.dropConnections()
+
+	waitForState(t, events, ConnectionDisconnected)
+	if event := waitForState(t, events, ConnectionConnected); event.Attempt < 1 {
+		t.Errorf("Expected a reconnect attempt number, got %d", event.Attempt)
+	}
+
+	if radio.GetNodeID() != 0x20 {
+		t.Errorf("Expected node number 0x20 after reconnect, got 0x%x", radio.GetNodeID())
+	}
+
+	device.push(textPacket(0x99, 0, "after reconnect"))
+
+	select {
+	case frame, ok := <-sub.C:
+		if !ok {
+			t.Fatalf("Subscription closed by reconnect")
+		}
+		if string(frame.GetPacket().GetDecoded().GetPayload()) != "after reconnect" {
+			t.Fatalf("Unexpected frame: %v", frame)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for packet after reconnect")
+	}
+
+	radio.Close()
+	waitForState(t, events, ConnectionClosed)
+	if _, ok := <-sub.C; ok {
+		t.Errorf("Expected subscription to be closed by Close")
+	}
+}
+
+func TestReconnectRequiresDial(t *testing.T) {
+	device := newFakeDevice(t, 0x10)
+
+	radio := Radio{Reconnect: &ReconnectPolicy{}}
+	if err := radio.InitWithTransport(device.dial(t)); err == nil {
+		radio.Close()
+		t.Fatalf("Expected error for reconnect policy without Dial")
+	}
+}
+
+func TestReconnectCountsFailedHandshakes(t *testing.T) {
+	device := newFakeDevice(t, 0x10)
+
+	// Accepts reconnects but hangs up before the handshake can finish
+	flaky, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer flaky.Close()
+	go func() {
+		for {
+			conn, err := flaky.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	radio := Radio{
+		HeartbeatInterval: -1,
+		Reconnect: &ReconnectPolicy{
+			InitialBackoff: 10 * time.Millisecond,
+			MaxAttempts:    3,
+			Dial: func(ctx context.Context) (Transport, error) {
+				return NewTCPTransport(flaky.Addr().String())
+			},
+		},
+	}
+	events := radio.ConnectionEvents()
+
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+	waitForState(t, events, ConnectionConnected)
+
+	device.dropConnections()
+
+	// Every attempt connects, yet the radio gives up after MaxAttempts
+	for want := 1; want <= 3; want++ {
+		if event := waitForState(t, events, ConnectionReconnecting); event.Attempt != want {
+			t.Fatalf("Reconnect attempt = %d, want %d", event.Attempt, want)
+		}
+	}
+	waitForState(t, events, ConnectionClosed)
+}
+
+func TestReconnectGivesUpWithLastError(t *testing.T) {
+	device := newFakeDevice(t, 0x10)
+
+	unplugged := errors.New("device unplugged")
+	radio := Radio{
+		HeartbeatInterval: -1,
+		Reconnect: &ReconnectPolicy{
+			InitialBackoff: 10 * time.Millisecond,
+			MaxAttempts:    2,
+			Dial: func(ctx context.Context) (Transport, error) {
+				return nil, unplugged
+			},
+		},
+	}
+	events := radio.ConnectionEvents()
+
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+	waitForState(t, events, ConnectionConnected)
+
+	device.dropConnections()
+
+	cause := waitForState(t, events, ConnectionDisconnected).Err
+	closed := waitForState(t, events, ConnectionClosed)
+	if !errors.Is(closed.Err, unplugged) {
+		t.Errorf("Expected the last attempt's error, got %v", closed.Err)
+	}
+	if !errors.Is(closed.Err, cause) {
+		t.Errorf("Expected the error that dropped the link (%v), got %v", cause, closed.Err)
+	}
+}
@@ -0,0 +1,197 @@
+package gomesh
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReplayOptions controls NewReplayTransport
+type ReplayOptions struct {
+	// Speed scales the pauses between recorded reads, so 10 plays ten times faster than the
+	// original session. Zero keeps the original timing and a negative value skips the pauses
+	Speed float64
+}
+
+// replayTransport plays a capture back to a Radio. The bytes read from the radio are returned
+// in the original chunks with the original pauses, scaled by the speed. Each recorded write that
+// carries a frame holds playback until the client writes something, so answers are not delivered
+// before the request that caused them. Console writes, such as the commands that switch a serial
+// radio to API mode, are skipped: a replaying radio never sends them. The written bytes
+// themselves are discarded. Once the capture is exhausted reads block until the transport is
+// closed.
+//
+// Requests made with a random nonce or packet id are not matched to the recorded answers, so
+// sessions meant for replay should use fixed nonces such as ConfigOnlyNonce
+type replayTransport struct {
+	records []CaptureRecord
+	speed   float64
+
+	chunks chan []byte
+	writes chan struct{}
+	closed chan struct{}
+	once   sync.Once
+
+	mu            sync.Mutex
+	pending       []byte
+	readDeadline  time.Time
+	deadlineMoved chan struct{}
+}
+
+// NewReplayTransport returns a transport that plays back records captured with a CaptureWriter
+func NewReplayTransport(records []CaptureRecord, opts ReplayOptions) Transport {
+	speed := opts.Speed
+	if speed == 0 {
+		speed = 1
+	}
+
+	r := &replayTransport{
+		records:       records,
+		speed:         speed,
+		chunks:        make(chan []byte),
+		writes:        make(chan struct{}, inboxBuffer),
+		closed:        make(chan struct{}),
+		deadlineMoved: make(chan struct{}),
+	}
+
+	go r.play()
+
+	return r
+}
+
+// OpenReplay loads a capture file and returns a transport playing it back
+func OpenReplay(path string, opts ReplayOptions) (Transport, error) {
+	records, err := LoadCapture(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReplayTransport(records, opts), nil
+}
+
+func (r *replayTransport) play() {
+	var last time.Time
+
+	for _, record := range r.records {
+		if record.Direction == CaptureToRadio {
+			if !bytes.Contains(record.Data, []byte{start1, start2}) {
+				continue
+			}
+			select {
+			case <-r.writes:
+			case <-r.closed:
+				return
+			}
+			// Time spent waiting for the client does not count towards the next pause
+			last = record.Time
+			continue
+		}
+
+		if !last.IsZero() && r.speed > 0 {
+			if pause := time.Duration(float64(record.Time.Sub(last)) / r.speed); pause > 0 {
+				timer := time.NewTimer(pause)
+				select {
+				case <-timer.C:
+				case <-r.closed:
+					timer.Stop()
+					return
+				}
+			}
+		}
+		last = record.Time
+
+		select {
+		case r.chunks <- record.Data:
+		case <-r.closed:
+			return
+		}
+	}
+
+	defaultLogger().Debug("replay capture exhausted")
+}
+
+func (r *replayTransport) Read(p []byte) (int, error) {
+	for {
+		r.mu.Lock()
+		if len(r.pending) > 0 {
+			n := copy(p, r.pending)
+			r.pending = r.pending[n:]
+			r.mu.Unlock()
+			return n, nil
+		}
+		deadline := r.readDeadline
+		moved := r.deadlineMoved
+		r.mu.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+
+		var chunk []byte
+		var err error
+		select {
+		case chunk = <-r.chunks:
+		case <-r.closed:
+			err = net.ErrClosed
+		case <-expired:
+			err = os.ErrDeadlineExceeded
+		case <-moved:
+			// Wait again with the new deadline
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if err != nil {
+			return 0, err
+		}
+		r.mu.Lock()
+		r.pending = chunk
+		r.mu.Unlock()
+	}
+}
+
+// Write releases the next recorded write and discards p
+func (r *replayTransport) Write(p []byte) (int, error) {
+	select {
+	case <-r.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	select {
+	case r.writes <- struct{}{}:
+	default:
+	}
+
+	return len(p), nil
+}
+
+func (r *replayTransport) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
+
+func (r *replayTransport) SetReadDeadline(t time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.readDeadline = t
+	close(r.deadlineMoved)
+	r.deadlineMoved = make(chan struct{})
+
+	return nil
+}
+
+func (r *replayTransport) SetWriteDeadline(t time.Time) error {
+	return nil
+}
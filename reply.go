@@ -0,0 +1,116 @@
+package gomesh
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// maxRecentTexts is the number of text messages a radio remembers so reactions to them can be
+// sent to the right conversation
+const maxRecentTexts = 256
+
+// textConversation is where a text message was sent
+type textConversation struct {
+	from    uint32
+	to      uint32
+	channel uint32
+}
+
+// recentTexts remembers the conversations of the latest text messages sent and received
+type recentTexts struct {
+	mu    sync.Mutex
+	byID  map[uint32]textConversation
+	order []uint32 // Ring of ids, next is the oldest once full
+	next  int
+}
+
+func (t *recentTexts) remember(id uint32, conversation textConversation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.byID == nil {
+		t.byID = make(map[uint32]textConversation)
+	}
+	if _, ok := t.byID[id]; ok {
+		return
+	}
+
+	if len(t.order) < maxRecentTexts {
+		t.order = append(t.order, id)
+	} else {
+		delete(t.byID, t.order[t.next])
+		t.order[t.next] = id
+		t.next = (t.next + 1) % maxRecentTexts
+	}
+	t.byID[id] = conversation
+}
+
+func (t *recentTexts) lookup(id uint32) (textConversation, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conversation, ok := t.byID[id]
+	return conversation, ok
+}
+
+// SendReply sends text as a reply to the message with packet id replyID, the way the official
+// apps thread replies
+func (r *Radio) SendReply(to int64, channel int64, replyID uint32, text string) (*SentPacket, error) {
+	return r.SendReplyContext(context.Background(), to, channel, replyID, text)
+}
+
+// SendReplyContext sends a reply, giving up when ctx is done
+func (r *Radio) SendReplyContext(ctx context.Context, to int64, channel int64, replyID uint32, text string) (*SentPacket, error) {
+	return r.sendText(ctx, &pb.Data{Payload: []byte(text), ReplyId: replyID}, to, channel)
+}
+
+// SendReaction sends emoji as a tapback on the message with the given packet id. The reaction
+// goes to the same conversation: back to the sender of a direct message, or to the channel of a
+// broadcast. The message must be one of the last few hundred this radio sent or received
+func (r *Radio) SendReaction(packetID uint32, emoji string) (*SentPacket, error) {
+	return r.SendReactionContext(context.Background(), packetID, emoji)
+}
+
+// SendReactionContext sends a reaction, giving up when ctx is done
+func (r *Radio) SendReactionContext(ctx context.Context, packetID uint32, emoji string) (*SentPacket, error) {
+	conversation, ok := r.texts.lookup(packetID)
+	if !ok {
+		return nil, fmt.Errorf("message %d not seen recently, cannot tell where to send the reaction", packetID)
+	}
+
+	to := conversation.from
+	switch {
+	case conversation.to == broadcastNum:
+		to = broadcastNum
+	case conversation.from == r.GetNodeID():
+		to = conversation.to
+	}
+
+	return r.sendText(ctx, &pb.Data{Payload: []byte(emoji), ReplyId: packetID, Emoji: 1}, int64(to), int64(conversation.channel))
+}
+
+// ParsePacket parses a text message packet. Replies and reactions sent with the native ReplyId
+// and Emoji fields have the "native" format and a numeric Metadata.ReplyID; other packets fall
+// back to ParseMessage and its legacy text formats
+func ParsePacket(packet *pb.MeshPacket) *ParsedMessage {
+	decoded := packet.GetDecoded()
+	text := string(decoded.GetPayload())
+
+	replyID := decoded.GetReplyId()
+	if replyID == 0 {
+		return ParseMessage(text)
+	}
+
+	metadata := &MessageMetadata{ReplyTo: strconv.FormatUint(uint64(replyID), 10), ReplyID: replyID, Type: "reply"}
+	if decoded.GetEmoji() != 0 {
+		metadata.Type = "reaction"
+		metadata.Reaction = text
+		return &ParsedMessage{Metadata: metadata, Format: "native"}
+	}
+
+	return &ParsedMessage{Text: text, Metadata: metadata, Format: "native"}
+}
@@ -0,0 +1,128 @@
+package gomesh
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+func TestParsePacket(t *testing.T) {
+	packet := func(text string, replyID uint32, emoji uint32) *pb.MeshPacket {
+		return &pb.MeshPacket{PayloadVariant: &pb.MeshPacket_Decoded{Decoded: &pb.Data{
+			Portnum: pb.PortNum_TEXT_MESSAGE_APP,
+			Payload: []byte(text),
+			ReplyId: replyID,
+			Emoji:   emoji,
+		}}}
+	}
+
+	tests := []struct {
+		name     string
+		packet   *pb.MeshPacket
+		format   string
+		display  string
+		reply    bool
+		reaction bool
+		replyID  uint32
+		replyTo  string
+	}{
+		{"native reply", packet("sounds good", 42, 0), "native", "sounds good", true, false, 42, "42"},
+		{"native reaction", packet("👍", 42, 1), "native", "", false, true, 42, "42"},
+		{"legacy reply", packet(FormatReplyMessage("msg_1", "Hello", "Alice", "Hi"), 0, 0), "enhanced", "Hi", true, false, 0, "msg_1"},
+		{"legacy reaction", packet("👍::msg_1", 0, 0), "simple", "", false, true, 0, "msg_1"},
+		{"plain", packet("hello", 0, 0), "plain", "hello", false, false, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := ParsePacket(tt.packet)
+
+			if parsed.Format != tt.format || GetDisplayText(parsed) != tt.display {
+				t.Errorf("Format, display = %q, %q, want %q, %q", parsed.Format, GetDisplayText(parsed), tt.format, tt.display)
+			}
+			if IsReply(parsed) != tt.reply || IsReaction(parsed) != tt.reaction {
+				t.Errorf("IsReply, IsReaction = %t, %t, want %t, %t", IsReply(parsed), IsReaction(parsed), tt.reply, tt.reaction)
+			}
+			if parsed.Metadata != nil && (parsed.Metadata.ReplyID != tt.replyID || parsed.Metadata.ReplyTo != tt.replyTo) {
+				t.Errorf("ReplyID, ReplyTo = %d, %q, want %d, %q", parsed.Metadata.ReplyID, parsed.Metadata.ReplyTo, tt.replyID, tt.replyTo)
+			}
+			if tt.reaction {
+				if _, emoji, _ := ExtractReactionMetadata(parsed); emoji != "👍" {
+					t.Errorf("Reaction emoji = %q, want 👍", emoji)
+				}
+			}
+		})
+	}
+}
+
+func TestSendReplyAndReaction(t *testing.T) {
+	const self, other = 0x1234, 0x5678
+
+	device := newFakeDevice(t, self)
+	radio := &Radio{HeartbeatInterval: -1}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	// A direct message and a broadcast on channel 2 from another node
+	direct := textPacket(other, 0, "ping")
+	direct.GetPacket().Id, direct.GetPacket().To = 100, self
+	broadcast := textPacket(other, 2, "anyone?")
+	broadcast.GetPacket().Id, broadcast.GetPacket().To = 101, broadcastNum
+	device.push(direct)
+	device.push(broadcast)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := radio.texts.lookup(101); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the messages to be received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sent, err := radio.SendReply(other, 1, 100, "pong")
+	if err != nil {
+		t.Fatalf("SendReply: %v", err)
+	}
+	waitForToRadio(t, device, func(toRadio *pb.ToRadio) bool {
+		packet := toRadio.GetPacket()
+		return packet.GetId() == sent.ID && packet.GetTo() == other && packet.GetChannel() == 1 &&
+			packet.GetDecoded().GetReplyId() == 100 && packet.GetDecoded().GetEmoji() == 0 &&
+			string(packet.GetDecoded().GetPayload()) == "pong"
+	})
+
+	tests := []struct {
+		name    string
+		id      uint32
+		to      uint32
+		channel uint32
+	}{
+		{"direct message", 100, other, 0},
+		{"broadcast", 101, broadcastNum, 2},
+		{"own message", sent.ID, other, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reaction, err := radio.SendReaction(tt.id, "❤️")
+			if err != nil {
+				t.Fatalf("SendReaction: %v", err)
+			}
+			waitForToRadio(t, device, func(toRadio *pb.ToRadio) bool {
+				packet := toRadio.GetPacket()
+				return packet.GetId() == reaction.ID && packet.GetTo() == tt.to && packet.GetChannel() == tt.channel &&
+					packet.GetDecoded().GetReplyId() == tt.id && packet.GetDecoded().GetEmoji() == 1 &&
+					string(packet.GetDecoded().GetPayload()) == "❤️"
+			})
+		})
+	}
+
+	if _, err := radio.SendReaction(999, "👍"); err == nil {
+		t.Error("SendReaction to an unknown message succeeded")
+	}
+}
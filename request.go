@@ -0,0 +1,149 @@
+package gomesh
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// requestTimeout bounds a request whose context has no deadline
+const requestTimeout = 30 * time.Second
+
+// pendingBuffer is the number of packets queued for a request waiting on its answer
+const pendingBuffer = 4
+
+// newPacketID returns a random non-zero id for an outgoing mesh packet
+func newPacketID() uint32 {
+	for {
+		if id := rand.Uint32(); id != 0 {
+			return id
+		}
+	}
+}
+
+// addPending registers a waiter for packets answering the request with the given id
+func (r *Radio) addPending(id uint32) (chan *pb.MeshPacket, error) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	if r.pending == nil {
+		return nil, ErrNotConnected
+	}
+
+	ch := make(chan *pb.MeshPacket, pendingBuffer)
+	r.pending[id] = ch
+
+	return ch, nil
+}
+
+func (r *Radio) removePending(id uint32) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	delete(r.pending, id)
+}
+
+// deliverPending hands a packet carrying a request id to the request waiting on it, if any.
+// The caller holds subsMu
+func (r *Radio) deliverPending(fromRadio *pb.FromRadio) {
+	requestID := fromRadio.GetPacket().GetDecoded().GetRequestId()
+	if requestID == 0 {
+		return
+	}
+
+	if ch, ok := r.pending[requestID]; ok {
+		offer(ch, fromRadio.GetPacket())
+	}
+}
+
+// requestContext sends packet and waits for the packet on responsePort whose request id
+// matches. A routing error for the request ends the wait early
+func (r *Radio) requestContext(ctx context.Context, packet *pb.MeshPacket, responsePort pb.PortNum) (*pb.MeshPacket, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+
+	if packet.Id == 0 {
+		packet.Id = newPacketID()
+	}
+
+	responses, err := r.addPending(packet.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer r.removePending(packet.Id)
+
+	out, err := proto.Marshal(&pb.ToRadio{PayloadVariant: &pb.ToRadio_Packet{Packet: packet}})
+	if err != nil {
+		return nil, err
+	}
+
+	r.log().Debug("sending request", packetAttrs(packet, "response_portnum", responsePort.String())...)
+	if err := r.sendPacket(ctx, out); err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case response := <-responses:
+			decoded := response.GetDecoded()
+			if decoded.GetPortnum() == responsePort {
+				return response, nil
+			}
+			if decoded.GetPortnum() == pb.PortNum_ROUTING_APP {
+				routing := &pb.Routing{}
+				if err := proto.Unmarshal(decoded.GetPayload(), routing); err == nil {
+					if err := routingError(packet.Id, routing); err != nil {
+						return nil, err
+					}
+				}
+			}
+		case <-ctx.Done():
+			return nil, contextError(ctx)
+		}
+	}
+}
+
+// AdminRequest sends an admin message to the connected radio and returns its answer
+func (r *Radio) AdminRequest(admin *pb.AdminMessage) (*pb.AdminMessage, error) {
+	return r.AdminRequestContext(context.Background(), admin)
+}
+
+// AdminRequestContext sends an admin message that expects an answer, such as
+// GetOwnerRequest or GetConfigRequest, and waits for the response to that particular message.
+// Without a deadline on ctx it gives up after thirty seconds
+func (r *Radio) AdminRequestContext(ctx context.Context, admin *pb.AdminMessage) (*pb.AdminMessage, error) {
+	payload, err := proto.Marshal(admin)
+	if err != nil {
+		return nil, err
+	}
+
+	packet := &pb.MeshPacket{
+		To:      r.GetNodeID(),
+		WantAck: true,
+		PayloadVariant: &pb.MeshPacket_Decoded{
+			Decoded: &pb.Data{
+				Payload:      payload,
+				Portnum:      pb.PortNum_ADMIN_APP,
+				WantResponse: true,
+			},
+		},
+	}
+
+	response, err := r.requestContext(ctx, packet, pb.PortNum_ADMIN_APP)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := &pb.AdminMessage{}
+	if err := proto.Unmarshal(response.GetDecoded().GetPayload(), answer); err != nil {
+		return nil, err
+	}
+
+	return answer, nil
+}
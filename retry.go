@@ -0,0 +1,113 @@
+package gomesh
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// RetryPolicy resends direct messages the mesh could not deliver when set on Radio.Retry before
+// Init. The firmware already retransmits a few times on the link; once it reports
+// MAX_RETRANSMIT, NO_RESPONSE or TIMEOUT for a packet the policy waits with exponential backoff
+// and sends the message again under a new packet id. The SentPacket handle follows every
+// attempt. Broadcasts and other routing errors are never retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a message is sent, including the first. Defaults to three
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first retry, doubled after every failure. Defaults to ten seconds
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait between attempts. Defaults to two minutes
+	MaxBackoff time.Duration
+
+	// GiveUp, if set, is called on its own goroutine once the last attempt has failed
+	GiveUp func(sent *SentPacket, err error)
+}
+
+func (p RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	return exponentialBackoff(attempt, p.InitialBackoff, 10*time.Second, p.MaxBackoff, 2*time.Minute)
+}
+
+// retryable reports whether another attempt might deliver a packet that failed with err
+func retryable(err error) bool {
+	var routingErr *RoutingError
+	if !errors.As(err, &routingErr) {
+		return false
+	}
+
+	switch routingErr.Reason {
+	case pb.Routing_MAX_RETRANSMIT, pb.Routing_NO_RESPONSE, pb.Routing_TIMEOUT:
+		return true
+	}
+	return false
+}
+
+// retryDelivery schedules another attempt at a packet whose last attempt failed with err, and
+// reports whether it did. The caller holds subsMu
+func (r *Radio) retryDelivery(sent *SentPacket, err error) bool {
+	policy := r.Retry
+	if policy == nil || sent.To == broadcastNum || !retryable(err) {
+		return false
+	}
+
+	attempt := sent.Attempts()
+	if attempt >= policy.maxAttempts() {
+		if policy.GiveUp != nil {
+			go func() {
+				<-sent.done
+				policy.GiveUp(sent, err)
+			}()
+		}
+		return false
+	}
+
+	// The packet stays tracked under the failed id while it waits, so a late ack still counts
+	// and Close still fails it
+	failedID := sent.attemptID
+	sent.timer.Stop()
+	sent.timer = time.AfterFunc(policy.backoff(attempt), func() {
+		r.resend(sent, failedID)
+	})
+
+	r.publishDelivery(sent, attempt, DeliveryRetrying, err)
+	r.log().Info("retrying packet", "packet_id", sent.ID, "to", sent.To, "attempt", attempt, "err", err)
+
+	return true
+}
+
+// resend sends the next attempt at a packet once its backoff has passed
+func (r *Radio) resend(sent *SentPacket, failedID uint32) {
+	r.subsMu.Lock()
+	if r.sent[failedID] != sent {
+		// Acked late, or failed when the radio closed
+		r.subsMu.Unlock()
+		return
+	}
+	delete(r.sent, failedID)
+
+	packet := proto.Clone(sent.packet).(*pb.MeshPacket)
+	packet.Id = newPacketID()
+	r.startAttempt(sent, packet.Id)
+	r.subsMu.Unlock()
+
+	// Reactions to the new id go to the same conversation
+	r.texts.remember(packet.Id, textConversation{from: r.GetNodeID(), to: packet.To, channel: packet.Channel})
+
+	out, err := proto.Marshal(&pb.ToRadio{PayloadVariant: &pb.ToRadio_Packet{Packet: packet}})
+	if err == nil {
+		err = r.sendPacket(r.closeCtx, out)
+	}
+	if err != nil {
+		r.failDelivery(sent, err)
+	}
+}
@@ -0,0 +1,131 @@
+package gomesh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+// nextDelivery returns the next delivery event, failing the test unless it has the given state
+func nextDelivery(t *testing.T, events <-chan DeliveryEvent, state DeliveryState) DeliveryEvent {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		if event.State != state {
+			t.Fatalf("Delivery event = %+v, want %s", event, state)
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for a %s delivery event", state)
+	}
+	return DeliveryEvent{}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	const self, other = 0x1234, 0x5678
+
+	tests := []struct {
+		name     string
+		to       int64
+		reasons  []pb.Routing_Error // The mesh's answer to each attempt, NONE is an ack from other
+		relayed  bool               // A relay is heard before each answer
+		state    DeliveryState
+		attempts int
+		gaveUp   bool
+	}{
+		{"delivered on retry", other, []pb.Routing_Error{pb.Routing_MAX_RETRANSMIT, pb.Routing_NO_RESPONSE, pb.Routing_NONE}, false, DeliveryAcked, 3, false},
+		{"relayed but not delivered", other, []pb.Routing_Error{pb.Routing_MAX_RETRANSMIT, pb.Routing_NONE}, true, DeliveryAcked, 2, false},
+		{"gives up", other, []pb.Routing_Error{pb.Routing_MAX_RETRANSMIT, pb.Routing_TIMEOUT, pb.Routing_MAX_RETRANSMIT}, false, DeliveryFailed, 3, true},
+		{"not retryable", other, []pb.Routing_Error{pb.Routing_NO_ROUTE}, false, DeliveryFailed, 1, false},
+		{"broadcast", 0, []pb.Routing_Error{pb.Routing_MAX_RETRANSMIT}, false, DeliveryFailed, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gaveUp := make(chan error, 1)
+
+			device := newFakeDevice(t, self)
+			radio := &Radio{
+				HeartbeatInterval: -1,
+				Retry: &RetryPolicy{
+					InitialBackoff: 10 * time.Millisecond,
+					GiveUp:         func(sent *SentPacket, err error) { gaveUp <- err },
+				},
+			}
+			if err := radio.InitWithTransport(device.dial(t)); err != nil {
+				t.Fatalf("Error initializing radio: %v", err)
+			}
+			defer radio.Close()
+
+			events := radio.DeliveryEvents()
+			sent, err := radio.SendTextMessage("are you there", tt.to, 0)
+			if err != nil {
+				t.Fatalf("Error sending: %v", err)
+			}
+
+			ids := make(map[uint32]bool)
+			for i, reason := range tt.reasons {
+				event := nextDelivery(t, events, DeliveryPending)
+				if event.PacketID != sent.ID || event.Attempt != i+1 || ids[event.AttemptID] {
+					t.Fatalf("Attempt %d event = %+v, want a new id for packet %d", i+1, event, sent.ID)
+				}
+				ids[event.AttemptID] = true
+				waitForToRadio(t, device, func(toRadio *pb.ToRadio) bool {
+					return toRadio.GetPacket().GetId() == event.AttemptID
+				})
+
+				// Reactions to any attempt go to the same conversation
+				if conversation, ok := radio.texts.lookup(event.AttemptID); !ok || conversation.to != event.To {
+					t.Errorf("Attempt %d conversation = %+v, %t, want one to %d", i+1, conversation, ok, event.To)
+				}
+
+				if tt.relayed {
+					relay := routingAnswer(t, event.AttemptID, pb.Routing_NONE)
+					relay.GetPacket().From = self
+					device.push(relay)
+					nextDelivery(t, events, DeliveryImplicitAck)
+				}
+
+				answer := routingAnswer(t, event.AttemptID, reason)
+				answer.GetPacket().From = self
+				if reason == pb.Routing_NONE {
+					answer.GetPacket().From = other
+				}
+				device.push(answer)
+
+				if i < len(tt.reasons)-1 {
+					nextDelivery(t, events, DeliveryRetrying)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			state, err := sent.Wait(ctx)
+			if state != tt.state || sent.Attempts() != tt.attempts {
+				t.Errorf("Wait = %s after %d attempts, want %s after %d", state, sent.Attempts(), tt.state, tt.attempts)
+			}
+			last := tt.reasons[len(tt.reasons)-1]
+			var routingErr *RoutingError
+			if last != pb.Routing_NONE && (!errors.As(err, &routingErr) || routingErr.Reason != last) {
+				t.Errorf("Wait error = %v, want the last attempt's %s", err, last)
+			}
+
+			select {
+			case err := <-gaveUp:
+				if !tt.gaveUp {
+					t.Errorf("GiveUp called with %v", err)
+				} else if !errors.As(err, &routingErr) || routingErr.Reason != last {
+					t.Errorf("GiveUp error = %v, want %s", err, last)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.gaveUp {
+					t.Error("GiveUp not called")
+				}
+			}
+		})
+	}
+}
@@ -1,92 +1,82 @@
 package gomesh
 
 import (
-	"io"
-	"net"
+	"context"
+	"errors"
+	"fmt"
+	"os"
 	"time"
-
-	"github.com/jacobsa/go-serial/serial"
 )
 
+// streamer wraps the Transport used by a Radio and applies the read and write deadlines
+// used by the request/response helpers
 type streamer struct {
-	serialPort io.ReadWriteCloser
-	netPort    net.Conn
-	isTCP      bool
+	transport Transport
 }
 
+// Init opens a transport for addr, a connection URI as accepted by ParseConnectionURI
 func (s *streamer) Init(addr string) error {
 
-	ip := net.ParseIP(addr)
-
-	if ip != nil {
-		tcpAddr := net.TCPAddr{IP: ip, Port: 4403}
-		conn, err := net.DialTCP("tcp", nil, &tcpAddr)
-		if err != nil {
-			return err
-		}
-		s.netPort = conn
-		s.isTCP = true
-
-	} else {
-		//Configure the serial port
-		options := serial.OpenOptions{
-			PortName:              addr,
-			BaudRate:              115200,
-			DataBits:              8,
-			StopBits:              1,
-			MinimumReadSize:       0,
-			InterCharacterTimeout: 100,
-			ParityMode:            serial.PARITY_NONE,
-		}
-
-		// Open the port.
-		port, err := serial.Open(options)
-		if err != nil {
-			return err
-		}
-
-		s.serialPort = port
-		s.isTCP = false
-
-		return nil
+	transport, err := OpenTransport(addr)
+	if err != nil {
+		return err
 	}
 
+	s.transport = transport
+
 	return nil
 }
 
-func (s *streamer) Write(p []byte) error {
+// Write sends p to the radio. The write gives up after a second, or earlier if ctx is done
+func (s *streamer) Write(ctx context.Context, p []byte) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+
+	s.transport.SetWriteDeadline(deadline(ctx, 1*time.Second))
+	stop := context.AfterFunc(ctx, func() {
+		s.transport.SetWriteDeadline(time.Unix(1, 0))
+	})
+	defer stop()
 
-	if s.isTCP {
-		s.netPort.SetReadDeadline(time.Now().Add(1 * time.Second))
-		_, err := s.netPort.Write(p)
-		if err != nil {
-			return err
+	_, err := s.transport.Write(p)
+	if err != nil {
+		if ctx.Err() != nil {
+			return contextError(ctx)
 		}
-	} else {
-		_, err := s.serialPort.Write(p)
-		if err != nil {
-			return err
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("%w: %w", ErrTimeout, err)
 		}
-
-		time.Sleep(100 * time.Millisecond)
+		return linkError(err)
 	}
 
 	return nil
 }
 
-func (s *streamer) Read(p []byte) error {
+// Read reads whatever the radio has sent into p. The read gives up after two seconds, or
+// earlier if ctx is done
+func (s *streamer) Read(ctx context.Context, p []byte) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+
+	s.transport.SetReadDeadline(deadline(ctx, 2*time.Second))
+	stop := context.AfterFunc(ctx, func() {
+		s.transport.SetReadDeadline(time.Unix(1, 0))
+	})
+	defer stop()
 
-	if s.isTCP {
-		s.netPort.SetReadDeadline(time.Now().Add(2 * time.Second))
-		_, err := s.netPort.Read(p)
-		if err != nil {
-			return err
-		}
-	} else {
-		_, err := s.serialPort.Read(p)
-		if err != nil {
-			return err
+	n, err := s.transport.Read(p)
+	if err != nil {
+		if ctx.Err() != nil {
+			return contextError(ctx)
 		}
+		return linkError(err)
+	}
+
+	// An idle serial port returns nothing rather than blocking until the deadline
+	if n == 0 && len(p) > 0 {
+		return os.ErrDeadlineExceeded
 	}
 
 	return nil
@@ -94,9 +84,7 @@ func (s *streamer) Read(p []byte) error {
 }
 
 func (s *streamer) Close() {
-	if s.isTCP {
-		s.netPort.Close()
-	} else {
-		s.serialPort.Close()
+	if s.transport != nil {
+		s.transport.Close()
 	}
 }
@@ -111,6 +111,11 @@ func TestExtractTextFromBytes(t *testing.T) {
 			input:    []byte("Valid text\x00\x01\r\nAnother line\x1b[34m"),
 			expected: nil, // Changed: no debug patterns, so not treated as text
 		},
+		{
+			name:     "Text alongside debug output is kept",
+			input:    []byte("Booting firmware\r\nINFO | 12:23:47 [Router] Started\r\n"),
+			expected: []string{"Booting firmware", "INFO | 12:23:47 [Router] Started"},
+		},
 		{
 			name:     "SerialConsole pattern",
 			input:    []byte("Some data [SerialConsole] message here\r\n"),
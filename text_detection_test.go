@@ -36,6 +36,16 @@ func TestIsTextData(t *testing.T) {
 			input:    "deadbeefcafebabe",
 			expected: false,
 		},
+		{
+			name:     "Text message packet with a time of day",
+			input:    "12280d78560000153412000035cdab341222170801121373656520796f752061742031323a33303a3030",
+			expected: false,
+		},
+		{
+			name:     "Log line with line noise",
+			input:    "494e464f20207c2031323a32323a34372000ff01",
+			expected: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,99 @@
+package gomesh
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+)
+
+// defaultTCPPort is the port the Meshtastic firmware serves its stream API on
+const defaultTCPPort = 4403
+
+// defaultBaudRate is the baud rate used by Meshtastic firmware on its serial console
+const defaultBaudRate = 115200
+
+// Transport is the byte stream a Radio uses to talk to a device. Any link that can carry the
+// Meshtastic stream protocol (serial, TCP, pipes, in-memory fakes, tunnels) can be used by
+// implementing this interface and passing it to Radio.InitWithTransport.
+//
+// Implementations that cannot enforce deadlines may treat the deadline setters as no-ops.
+type Transport interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// NewTCPTransport connects to the stream API of a radio at addr, which must be in host:port form
+func NewTCPTransport(addr string) (Transport, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// NewSerialTransport opens the serial port at portName with the given baud rate
+func NewSerialTransport(portName string, baudRate uint) (Transport, error) {
+	options := serial.OpenOptions{
+		PortName:              portName,
+		BaudRate:              baudRate,
+		DataBits:              8,
+		StopBits:              1,
+		MinimumReadSize:       0,
+		InterCharacterTimeout: 100,
+		ParityMode:            serial.PARITY_NONE,
+	}
+
+	port, err := serial.Open(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serialTransport{port: port}, nil
+}
+
+// serialTransport adapts a go-serial port to the Transport interface
+type serialTransport struct {
+	port io.ReadWriteCloser
+}
+
+// Read returns (0, nil) when the port has been idle for the inter-character timeout. The
+// underlying file reports that as io.EOF, which is reserved here for a port that is gone
+func (s *serialTransport) Read(p []byte) (int, error) {
+	n, err := s.port.Read(p)
+	if n == 0 && err == io.EOF {
+		return 0, nil
+	}
+
+	return n, err
+}
+
+func (s *serialTransport) Write(p []byte) (int, error) {
+	n, err := s.port.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	// Give the radio time to drain its UART buffer before the next write
+	time.Sleep(100 * time.Millisecond)
+
+	return n, nil
+}
+
+func (s *serialTransport) Close() error {
+	return s.port.Close()
+}
+
+// SetReadDeadline is a no-op: go-serial has no deadline support, reads instead return
+// empty after the inter-character timeout configured when the port is opened
+func (s *serialTransport) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is a no-op for serial ports
+func (s *serialTransport) SetWriteDeadline(t time.Time) error {
+	return nil
+}
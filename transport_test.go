@@ -0,0 +1,236 @@
+package gomesh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeDevice is a minimal stand-in for radio firmware used by the unit tests. It answers
+// WantConfigId with a MyInfo packet, the frames set with setDump and the matching
+// ConfigCompleteId, answers GetOwnerRequest admin messages and records every ToRadio it receives
+type fakeDevice struct {
+	listener net.Listener
+	received chan *pb.ToRadio
+
+	mu      sync.Mutex
+	nodeNum uint32
+	dump    []*pb.FromRadio
+	conns   []net.Conn
+}
+
+func newFakeDevice(t *testing.T, nodeNum uint32) *fakeDevice {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+
+	d := &fakeDevice{
+		nodeNum:  nodeNum,
+		listener: listener,
+		received: make(chan *pb.ToRadio, 100),
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go d.serve()
+
+	return d
+}
+
+// dial connects a new transport to the fake device
+func (d *fakeDevice) dial(t *testing.T) Transport {
+	t.Helper()
+
+	transport, err := NewTCPTransport(d.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing fake device: %v", err)
+	}
+
+	return transport
+}
+
+func (d *fakeDevice) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+// push sends a frame to every connected client
+func (d *fakeDevice) push(fromRadio *pb.FromRadio) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, conn := range d.conns {
+		d.send(conn, fromRadio)
+	}
+}
+
+// pushText writes console output, outside of any frame, to every connected client
+func (d *fakeDevice) pushText(text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, conn := range d.conns {
+		conn.Write([]byte(text))
+	}
+}
+
+// setNodeNum changes the node number reported to later handshakes
+func (d *fakeDevice) setNodeNum(nodeNum uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nodeNum = nodeNum
+}
+
+// setDump sets the frames sent between MyInfo and ConfigCompleteId in answer to WantConfigId
+func (d *fakeDevice) setDump(frames []*pb.FromRadio) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dump = frames
+}
+
+// dropConnections closes every client connection, as if the device had rebooted
+func (d *fakeDevice) dropConnections() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, conn := range d.conns {
+		conn.Close()
+	}
+	d.conns = nil
+}
+
+func (d *fakeDevice) handle(conn net.Conn) {
+	defer conn.Close()
+
+	d.mu.Lock()
+	d.conns = append(d.conns, conn)
+	d.mu.Unlock()
+
+	header := make([]byte, headerLen)
+	for {
+		if _, err := io.ReadFull(conn, header[:1]); err != nil {
+			return
+		}
+		if header[0] != start1 {
+			continue
+		}
+		if _, err := io.ReadFull(conn, header[1:]); err != nil {
+			return
+		}
+		if header[1] != start2 {
+			continue
+		}
+
+		payload := make([]byte, int(header[2])<<8|int(header[3]))
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+
+		toRadio := &pb.ToRadio{}
+		if err := proto.Unmarshal(payload, toRadio); err != nil {
+			continue
+		}
+		d.received <- toRadio
+
+		if want, ok := toRadio.GetPayloadVariant().(*pb.ToRadio_WantConfigId); ok {
+			d.mu.Lock()
+			nodeNum := d.nodeNum
+			dump := d.dump
+			d.mu.Unlock()
+
+			d.send(conn, &pb.FromRadio{PayloadVariant: &pb.FromRadio_MyInfo{MyInfo: &pb.MyNodeInfo{MyNodeNum: nodeNum}}})
+			for _, fromRadio := range dump {
+				d.send(conn, fromRadio)
+			}
+			d.send(conn, &pb.FromRadio{PayloadVariant: &pb.FromRadio_ConfigCompleteId{ConfigCompleteId: want.WantConfigId}})
+		}
+
+		if packet := toRadio.GetPacket(); packet.GetDecoded().GetPortnum() == pb.PortNum_ADMIN_APP {
+			d.answerAdmin(conn, packet)
+		}
+	}
+}
+
+// answerAdmin replies to GetOwnerRequest with an owner named after the request's packet id,
+// so tests can tell which answer belongs to which request
+func (d *fakeDevice) answerAdmin(conn net.Conn, packet *pb.MeshPacket) {
+	admin := &pb.AdminMessage{}
+	if err := proto.Unmarshal(packet.GetDecoded().GetPayload(), admin); err != nil || !admin.GetGetOwnerRequest() {
+		return
+	}
+
+	answer, err := proto.Marshal(&pb.AdminMessage{PayloadVariant: &pb.AdminMessage_GetOwnerResponse{
+		GetOwnerResponse: &pb.User{LongName: fmt.Sprintf("owner-%d", packet.Id)},
+	}})
+	if err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	nodeNum := d.nodeNum
+	d.mu.Unlock()
+
+	d.send(conn, &pb.FromRadio{PayloadVariant: &pb.FromRadio_Packet{Packet: &pb.MeshPacket{
+		From: nodeNum,
+		To:   nodeNum,
+		Id:   newPacketID(),
+		PayloadVariant: &pb.MeshPacket_Decoded{Decoded: &pb.Data{
+			Portnum:   pb.PortNum_ADMIN_APP,
+			Payload:   answer,
+			RequestId: packet.Id,
+		}},
+	}}})
+}
+
+func (d *fakeDevice) send(conn net.Conn, fromRadio *pb.FromRadio) {
+	out, err := proto.Marshal(fromRadio)
+	if err != nil {
+		return
+	}
+	conn.Write(append([]byte{start1, start2, byte(len(out) >> 8), byte(len(out))}, out...))
+}
+
+func TestInitWithTransport(t *testing.T) {
+	device := newFakeDevice(t, 0x1234abcd)
+
+	radio := Radio{}
+	if err := radio.InitWithTransport(device.dial(t)); err != nil {
+		t.Fatalf("Error initializing radio: %v", err)
+	}
+	defer radio.Close()
+
+	if radio.GetNodeID() != 0x1234abcd {
+		t.Fatalf("Expected node number 0x1234abcd, got 0x%x", radio.GetNodeID())
+	}
+
+	// The radio should have spoken protobuf straight away rather than console commands
+	select {
+	case toRadio := <-device.received:
+		if toRadio.GetWantConfigId() == 0 {
+			t.Fatalf("Expected WantConfigId as first packet, got %v", toRadio)
+		}
+	default:
+		t.Fatalf("Fake device received nothing")
+	}
+}
+
+func TestInitWithNilTransport(t *testing.T) {
+	radio := Radio{}
+	if err := radio.InitWithTransport(nil); err == nil {
+		t.Fatalf("Expected error for nil transport")
+	}
+}
@@ -0,0 +1,298 @@
+package gomesh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConnectionURI describes how to reach a radio. It is parsed from strings such as
+//
+//	tcp://node.local:4403
+//	tcp://[fe80::1]:4403
+//	serial:///dev/ttyACM0?baud=921600
+//	serial://COM3
+//	file://capture.bin
+//	replay://session.jsonl?speed=10
+//	http://meshtastic.local
+//	https://192.168.1.20?insecure=true&poll=250ms
+//
+// For compatibility a bare IP address means TCP on the default port and any other bare
+// string is the name of a serial port at the default baud rate.
+type ConnectionURI struct {
+	Scheme   string  // "tcp", "serial", "file", "replay", "http" or "https"
+	Address  string  // host:port for tcp, the port name for serial, the path for file and replay, the base URL for http
+	BaudRate uint    // Serial only
+	Speed    float64 // Replay only, zero for the original speed
+
+	PollInterval time.Duration // HTTP only, zero for the default
+	Insecure     bool          // HTTPS only, accept self-signed certificates
+}
+
+// ParseConnectionURI parses and validates a radio address
+func ParseConnectionURI(s string) (ConnectionURI, error) {
+	if s == "" {
+		return ConnectionURI{}, errors.New("empty connection address")
+	}
+
+	if !strings.Contains(s, "://") {
+		if ip := net.ParseIP(s); ip != nil {
+			return ConnectionURI{Scheme: "tcp", Address: net.JoinHostPort(ip.String(), strconv.Itoa(defaultTCPPort))}, nil
+		}
+		return ConnectionURI{Scheme: "serial", Address: s, BaudRate: defaultBaudRate}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: %w", s, err)
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		return parseTCPURI(s, u)
+	case "serial":
+		return parseSerialURI(s, u)
+	case "http", "https":
+		return parseHTTPURI(s, u)
+	case "file":
+		if err := checkQuery(s, u); err != nil {
+			return ConnectionURI{}, err
+		}
+		// file://capture.bin puts the name in the host, file:///tmp/capture.bin in the path
+		path := u.Host + u.Path
+		if path == "" {
+			return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: missing file path", s)
+		}
+		return ConnectionURI{Scheme: "file", Address: path}, nil
+	case "replay":
+		return parseReplayURI(s, u)
+	}
+
+	return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: unsupported scheme %q", s, u.Scheme)
+}
+
+func parseTCPURI(s string, u *url.URL) (ConnectionURI, error) {
+	if err := checkQuery(s, u); err != nil {
+		return ConnectionURI{}, err
+	}
+	if u.Path != "" && u.Path != "/" {
+		return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: unexpected path %q", s, u.Path)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: missing host", s)
+	}
+
+	port := defaultTCPPort
+	if u.Port() != "" {
+		p, err := strconv.Atoi(u.Port())
+		if err != nil || p < 1 || p > 65535 {
+			return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: bad port %q", s, u.Port())
+		}
+		port = p
+	}
+
+	return ConnectionURI{Scheme: "tcp", Address: net.JoinHostPort(host, strconv.Itoa(port))}, nil
+}
+
+func parseSerialURI(s string, u *url.URL) (ConnectionURI, error) {
+	// serial:///dev/ttyACM0 puts the device in the path, serial://COM3 in the host
+	name := u.Host + u.Path
+	if name == "" {
+		return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: missing port name", s)
+	}
+
+	baud := uint(defaultBaudRate)
+	for key, values := range u.Query() {
+		if key != "baud" {
+			return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: unknown parameter %q", s, key)
+		}
+		b, err := strconv.ParseUint(values[len(values)-1], 10, 32)
+		if err != nil || b == 0 {
+			return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: bad baud rate %q", s, values[len(values)-1])
+		}
+		baud = uint(b)
+	}
+
+	return ConnectionURI{Scheme: "serial", Address: name, BaudRate: baud}, nil
+}
+
+func parseReplayURI(s string, u *url.URL) (ConnectionURI, error) {
+	// replay://session.jsonl puts the name in the host, replay:///tmp/session.jsonl in the path
+	path := u.Host + u.Path
+	if path == "" {
+		return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: missing file path", s)
+	}
+
+	uri := ConnectionURI{Scheme: "replay", Address: path}
+	for key, values := range u.Query() {
+		if key != "speed" {
+			return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: unknown parameter %q", s, key)
+		}
+		speed, err := strconv.ParseFloat(values[len(values)-1], 64)
+		if err != nil || math.IsNaN(speed) || math.IsInf(speed, 0) {
+			return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: bad speed %q", s, values[len(values)-1])
+		}
+		uri.Speed = speed
+	}
+
+	return uri, nil
+}
+
+func parseHTTPURI(s string, u *url.URL) (ConnectionURI, error) {
+	if u.Hostname() == "" {
+		return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: missing host", s)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: unexpected path %q", s, u.Path)
+	}
+
+	uri := ConnectionURI{Scheme: u.Scheme, Address: u.Scheme + "://" + u.Host}
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		switch {
+		case key == "poll":
+			poll, err := time.ParseDuration(value)
+			if err != nil || poll <= 0 {
+				return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: bad poll interval %q", s, value)
+			}
+			uri.PollInterval = poll
+		case key == "insecure" && u.Scheme == "https":
+			insecure, err := strconv.ParseBool(value)
+			if err != nil {
+				return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: bad insecure flag %q", s, value)
+			}
+			uri.Insecure = insecure
+		default:
+			return ConnectionURI{}, fmt.Errorf("invalid connection URI %q: unknown parameter %q", s, key)
+		}
+	}
+
+	return uri, nil
+}
+
+// checkQuery rejects parameters on schemes that take none
+func checkQuery(s string, u *url.URL) error {
+	if u.RawQuery != "" {
+		return fmt.Errorf("invalid connection URI %q: %s URIs take no parameters", s, u.Scheme)
+	}
+	return nil
+}
+
+// String formats the URI in its canonical form
+func (c ConnectionURI) String() string {
+	switch c.Scheme {
+	case "serial":
+		return fmt.Sprintf("serial://%s?baud=%d", c.Address, c.BaudRate)
+	case "replay":
+		if c.Speed != 0 {
+			return fmt.Sprintf("replay://%s?speed=%s", c.Address, strconv.FormatFloat(c.Speed, 'g', -1, 64))
+		}
+		return "replay://" + c.Address
+	case "http", "https":
+		query := url.Values{}
+		if c.PollInterval > 0 {
+			query.Set("poll", c.PollInterval.String())
+		}
+		if c.Insecure {
+			query.Set("insecure", "true")
+		}
+		if len(query) == 0 {
+			return c.Address
+		}
+		return c.Address + "?" + query.Encode()
+	default:
+		return c.Scheme + "://" + c.Address
+	}
+}
+
+// Open opens the transport described by the URI
+func (c ConnectionURI) Open() (Transport, error) {
+	switch c.Scheme {
+	case "tcp":
+		return NewTCPTransport(c.Address)
+	case "serial":
+		return NewSerialTransport(c.Address, c.BaudRate)
+	case "file":
+		return newFileTransport(c.Address)
+	case "replay":
+		return OpenReplay(c.Address, ReplayOptions{Speed: c.Speed})
+	case "http", "https":
+		return NewHTTPTransport(c.Address, HTTPTransportOptions{PollInterval: c.PollInterval, InsecureSkipVerify: c.Insecure})
+	}
+
+	return nil, fmt.Errorf("unsupported scheme %q", c.Scheme)
+}
+
+// OpenTransport parses a radio address with ParseConnectionURI and opens its transport
+func OpenTransport(addr string) (Transport, error) {
+	uri, err := ParseConnectionURI(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return uri.Open()
+}
+
+// fileTransport replays a file of raw bytes read from a radio. Like a real device it stays
+// quiet until the client sends its first request, and once the file is exhausted it blocks
+// until closed instead of reporting a dead link. Writes are discarded
+type fileTransport struct {
+	file      *os.File
+	started   chan struct{}
+	closed    chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+func newFileTransport(path string) (Transport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileTransport{file: file, started: make(chan struct{}), closed: make(chan struct{})}, nil
+}
+
+func (f *fileTransport) Read(p []byte) (int, error) {
+	select {
+	case <-f.started:
+	case <-f.closed:
+		return 0, os.ErrClosed
+	}
+
+	n, err := f.file.Read(p)
+	if err == io.EOF {
+		<-f.closed
+		return n, os.ErrClosed
+	}
+
+	return n, err
+}
+
+func (f *fileTransport) Write(p []byte) (int, error) {
+	f.startOnce.Do(func() { close(f.started) })
+	return len(p), nil
+}
+
+func (f *fileTransport) Close() error {
+	f.closeOnce.Do(func() { close(f.closed) })
+	return f.file.Close()
+}
+
+func (f *fileTransport) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (f *fileTransport) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package gomesh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/b7r-dev/goMesh/github.com/meshtastic/gomeshproto"
+)
+
+func TestParseConnectionURI(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected ConnectionURI
+		wantErr  bool
+	}{
+		{"Bare IPv4", "192.168.1.20", ConnectionURI{Scheme: "tcp", Address: "192.168.1.20:4403"}, false},
+		{"Bare IPv6", "fe80::1", ConnectionURI{Scheme: "tcp", Address: "[fe80::1]:4403"}, false},
+		{"Bare serial port", "/dev/ttyUSB0", ConnectionURI{Scheme: "serial", Address: "/dev/ttyUSB0", BaudRate: 115200}, false},
+		{"TCP hostname", "tcp://node.local", ConnectionURI{Scheme: "tcp", Address: "node.local:4403"}, false},
+		{"TCP custom port", "tcp://node.local:4000", ConnectionURI{Scheme: "tcp", Address: "node.local:4000"}, false},
+		{"TCP IPv6 with port", "tcp://[fe80::1]:4404", ConnectionURI{Scheme: "tcp", Address: "[fe80::1]:4404"}, false},
+		{"Serial path with baud", "serial:///dev/ttyACM0?baud=921600", ConnectionURI{Scheme: "serial", Address: "/dev/ttyACM0", BaudRate: 921600}, false},
+		{"Serial windows port", "serial://COM3", ConnectionURI{Scheme: "serial", Address: "COM3", BaudRate: 115200}, false},
+		{"Relative file", "file://capture.bin", ConnectionURI{Scheme: "file", Address: "capture.bin"}, false},
+		{"Absolute file", "file:///tmp/capture.bin", ConnectionURI{Scheme: "file", Address: "/tmp/capture.bin"}, false},
+		{"Replay", "replay://session.jsonl", ConnectionURI{Scheme: "replay", Address: "session.jsonl"}, false},
+		{"Replay with speed", "replay:///tmp/session.jsonl?speed=2.5", ConnectionURI{Scheme: "replay", Address: "/tmp/session.jsonl", Speed: 2.5}, false},
+		{"HTTP", "http://meshtastic.local", ConnectionURI{Scheme: "http", Address: "http://meshtastic.local"}, false},
+		{"HTTPS with options", "https://192.168.1.20:8443/?insecure=true&poll=250ms", ConnectionURI{Scheme: "https", Address: "https://192.168.1.20:8443", PollInterval: 250 * time.Millisecond, Insecure: true}, false},
+		{"Empty", "", ConnectionURI{}, true},
+		{"Unknown scheme", "udp://node.local", ConnectionURI{}, true},
+		{"TCP missing host", "tcp://:4403", ConnectionURI{}, true},
+		{"TCP bad port", "tcp://node.local:99999", ConnectionURI{}, true},
+		{"TCP with path", "tcp://node.local/api", ConnectionURI{}, true},
+		{"TCP with parameters", "tcp://node.local?baud=1", ConnectionURI{}, true},
+		{"Serial bad baud", "serial:///dev/ttyACM0?baud=fast", ConnectionURI{}, true},
+		{"Serial zero baud", "serial:///dev/ttyACM0?baud=0", ConnectionURI{}, true},
+		{"Serial unknown parameter", "serial:///dev/ttyACM0?parity=odd", ConnectionURI{}, true},
+		{"Serial missing port", "serial://", ConnectionURI{}, true},
+		{"File missing path", "file://", ConnectionURI{}, true},
+		{"Replay bad speed", "replay://session.jsonl?speed=fast", ConnectionURI{}, true},
+		{"Replay unknown parameter", "replay://session.jsonl?loop=true", ConnectionURI{}, true},
+		{"HTTP insecure flag", "http://meshtastic.local?insecure=true", ConnectionURI{}, true},
+		{"HTTP bad poll", "http://meshtastic.local?poll=soon", ConnectionURI{}, true},
+		{"HTTP with path", "http://meshtastic.local/api/v1", ConnectionURI{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseConnectionURI(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseConnectionURI(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("ParseConnectionURI(%q) = %+v, expected %+v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestInitFromFileURI(t *testing.T) {
+	// A recorded stream: console noise, an unrelated packet and the answer to a config request
+	var stream []byte
+	stream = append(stream, []byte("INFO | 12:00:00 boot\n")...)
+	stream = append(stream, encodeTestFrame(t, textPacket(1, 0, "x"))...)
+	stream = append(stream, encodeTestFrame(t, &pb.FromRadio{PayloadVariant: &pb.FromRadio_MyInfo{MyInfo: &pb.MyNodeInfo{MyNodeNum: 0x5150}}})...)
+	stream = append(stream, encodeTestFrame(t, &pb.FromRadio{PayloadVariant: &pb.FromRadio_ConfigCompleteId{ConfigCompleteId: ConfigOnlyNonce}})...)
+
+	path := filepath.Join(t.TempDir(), "capture.bin")
+	if err := os.WriteFile(path, stream, 0o600); err != nil {
+		t.Fatalf("Error writing capture: %v", err)
+	}
+
+	radio := Radio{}
+	if err := radio.Init("file://" + path); err != nil {
+		t.Fatalf("Error initializing from capture: %v", err)
+	}
+	defer radio.Close()
+
+	if radio.GetNodeID() != 0x5150 {
+		t.Errorf("Expected node number 0x5150, got 0x%x", radio.GetNodeID())
+	}
+}
@@ -1,7 +1,8 @@
 package gomesh
 
 import (
-	"math/rand"
+	"context"
+	"crypto/rand"
 	"strconv"
 	"time"
 )
@@ -31,8 +32,51 @@ func convPSK(param string) (psk []byte, err error) {
 func genPSK256() []byte {
 
 	token := make([]byte, 32)
-	rand.Seed(time.Now().UnixNano())
 	rand.Read(token)
 
 	return token
 }
+
+// sleepContext pauses for d, returning early with the context error if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return contextError(ctx)
+	}
+}
+
+// exponentialBackoff returns the wait before the given attempt, starting at 1: initial doubled
+// for every earlier attempt and capped at max. Zero or negative durations take the defaults
+func exponentialBackoff(attempt int, initial, defaultInitial, max, defaultMax time.Duration) time.Duration {
+	if initial <= 0 {
+		initial = defaultInitial
+	}
+	if max <= 0 {
+		max = defaultMax
+	}
+
+	wait := initial
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+
+	return wait
+}
+
+// deadline returns the time d from now, or the deadline of ctx if that is sooner
+func deadline(ctx context.Context, d time.Duration) time.Time {
+	t := time.Now().Add(d)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(t) {
+		return ctxDeadline
+	}
+
+	return t
+}